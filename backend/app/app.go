@@ -37,7 +37,8 @@ func (a *App) Startup(ctx context.Context) {
 
 // DomReady is called after front-end resources have been loaded
 func (a *App) DomReady(ctx context.Context) {
-	// Add your action here
+	// plugins are evaluated by the frontend, so scheduled runs and tool checks wait until it is loaded
+	hub.FrontendReady(ctx)
 }
 
 // BeforeClose is called when the application is about to quit,
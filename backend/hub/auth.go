@@ -0,0 +1,207 @@
+package hub
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// Scopes granted to API tokens.
+const (
+	ScopeToolsRead      = "tools:read"
+	ScopeToolsCall      = "tools:call"
+	ScopeToolsRegister  = "tools:register"
+	ScopeClipboardRead  = "clipboard:read"
+	ScopeClipboardWrite = "clipboard:write"
+	ScopeAdmin          = "admin" // grants every scope
+)
+
+var apiTokenScopes = []string{ScopeToolsRead, ScopeToolsCall, ScopeToolsRegister, ScopeClipboardRead, ScopeClipboardWrite, ScopeAdmin}
+
+const apiTokenPrefix = "th_"
+
+type apiTokenContextKey struct{}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// hasScope reports whether the token grants scope.
+func (t *APIToken) hasScope(scope string) bool {
+	scopes := splitList(t.Scopes)
+	return slices.Contains(scopes, ScopeAdmin) || slices.Contains(scopes, scope)
+}
+
+// allowsTool reports whether the token may call the named tool.
+func (t *APIToken) allowsTool(name string) bool {
+	tools := splitList(t.Tools)
+	return len(tools) == 0 || t.hasScope(ScopeAdmin) || slices.Contains(tools, name)
+}
+
+// createAPIToken generates a token and stores its hash, the plaintext token is only returned here.
+func createAPIToken(ctx context.Context, name string, scopes []string, tools []string, expiresIn time.Duration) (string, APIToken, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", APIToken{}, fmt.Errorf("token name is required")
+	}
+	if len(scopes) == 0 {
+		return "", APIToken{}, fmt.Errorf("at least one scope is required")
+	}
+	for _, s := range scopes {
+		if !slices.Contains(apiTokenScopes, s) {
+			return "", APIToken{}, fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", APIToken{}, err
+	}
+	token := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	item := APIToken{
+		Name:   strings.TrimSpace(name),
+		Prefix: token[:len(apiTokenPrefix)+6],
+		Hash:   hashAPIToken(token),
+		Scopes: strings.Join(scopes, ","),
+		Tools:  strings.Join(tools, ","),
+	}
+	if expiresIn > 0 {
+		item.ExpiresAt = time.Now().Add(expiresIn).UnixMilli()
+	}
+	if err := gorm.G[APIToken](db).Create(ctx, &item); err != nil {
+		return "", APIToken{}, err
+	}
+	return token, item, nil
+}
+
+// authenticate looks up the token presented in the Authorization header of r.
+func authenticate(r *http.Request) (*APIToken, error) {
+	header := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return nil, fmt.Errorf("missing bearer token")
+	}
+	item, err := gorm.G[APIToken](db).Where("hash = ?", hashAPIToken(token)).Take(r.Context())
+	if err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+	now := time.Now().UnixMilli()
+	if item.RevokedAt != 0 {
+		return nil, fmt.Errorf("token revoked")
+	}
+	if item.ExpiresAt != 0 && item.ExpiresAt < now {
+		return nil, fmt.Errorf("token expired")
+	}
+	gorm.G[APIToken](db).Where("id = ?", item.ID).Update(r.Context(), "last_used_at", now)
+	return &item, nil
+}
+
+// requireScope wraps next so that it is only served to requests carrying a token granting scope.
+// Preflight requests pass through since browsers never attach credentials to them.
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+		token, err := authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tool-hub"`)
+			http.Error(w, fmt.Sprintf("Unauthorized: %v", err), http.StatusUnauthorized)
+			return
+		}
+		if !token.hasScope(scope) {
+			http.Error(w, fmt.Sprintf("Forbidden: token lacks scope %s", scope), http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), apiTokenContextKey{}, token)))
+	}
+}
+
+// requestAllowsTool reports whether the token of an authenticated request may call the named tool.
+func requestAllowsTool(r *http.Request, name string) bool {
+	token, ok := r.Context().Value(apiTokenContextKey{}).(*APIToken)
+	return ok && token.hasScope(ScopeToolsCall) && token.allowsTool(name)
+}
+
+// #region Auth Bindings
+
+type RespCreateAPIToken struct {
+	Error string   `json:"error"`
+	Token string   `json:"token"` // plaintext token, it can't be retrieved again
+	Item  APIToken `json:"item"`
+}
+
+// CreateAPIToken creates a token with scopes, tools limits the tools it may call and expiresInDays 0 never expires.
+func (m *Model) CreateAPIToken(name string, scopes []string, tools []string, expiresInDays int) (resp RespCreateAPIToken) {
+	var err error
+	resp.Token, resp.Item, err = createAPIToken(m.ctx, name, scopes, tools, time.Duration(expiresInDays)*24*time.Hour)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to create api token: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespGetAPITokenList struct {
+	Error string     `json:"error"`
+	List  []APIToken `json:"list"`
+}
+
+func (m *Model) GetAPITokenList() (resp RespGetAPITokenList) {
+	list, err := gorm.G[APIToken](db).Order("id DESC").Find(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to list api tokens: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	resp.List = list
+	return
+}
+
+type RespRevokeAPIToken struct {
+	Error string `json:"error"`
+}
+
+func (m *Model) RevokeAPIToken(id int) (resp RespRevokeAPIToken) {
+	_, err := gorm.G[APIToken](db).Where("id = ? AND revoked_at = 0", id).Update(m.ctx, "revoked_at", time.Now().UnixMilli())
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to revoke api token: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// GetAPITokenScopes returns all scopes a token can be granted.
+func (m *Model) GetAPITokenScopes() []string {
+	return apiTokenScopes
+}
+
+// #endregion
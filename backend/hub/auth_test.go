@@ -0,0 +1,66 @@
+package hub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireScope(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+
+	callToken, _, err := createAPIToken(ctx, "agent", []string{ScopeToolsCall}, []string{"git-diff"}, 0)
+	assert.NoError(t, err)
+	adminToken, _, err := createAPIToken(ctx, "admin", []string{ScopeAdmin}, nil, 0)
+	assert.NoError(t, err)
+	expiredToken, _, err := createAPIToken(ctx, "expired", []string{ScopeToolsCall}, nil, time.Millisecond)
+	assert.NoError(t, err)
+	revokedToken, revoked, err := createAPIToken(ctx, "revoked", []string{ScopeToolsCall}, nil, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, model.RevokeAPIToken(revoked.ID).Error)
+	time.Sleep(2 * time.Millisecond)
+
+	_, _, err = createAPIToken(ctx, "bad", []string{"tools:everything"}, nil, 0)
+	assert.Error(t, err)
+
+	var allowed map[string]bool
+	handler := func(scope string) http.HandlerFunc {
+		return requireScope(scope, func(w http.ResponseWriter, r *http.Request) {
+			allowed = map[string]bool{
+				"git-diff": requestAllowsTool(r, "git-diff"),
+				"rm-rf":    requestAllowsTool(r, "rm-rf"),
+			}
+		})
+	}
+	serve := func(scope string, token string) int {
+		allowed = nil
+		req := httptest.NewRequest(http.MethodPost, "/api/callTool", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler(scope)(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(ScopeToolsCall, ""))
+	assert.Equal(t, http.StatusUnauthorized, serve(ScopeToolsCall, "th_unknown"))
+	assert.Equal(t, http.StatusUnauthorized, serve(ScopeToolsCall, expiredToken))
+	assert.Equal(t, http.StatusUnauthorized, serve(ScopeToolsCall, revokedToken))
+	assert.Equal(t, http.StatusForbidden, serve(ScopeToolsRegister, callToken))
+
+	assert.Equal(t, http.StatusOK, serve(ScopeToolsCall, callToken))
+	assert.Equal(t, map[string]bool{"git-diff": true, "rm-rf": false}, allowed)
+
+	assert.Equal(t, http.StatusOK, serve(ScopeToolsRegister, adminToken))
+	assert.Equal(t, map[string]bool{"git-diff": true, "rm-rf": true}, allowed)
+
+	list := model.GetAPITokenList()
+	assert.Empty(t, list.Error)
+	assert.Len(t, list.List, 4)
+}
@@ -2,10 +2,10 @@ package hub
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path"
+	"strconv"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"gorm.io/gorm"
@@ -104,18 +104,37 @@ func (m *Model) SaveSetting(key string, value string) (resp RespSaveSetting) {
 		}
 		return
 	}
+	if key == string(SettingKeyToolDir) && m.ctx != nil {
+		startToolsDirSync(m.ctx)
+	}
 	return
 }
 
+// getSetting returns the value of a setting, or fallback when it's not saved or empty.
+func getSetting(ctx context.Context, key StringValues, fallback string) string {
+	s, err := gorm.G[Setting](db).Where("key = ?", string(key)).Take(ctx)
+	if err != nil || s.Value == "" {
+		return fallback
+	}
+	return s.Value
+}
+
 // #endregion
 
 // #region Tools
 
 type ToolBrief struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Category    string `json:"category"`
+	ID            int              `json:"id"`
+	Name          string           `json:"name"`
+	Description   string           `json:"description"`
+	Namespace     string           `json:"namespace" gorm:"-"` // see toolNamespace
+	Category      string           `json:"category"`
+	Tags          string           `json:"tags"`
+	Status        string           `json:"status"`
+	SourceMissing bool             `json:"sourceMissing"`
+	UpdatedAt     int64            `json:"updatedAt"`
+	Preflight     *PreflightResult `json:"preflight" gorm:"-"` // latest result of preflightTool, nil when unchecked
+	DeletedAt     gorm.DeletedAt   `json:"-"`
 }
 
 func (t *ToolBrief) TableName() string {
@@ -128,7 +147,7 @@ type RespGetToolList struct {
 }
 
 func (m *Model) GetToolList() (resp RespGetToolList) {
-	list, err := gorm.G[ToolBrief](db).Select("id", "name", "description").Order("name").Find(m.ctx)
+	list, err := gorm.G[ToolBrief](db).Select(toolBriefColumns).Order("name").Find(m.ctx)
 	if err != nil {
 		resp.Error = fmt.Sprintf("failed to list tools: %v", err)
 		if m.ctx != nil {
@@ -136,7 +155,7 @@ func (m *Model) GetToolList() (resp RespGetToolList) {
 		}
 		return
 	}
-	resp.List = list
+	resp.List = completeBriefs(list)
 	return
 }
 
@@ -147,7 +166,7 @@ type RespGetTool struct {
 
 func (m *Model) GetTool(id int) (resp RespGetTool) {
 	var err error
-	resp.Item, err = gorm.G[Tool](db).Where("id = ?", id).Take(m.ctx)
+	resp.Item, err = findTool(m.ctx, strconv.Itoa(id), false)
 	if err != nil {
 		resp.Error = fmt.Sprintf("failed to get tool detail: %v", err)
 		if m.ctx != nil {
@@ -165,7 +184,7 @@ type RespGetCommandLineTool struct {
 
 func (m *Model) GetCommandLineTool(id int) (resp RespGetCommandLineTool) {
 	// Get base tool from database
-	tool, err := gorm.G[Tool](db).Where("id = ?", id).Take(m.ctx)
+	tool, err := findTool(m.ctx, strconv.Itoa(id), false)
 	if err != nil {
 		resp.Error = fmt.Sprintf("failed to get tool: %v", err)
 		if m.ctx != nil {
@@ -174,28 +193,16 @@ func (m *Model) GetCommandLineTool(id int) (resp RespGetCommandLineTool) {
 		return
 	}
 
-	// Set base tool info
-	// resp.Item.Tool = tool
-
 	// Evaluate the tool with default parameters using frontend WebWorker
 	if tool.Code != "" && tool.DefaultParams != "" {
-		toolData, err := EvalTool(m.ctx, tool.Code, tool.DefaultParams)
+		resp.Item, err = evalCommandLineTool(m.ctx, tool, tool.DefaultParams)
 		if err != nil {
-			resp.Error = fmt.Sprintf("failed to evaluate tool: %v", err)
-			if m.ctx != nil {
-				runtime.LogError(m.ctx, resp.Error)
-			}
-			return
-		}
-		// Parse the evaluated command line tool
-		if err := json.Unmarshal(toolData, &resp.Item); err != nil {
-			resp.Error = fmt.Sprintf("failed to parse command line tool: %v", err)
+			resp.Error = err.Error()
 			if m.ctx != nil {
 				runtime.LogError(m.ctx, resp.Error)
 			}
 			return
 		}
-		resp.Item.BaseModel = tool.BaseModel
 	}
 
 	return
@@ -208,7 +215,7 @@ type RespGetHTTPTool struct {
 
 func (m *Model) GetHTTPTool(id int) (resp RespGetHTTPTool) {
 	// Get base tool from database
-	tool, err := gorm.G[Tool](db).Where("id = ?", id).Take(m.ctx)
+	tool, err := findTool(m.ctx, strconv.Itoa(id), false)
 	if err != nil {
 		resp.Error = fmt.Sprintf("failed to get tool: %v", err)
 		if m.ctx != nil {
@@ -217,29 +224,16 @@ func (m *Model) GetHTTPTool(id int) (resp RespGetHTTPTool) {
 		return
 	}
 
-	// Set base tool info
-	// resp.Item.Tool = tool
-
 	// Evaluate the tool with default parameters using frontend WebWorker
 	if tool.Code != "" && tool.DefaultParams != "" {
-		toolData, err := EvalTool(m.ctx, tool.Code, tool.DefaultParams)
+		resp.Item, err = evalHTTPTool(m.ctx, tool, tool.DefaultParams)
 		if err != nil {
-			resp.Error = fmt.Sprintf("failed to evaluate tool: %v", err)
-			if m.ctx != nil {
-				runtime.LogError(m.ctx, resp.Error)
-			}
-			return
-		}
-
-		// Parse the evaluated HTTP tool
-		if err := json.Unmarshal(toolData, &resp.Item); err != nil {
-			resp.Error = fmt.Sprintf("failed to parse HTTP tool: %v", err)
+			resp.Error = err.Error()
 			if m.ctx != nil {
 				runtime.LogError(m.ctx, resp.Error)
 			}
 			return
 		}
-		resp.Item.BaseModel = tool.BaseModel
 	}
 
 	return
@@ -0,0 +1,451 @@
+package hub
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// A tool bundle is a zip archive moving tools and their testcases between machines:
+//
+//	manifest.json       bundleManifest, with the sha256 of every other file
+//	tools/<n>.json      bundledTool, one per tool
+//
+// Tools don't reference settings or concurrency groups in the database, ConcurrencyGroupName only exists in
+// the evaluated CommandLineTool, so tools and testcases are all a bundle holds.
+
+const (
+	bundleFormat        = "tool-hub-bundle"
+	bundleVersion       = 1
+	bundleManifestName  = "manifest.json"
+	maxBundleSize       = 32 << 20
+	maxBundleEntrySize  = 8 << 20
+	maxBundleTotalSize  = 64 << 20 // uncompressed bytes read from a bundle
+	maxBundleEntries    = 4096
+	bundleContentType   = "application/zip"
+	bundleFileExtension = ".toolbundle.zip"
+)
+
+// Conflict policies applied when an imported tool has the name of an existing one.
+const (
+	BundleConflictSkip      = "skip"
+	BundleConflictOverwrite = "overwrite"
+	BundleConflictRename    = "rename"
+)
+
+type bundleManifest struct {
+	Format    string            `json:"format"`
+	Version   int               `json:"version"`
+	CreatedAt int64             `json:"createdAt"`
+	Tools     []string          `json:"tools"`     // files of the tools in the archive
+	Checksums map[string]string `json:"checksums"` // file -> sha256 in hex
+}
+
+type bundledTestcase struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	OK     bool   `json:"ok"`
+}
+
+type bundledTool struct {
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	Parameters    string            `json:"parameters"`
+	Category      string            `json:"category"`
+	Schema        string            `json:"schema"`
+	Definition    string            `json:"definition"`
+	Code          string            `json:"code"`
+	DefaultParams string            `json:"defaultParams"`
+	Cache         string            `json:"cache,omitempty"`    // CachePolicy, missing from older bundles
+	Tags          string            `json:"tags,omitempty"`     // comma separated, missing from older bundles
+	Requires      string            `json:"requires,omitempty"` // ToolRequirements, missing from older bundles
+	Testcases     []bundledTestcase `json:"testcases"`
+}
+
+// BundleImportResult reports what importing a bundle did, or would do in a dry run, to a tool.
+type BundleImportResult struct {
+	Name      string      `json:"name"`
+	NewName   string      `json:"newName"`   // name the tool is stored under, differs from Name when renamed
+	Action    string      `json:"action"`    // "created", "skipped", "overwritten" or "renamed"
+	Testcases int         `json:"testcases"` // number of testcases imported
+	Issues    []ToolIssue `json:"issues"`    // found by lintTool in the imported tool
+	Draft     bool        `json:"draft"`     // the tool has errors and is imported as a draft
+}
+
+// exportToolBundle writes the named tools, or all tools when names is empty, to a bundle.
+func exportToolBundle(ctx context.Context, names []string) ([]byte, error) {
+	q := gorm.G[Tool](db).Order("name")
+	if len(names) > 0 {
+		q = q.Where("name IN ?", names)
+	}
+	tools, err := q.Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(tools, func(t Tool) bool { return t.Name == name }) {
+			return nil, fmt.Errorf("%w: %s", errToolNotFound, name)
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	manifest := bundleManifest{
+		Format:    bundleFormat,
+		Version:   bundleVersion,
+		CreatedAt: time.Now().UnixMilli(),
+		Tools:     make([]string, 0, len(tools)),
+		Checksums: map[string]string{},
+	}
+	for i, tool := range tools {
+		testcases, err := gorm.G[ToolTestcase](db).Where("tool_name = ?", tool.Name).Order("id").Find(ctx)
+		if err != nil {
+			return nil, err
+		}
+		item := bundledTool{
+			Name:          tool.Name,
+			Description:   tool.Description,
+			Parameters:    tool.Parameters,
+			Category:      tool.Category,
+			Schema:        tool.Schema,
+			Definition:    tool.Definition,
+			Code:          tool.Code,
+			DefaultParams: tool.DefaultParams,
+			Cache:         tool.Cache,
+			Tags:          tool.Tags,
+			Requires:      tool.Requires,
+			Testcases:     make([]bundledTestcase, 0, len(testcases)),
+		}
+		for _, tc := range testcases {
+			item.Testcases = append(item.Testcases, bundledTestcase{Input: tc.Input, Output: tc.Output, OK: tc.OK})
+		}
+		data, err := json.MarshalIndent(item, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		// tool names may contain characters which aren't valid in file names
+		name := fmt.Sprintf("tools/%d.json", i+1)
+		if err := writeBundleFile(zw, name, data); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		manifest.Tools = append(manifest.Tools, name)
+		manifest.Checksums[name] = hex.EncodeToString(sum[:])
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBundleFile(zw, bundleManifestName, data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeBundleFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readToolBundle checks the manifest and checksums of a bundle and returns its tools.
+// Only the manifest and the files it lists are read, within maxBundleEntrySize each and maxBundleTotalSize overall.
+func readToolBundle(data []byte) ([]bundledTool, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if len(zr.File) > maxBundleEntries {
+		return nil, fmt.Errorf("invalid bundle: more than %d files", maxBundleEntries)
+	}
+	entries := map[string]*zip.File{}
+	for _, f := range zr.File {
+		name := path.Clean(f.Name)
+		if _, ok := entries[name]; ok {
+			return nil, fmt.Errorf("invalid bundle: duplicate file %s", f.Name)
+		}
+		entries[name] = f
+	}
+	var total int64
+	readEntry := func(name string) ([]byte, error) {
+		f, ok := entries[path.Clean(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid bundle: missing %s", name)
+		}
+		if f.UncompressedSize64 > maxBundleEntrySize {
+			return nil, fmt.Errorf("invalid bundle: %s is too large", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle: %w", err)
+		}
+		defer rc.Close()
+		// reading up to EOF lets archive/zip check the size and CRC of entries within the limit
+		content, err := io.ReadAll(io.LimitReader(rc, maxBundleEntrySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle: %s: %w", name, err)
+		}
+		if len(content) > maxBundleEntrySize {
+			return nil, fmt.Errorf("invalid bundle: %s is too large", name)
+		}
+		total += int64(len(content))
+		if total > maxBundleTotalSize {
+			return nil, fmt.Errorf("invalid bundle: more than %d bytes uncompressed", maxBundleTotalSize)
+		}
+		return content, nil
+	}
+
+	var manifest bundleManifest
+	raw, err := readEntry(bundleManifestName)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	if manifest.Format != bundleFormat {
+		return nil, fmt.Errorf("invalid bundle: unknown format %q", manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d, this hub reads up to version %d", manifest.Version, bundleVersion)
+	}
+
+	tools := make([]bundledTool, 0, len(manifest.Tools))
+	for _, name := range manifest.Tools {
+		content, err := readEntry(name)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		if manifest.Checksums[name] != hex.EncodeToString(sum[:]) {
+			return nil, fmt.Errorf("invalid bundle: checksum mismatch for %s", name)
+		}
+		var item bundledTool
+		if err := json.Unmarshal(content, &item); err != nil {
+			return nil, fmt.Errorf("invalid bundle: %s: %w", name, err)
+		}
+		if err := validateTool(Tool{Name: item.Name, Parameters: item.Parameters, DefaultParams: item.DefaultParams, Cache: item.Cache, Requires: item.Requires}); err != nil {
+			return nil, fmt.Errorf("invalid bundle: %s: %w", name, err)
+		}
+		tools = append(tools, item)
+	}
+	return tools, nil
+}
+
+// importToolBundle stores the tools of a bundle, conflicts with existing tools are resolved by policy.
+// Tools are linted first, tools with errors are imported as drafts. Nothing is written when dryRun is true,
+// the results tell what would be done.
+func importToolBundle(ctx context.Context, data []byte, policy string, dryRun bool) ([]BundleImportResult, error) {
+	if policy == "" {
+		policy = BundleConflictSkip
+	}
+	if !slices.Contains([]string{BundleConflictSkip, BundleConflictOverwrite, BundleConflictRename}, policy) {
+		return nil, fmt.Errorf("unknown conflict policy %q", policy)
+	}
+	tools, err := readToolBundle(data)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BundleImportResult, 0, len(tools))
+	taken := map[string]bool{} // names given to tools of this bundle
+	for _, item := range tools {
+		result := BundleImportResult{Name: item.Name, NewName: item.Name, Action: "created", Testcases: len(item.Testcases)}
+		exists, err := toolNameTaken(ctx, item.Name)
+		if err != nil {
+			return results, err
+		}
+		if exists || taken[item.Name] {
+			switch policy {
+			case BundleConflictSkip:
+				result.Action = "skipped"
+				result.Testcases = 0
+			case BundleConflictOverwrite:
+				result.Action = "overwritten"
+			case BundleConflictRename:
+				result.Action = "renamed"
+				for i := 2; ; i++ {
+					name := item.Name + "-" + strconv.Itoa(i)
+					exists, err := toolNameTaken(ctx, name)
+					if err != nil {
+						return results, err
+					}
+					if !exists && !taken[name] {
+						result.NewName = name
+						break
+					}
+				}
+			}
+		}
+		taken[result.NewName] = true
+		if result.Action == "skipped" {
+			results = append(results, result)
+			continue
+		}
+		tool, issues, err := lintToolStatus(ctx, item.tool(result.NewName), true)
+		if err != nil {
+			return results, err
+		}
+		result.Issues, result.Draft = issues, tool.Status == ToolStatusDraft
+		if !dryRun {
+			if err := storeBundledTool(ctx, tool, item.Testcases); err != nil {
+				return results, fmt.Errorf("failed to import tool %s: %w", item.Name, err)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// toolNameTaken reports whether a tool, soft deleted included, has the name.
+func toolNameTaken(ctx context.Context, name string) (bool, error) {
+	count, err := gorm.G[Tool](db).Scopes(unscoped).Where("name = ?", name).Count(ctx, "*")
+	return count > 0, err
+}
+
+// tool returns the tool of a bundle under name.
+func (item bundledTool) tool(name string) Tool {
+	return Tool{
+		Name:          name,
+		Description:   item.Description,
+		Parameters:    item.Parameters,
+		Category:      item.Category,
+		Schema:        item.Schema,
+		Definition:    item.Definition,
+		Code:          item.Code,
+		DefaultParams: item.DefaultParams,
+		Cache:         item.Cache,
+		Tags:          item.Tags,
+		Requires:      item.Requires,
+	}
+}
+
+// storeBundledTool saves a tool of a bundle, replaces its testcases and checks its requirements.
+func storeBundledTool(ctx context.Context, tool Tool, testcases []bundledTestcase) error {
+	name := tool.Name
+	saved, err := saveTool(ctx, tool)
+	if err != nil {
+		return err
+	}
+	preflightStoredTool(ctx, saved)
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := gorm.G[ToolTestcase](tx).Where("tool_name = ?", name).Delete(ctx); err != nil {
+			return err
+		}
+		for _, tc := range testcases {
+			testcase := ToolTestcase{ToolName: name, Input: tc.Input, Output: tc.Output, OK: tc.OK}
+			if err := gorm.G[ToolTestcase](tx).Create(ctx, &testcase); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// #region Bundle HTTP
+
+// exportBundle serves GET /api/bundle?tools=a,b, all tools are exported when tools is missing.
+func exportBundle(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	data, err := exportToolBundle(ctx, splitList(r.URL.Query().Get("tools")))
+	if err != nil {
+		if errors.Is(err, errToolNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to export tools: %v", err), http.StatusInternalServerError)
+		return
+	}
+	filename := "tools-" + time.Now().Format("20060102-150405") + bundleFileExtension
+	w.Header().Set("Content-Type", bundleContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(data)
+}
+
+type RespImportToolBundle struct {
+	Error  string               `json:"error"`
+	DryRun bool                 `json:"dryRun"`
+	List   []BundleImportResult `json:"list"`
+}
+
+// importBundle serves POST /api/bundle?policy=skip|overwrite|rename&dryRun=true with the archive as body.
+func importBundle(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBundleSize))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	resp := RespImportToolBundle{DryRun: query.Get("dryRun") == "true"}
+	resp.List, err = importToolBundle(ctx, data, query.Get("policy"), resp.DryRun)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to import tools: %v", err), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// #endregion
+
+// #region Bundle Bindings
+
+type RespExportToolBundle struct {
+	Error string `json:"error"`
+}
+
+// ExportToolBundle writes the named tools, or all tools when names is empty, to a bundle at path.
+func (m *Model) ExportToolBundle(names []string, path string) (resp RespExportToolBundle) {
+	data, err := exportToolBundle(m.ctx, names)
+	if err == nil {
+		err = os.WriteFile(path, data, 0o644)
+	}
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to export tools: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// ImportToolBundle imports the bundle at path, see importToolBundle for policy and dryRun.
+func (m *Model) ImportToolBundle(path string, policy string, dryRun bool) (resp RespImportToolBundle) {
+	resp.DryRun = dryRun
+	data, err := os.ReadFile(path)
+	if err == nil {
+		resp.List, err = importToolBundle(m.ctx, data, policy, dryRun)
+	}
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to import tools: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// #endregion
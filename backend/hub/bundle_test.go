@@ -0,0 +1,175 @@
+package hub
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestToolBundle(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalCache), "false").Error)
+	fakeEvalFrontend(t, func(r EvalToolRequestEvent) {
+		if r.Code == "broken" {
+			deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Error: "SyntaxError"})
+			return
+		}
+		deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Success: true, Tool: json.RawMessage(`{"extra": {"cmd": "echo"}}`)})
+	})
+
+	_, err := saveTool(ctx, Tool{Name: "echo", Description: "print text", Code: "v1"})
+	assert.NoError(t, err)
+	_, err = saveTool(ctx, Tool{Name: "fetch", Code: "v1"})
+	assert.NoError(t, err)
+	assert.NoError(t, gorm.G[ToolTestcase](db).Create(ctx, &ToolTestcase{ToolName: "echo", Input: `{"text": "hi"}`, Output: "hi", OK: true}))
+
+	_, err = exportToolBundle(ctx, []string{"missing"})
+	assert.ErrorIs(t, err, errToolNotFound)
+	data, err := exportToolBundle(ctx, []string{"echo"})
+	assert.NoError(t, err)
+
+	_, _, err = updateTool(ctx, "echo", ToolPatch{Code: ptr("v2")}, false)
+	assert.NoError(t, err)
+
+	results, err := importToolBundle(ctx, data, BundleConflictSkip, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []BundleImportResult{{Name: "echo", NewName: "echo", Action: "skipped"}}, results)
+
+	results, err = importToolBundle(ctx, data, BundleConflictRename, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "echo-2", results[0].NewName)
+	_, err = findTool(ctx, "echo-2", false)
+	assert.ErrorIs(t, err, errToolNotFound, "dry run should not write")
+
+	results, err = importToolBundle(ctx, data, BundleConflictRename, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "renamed", results[0].Action)
+	renamed, err := findTool(ctx, "echo-2", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "print text", renamed.Description)
+	_, ok := hubPreflight.get(renamed.ID, renamed.UpdatedAt)
+	assert.True(t, ok, "imported tools should be checked")
+	count, err := gorm.G[ToolTestcase](db).Where("tool_name = ?", "echo-2").Count(ctx, "*")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	results, err = importToolBundle(ctx, data, BundleConflictOverwrite, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "overwritten", results[0].Action)
+	echo, err := findTool(ctx, "echo", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", echo.Code)
+	count, err = gorm.G[ToolTestcase](db).Where("tool_name = ?", "echo").Count(ctx, "*")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count, "testcases should be replaced")
+
+	// tools with errors are imported as drafts
+	_, _, err = updateTool(ctx, "fetch", ToolPatch{Code: ptr("broken")}, true)
+	assert.NoError(t, err)
+	data, err = exportToolBundle(ctx, []string{"fetch"})
+	assert.NoError(t, err)
+	results, err = importToolBundle(ctx, data, BundleConflictRename, false)
+	assert.NoError(t, err)
+	assert.True(t, results[0].Draft)
+	assert.Equal(t, "code", results[0].Issues[len(results[0].Issues)-1].Field)
+	fetch, err := findTool(ctx, results[0].NewName, false)
+	assert.NoError(t, err)
+	assert.Equal(t, ToolStatusDraft, fetch.Status)
+}
+
+func TestReadToolBundle_checksum(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	_, err := saveTool(ctx, Tool{Name: "echo", Code: "v1"})
+	assert.NoError(t, err)
+	data, err := exportToolBundle(ctx, nil)
+	assert.NoError(t, err)
+
+	// rewrite the archive with a tampered tool file
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		if f.Name != bundleManifestName {
+			content = bytes.Replace(content, []byte("v1"), []byte("v9"), 1)
+		}
+		assert.NoError(t, writeBundleFile(zw, f.Name, content))
+	}
+	assert.NoError(t, zw.Close())
+
+	_, err = readToolBundle(buf.Bytes())
+	assert.ErrorContains(t, err, "checksum mismatch")
+	_, err = readToolBundle([]byte("not a zip"))
+	assert.Error(t, err)
+}
+
+func TestReadToolBundle_limits(t *testing.T) {
+	bundle := func(write func(zw *zip.Writer, manifest *bundleManifest)) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		manifest := bundleManifest{Format: bundleFormat, Version: bundleVersion, Checksums: map[string]string{}}
+		write(zw, &manifest)
+		data, err := json.Marshal(manifest)
+		assert.NoError(t, err)
+		assert.NoError(t, writeBundleFile(zw, bundleManifestName, data))
+		assert.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	// the header of the entry understates its size
+	data := bundle(func(zw *zip.Writer, manifest *bundleManifest) {
+		var compressed bytes.Buffer
+		fw, _ := flate.NewWriter(&compressed, flate.BestCompression)
+		fw.Write(make([]byte, maxBundleEntrySize+1))
+		fw.Close()
+		w, err := zw.CreateRaw(&zip.FileHeader{Name: "tools/0.json", Method: zip.Deflate,
+			CompressedSize64: uint64(compressed.Len()), UncompressedSize64: 2})
+		assert.NoError(t, err)
+		w.Write(compressed.Bytes())
+		manifest.Tools = []string{"tools/0.json"}
+	})
+	_, err := readToolBundle(data)
+	assert.ErrorIs(t, err, zip.ErrFormat, "the entry should be rejected, not truncated")
+
+	// every entry is within the limit, all of them aren't
+	content := append(bytes.Repeat([]byte(" "), maxBundleEntrySize-16), `{"name": "t"}`...)
+	sum := sha256.Sum256(content)
+	data = bundle(func(zw *zip.Writer, manifest *bundleManifest) {
+		for i := 0; i*len(content) <= maxBundleTotalSize; i++ {
+			name := fmt.Sprintf("tools/%d.json", i)
+			assert.NoError(t, writeBundleFile(zw, name, content))
+			manifest.Tools = append(manifest.Tools, name)
+			manifest.Checksums[name] = hex.EncodeToString(sum[:])
+		}
+	})
+	_, err = readToolBundle(data)
+	assert.ErrorContains(t, err, "bytes uncompressed")
+
+	data = bundle(func(zw *zip.Writer, manifest *bundleManifest) {
+		for i := 0; i < maxBundleEntries; i++ {
+			assert.NoError(t, writeBundleFile(zw, fmt.Sprintf("junk/%d", i), nil))
+		}
+	})
+	_, err = readToolBundle(data)
+	assert.ErrorContains(t, err, "more than 4096 files")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
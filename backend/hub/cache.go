@@ -0,0 +1,305 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// Tools whose results only depend on their parameters opt into caching with a CachePolicy, e.g.
+//
+//	{"ttl": "10m", "inputs": ["/data/*.csv"]}
+//
+// A call looks up the output of a previous call with the same key before the plugin is evaluated, the key
+// covers the definition of the tool, the canonicalized parameters, the profile and the input files declared
+// by the policy. Only successful outputs are cached, artifacts aren't. The cache is bounded by the
+// ResultCacheSize setting, the least recently used results are evicted first. The key can't cover the secrets
+// resolved in the tool evaluated after the lookup, so the cache is emptied whenever a secret changes.
+
+const (
+	defaultCacheTTL        = time.Hour
+	defaultResultCacheSize = 64 << 20
+
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+// parseCachePolicy parses the cache policy of a tool, it returns nil when the tool doesn't cache its results.
+func parseCachePolicy(s string) (*CachePolicy, error) {
+	if s == "" || s == "null" {
+		return nil, nil
+	}
+	var policy CachePolicy
+	if err := json.Unmarshal([]byte(s), &policy); err != nil {
+		return nil, fmt.Errorf("invalid cache policy: %w", err)
+	}
+	if _, err := policy.ttl(); err != nil {
+		return nil, err
+	}
+	for _, pattern := range policy.Inputs {
+		if _, err := filepath.Glob(pattern); err != nil {
+			return nil, fmt.Errorf("invalid cache input %q: %w", pattern, err)
+		}
+	}
+	return &policy, nil
+}
+
+func (p *CachePolicy) ttl() (time.Duration, error) {
+	if p.TTL == "" {
+		return defaultCacheTTL, nil
+	}
+	d, err := time.ParseDuration(p.TTL)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid cache ttl %q", p.TTL)
+	}
+	return d, nil
+}
+
+// cacheable reports whether the result of call may come from the cache, calls with their own stdin or files don't.
+func cacheable(call toolCall) bool {
+	return call.Stdin == nil && call.StdinReader == nil && len(call.Files) == 0
+}
+
+// canonicalJSON returns parameters with object keys sorted and without insignificant whitespace.
+func canonicalJSON(parameters string) (string, error) {
+	if parameters == "" {
+		return "null", nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(parameters)))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return "", err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return "", fmt.Errorf("unexpected data after the parameters")
+	}
+	out, err := json.Marshal(v)
+	return string(out), err
+}
+
+// cacheKey identifies the result of a call of tool.
+func cacheKey(ctx context.Context, tool Tool, call toolCall, policy *CachePolicy) (string, error) {
+	parameters, err := canonicalJSON(call.Parameters)
+	if err != nil {
+		return "", err
+	}
+	profile, err := resolveProfile(ctx, call.Profile)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, part := range []string{tool.Name, tool.Category, tool.Code, tool.DefaultParams, tool.Cache, parameters} {
+		fmt.Fprintf(h, "%d:%s;", len(part), part)
+	}
+	if profile != nil {
+		fmt.Fprintf(h, "profile:%d:%d;", profile.ID, profile.UpdatedAt)
+	}
+	if err := fingerprintInputs(h, policy); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fingerprintInputs writes what tells the input files of policy apart to w.
+func fingerprintInputs(w io.Writer, policy *CachePolicy) error {
+	for _, pattern := range policy.Inputs {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		sort.Strings(matches)
+		fmt.Fprintf(w, "input:%s:%d;", pattern, len(matches))
+		for _, name := range matches {
+			fi, err := os.Stat(name)
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				fmt.Fprintf(w, "%s:dir:%d;", name, fi.ModTime().UnixNano())
+				continue
+			}
+			if !policy.Hash {
+				fmt.Fprintf(w, "%s:%d:%d;", name, fi.Size(), fi.ModTime().UnixNano())
+				continue
+			}
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			sum := sha256.New()
+			_, err = io.Copy(sum, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s:%x;", name, sum.Sum(nil))
+		}
+	}
+	return nil
+}
+
+// lookupCachedResult returns the cached output of key, expired results are removed.
+func lookupCachedResult(ctx context.Context, key string) ([]byte, bool) {
+	result, err := gorm.G[CachedResult](db).Where("key = ?", key).Take(ctx)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now().UnixMilli()
+	if result.ExpiresAt <= now {
+		gorm.G[CachedResult](db).Where("id = ?", result.ID).Delete(ctx)
+		return nil, false
+	}
+	db.WithContext(ctx).Model(&CachedResult{}).Where("id = ?", result.ID).
+		Updates(map[string]any{"hits": gorm.Expr("hits + 1"), "last_used_at": now})
+	return result.Output, true
+}
+
+// storeCachedResult caches the output of key and evicts results beyond the size of the cache.
+func storeCachedResult(ctx context.Context, toolName string, key string, out []byte, ttl time.Duration) error {
+	maxSize := resultCacheSize(ctx)
+	if int64(len(out)) > maxSize {
+		return nil
+	}
+	now := time.Now()
+	result := CachedResult{
+		Key:        key,
+		ToolName:   toolName,
+		Output:     out,
+		Size:       int64(len(out)),
+		ExpiresAt:  now.Add(ttl).UnixMilli(),
+		LastUsedAt: now.UnixMilli(),
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := gorm.G[CachedResult](tx).Where("key = ?", key).Delete(ctx); err != nil {
+			return err
+		}
+		return gorm.G[CachedResult](tx).Create(ctx, &result)
+	})
+	if err != nil {
+		return err
+	}
+	return evictCachedResults(ctx, maxSize)
+}
+
+func resultCacheSize(ctx context.Context) int64 {
+	size, err := strconv.ParseInt(getSetting(ctx, SettingKeyResultCacheSize, ""), 10, 64)
+	if err != nil || size < 0 {
+		return defaultResultCacheSize
+	}
+	return size
+}
+
+// evictCachedResults removes the expired results, then the least recently used ones until the cache fits maxSize.
+func evictCachedResults(ctx context.Context, maxSize int64) error {
+	if _, err := gorm.G[CachedResult](db).Where("expires_at <= ?", time.Now().UnixMilli()).Delete(ctx); err != nil {
+		return err
+	}
+	var total int64
+	if err := db.WithContext(ctx).Model(&CachedResult{}).Select("COALESCE(SUM(size), 0)").Scan(&total).Error; err != nil {
+		return err
+	}
+	for total > maxSize {
+		oldest, err := gorm.G[CachedResult](db).Select("id", "size").Order("last_used_at, id").Limit(100).Find(ctx)
+		if err != nil || len(oldest) == 0 {
+			return err
+		}
+		var ids []int
+		for _, result := range oldest {
+			if total <= maxSize {
+				break
+			}
+			ids = append(ids, result.ID)
+			total -= result.Size
+		}
+		if _, err := gorm.G[CachedResult](db).Where("id IN ?", ids).Delete(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeToolCache removes the cached results of a tool and returns how many there were.
+func purgeToolCache(ctx context.Context, toolName string) (int, error) {
+	return gorm.G[CachedResult](db).Where("tool_name = ?", toolName).Delete(ctx)
+}
+
+// purgeResultCache removes every cached result, see saveSecret.
+func purgeResultCache(ctx context.Context) error {
+	_, err := gorm.G[CachedResult](db).Where("1 = 1").Delete(ctx)
+	return err
+}
+
+// executeCachedToolCall runs call through the cache of tool, see executeToolCallCached.
+func executeCachedToolCall(ctx context.Context, tool Tool, call toolCall, policy *CachePolicy) ([]byte, string, error) {
+	key, err := cacheKey(ctx, tool, call, policy)
+	if err != nil {
+		// e.g. invalid parameters, which the plugin reports better
+		out, err := executeTool(ctx, tool, call)
+		return out, "", err
+	}
+	if out, ok := lookupCachedResult(ctx, key); ok {
+		return out, cacheHit, nil
+	}
+	out, err := executeTool(ctx, tool, call)
+	if err != nil {
+		return out, cacheMiss, err
+	}
+	ttl, _ := policy.ttl()
+	if err := storeCachedResult(ctx, tool.Name, key, out, ttl); err != nil {
+		runtime.LogWarningf(ctx, "failed to cache the result of %s: %v", tool.Name, err)
+	}
+	return out, cacheMiss, nil
+}
+
+// RespPurgeToolCache is the response of DELETE /api/tools/{ref}/cache.
+type RespPurgeToolCache struct {
+	Error   string `json:"error"`
+	Deleted int    `json:"deleted"` // number of cached results removed
+}
+
+func purgeToolCacheHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	tool, err := findTool(ctx, r.PathValue("ref"), true)
+	if err != nil {
+		writeJSON(w, toolErrorStatus(err), RespPurgeToolCache{Error: err.Error()})
+		return
+	}
+	deleted, err := purgeToolCache(ctx, tool.Name)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, RespPurgeToolCache{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, RespPurgeToolCache{Deleted: deleted})
+}
+
+// #region Cache Bindings
+
+// PurgeToolCache removes the cached results of the named tool.
+func (m *Model) PurgeToolCache(name string) (resp RespPurgeToolCache) {
+	deleted, err := purgeToolCache(m.ctx, name)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to purge the cache of %s: %v", name, err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	resp.Deleted = deleted
+	return
+}
+
+// #endregion
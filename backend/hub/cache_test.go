@@ -0,0 +1,137 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestParseCachePolicy(t *testing.T) {
+	policy, err := parseCachePolicy("")
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+	policy, err = parseCachePolicy(`{"ttl": "5m", "inputs": ["/data/*.csv"]}`)
+	assert.NoError(t, err)
+	ttl, _ := policy.ttl()
+	assert.Equal(t, 5*time.Minute, ttl)
+
+	for _, s := range []string{`{`, `{"ttl": "later"}`, `{"ttl": "-1m"}`, `{"inputs": ["[a-"]}`} {
+		_, err := parseCachePolicy(s)
+		assert.Error(t, err, s)
+	}
+	setupTestDB(t)
+	_, err = createTool(context.Background(), Tool{Name: "lookup", Category: "commandLine", Cache: `{"ttl": "soon"}`})
+	assert.ErrorIs(t, err, errInvalidTool)
+}
+
+func TestCacheKey(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	input := filepath.Join(dir, "data.csv")
+	assert.NoError(t, os.WriteFile(input, []byte("a,b"), 0o644))
+
+	tool := Tool{Name: "lookup", Category: "commandLine", Code: "v1"}
+	policy := &CachePolicy{Inputs: []string{filepath.Join(dir, "*.csv")}}
+	key := func(parameters string) string {
+		k, err := cacheKey(ctx, tool, toolCall{Name: tool.Name, Parameters: parameters}, policy)
+		assert.NoError(t, err)
+		return k
+	}
+	k1 := key(`{"a": 1, "b": [1.50, "x"]}`)
+	assert.Equal(t, k1, key(`{"b":[1.50,"x"],  "a":1}`), "parameters should be canonicalized")
+	assert.NotEqual(t, k1, key(`{"a": 2, "b": [1.50, "x"]}`))
+
+	tool.Code = "v2"
+	k2 := key(`{"a": 1, "b": [1.50, "x"]}`)
+	assert.NotEqual(t, k1, k2, "a new version of the tool shouldn't use older results")
+
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(input, later, later))
+	k3 := key(`{"a": 1, "b": [1.50, "x"]}`)
+	assert.NotEqual(t, k2, k3, "changed inputs should change the key")
+
+	policy.Hash = true
+	k4 := key(`{}`)
+	assert.NoError(t, os.Chtimes(input, later.Add(time.Minute), later.Add(time.Minute)))
+	assert.Equal(t, k4, key(`{}`), "inputs are compared by content")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "more.csv"), nil, 0o644))
+	assert.NotEqual(t, k4, key(`{}`))
+
+	_, err := cacheKey(ctx, tool, toolCall{Parameters: `{"a": 1} {}`}, policy)
+	assert.Error(t, err)
+}
+
+func TestResultCache(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+
+	assert.NoError(t, storeCachedResult(ctx, "lookup", "k1", []byte("one"), time.Hour))
+	out, ok := lookupCachedResult(ctx, "k1")
+	assert.True(t, ok)
+	assert.Equal(t, "one", string(out))
+	assert.NoError(t, storeCachedResult(ctx, "lookup", "k1", []byte("uno"), time.Hour))
+	out, _ = lookupCachedResult(ctx, "k1")
+	assert.Equal(t, "uno", string(out), "a result should replace the one with the same key")
+
+	assert.NoError(t, storeCachedResult(ctx, "lookup", "expired", []byte("old"), -time.Second))
+	_, ok = lookupCachedResult(ctx, "expired")
+	assert.False(t, ok)
+
+	// the least recently used results are evicted first
+	assert.Empty(t, model.SaveSetting(string(SettingKeyResultCacheSize), "10").Error)
+	assert.NoError(t, storeCachedResult(ctx, "other", "k2", []byte("four"), time.Hour))
+	time.Sleep(2 * time.Millisecond)
+	_, ok = lookupCachedResult(ctx, "k1")
+	assert.True(t, ok)
+	assert.NoError(t, storeCachedResult(ctx, "other", "k3", []byte("seven"), time.Hour))
+	_, ok = lookupCachedResult(ctx, "k2")
+	assert.False(t, ok, "k2 should be evicted")
+	_, ok = lookupCachedResult(ctx, "k1")
+	assert.True(t, ok)
+	assert.NoError(t, storeCachedResult(ctx, "other", "big", []byte(strings.Repeat("x", 11)), time.Hour))
+	_, ok = lookupCachedResult(ctx, "big")
+	assert.False(t, ok, "results larger than the cache aren't stored")
+
+	result, err := gorm.G[CachedResult](db).Where("key = ?", "k1").Take(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Hits)
+
+	// a cached result is returned without executing the tool
+	assert.Empty(t, model.SaveSetting(string(SettingKeyResultCacheSize), "").Error)
+	tool, err := createTool(ctx, Tool{Name: "lookup", Category: "commandLine", Cache: `{}`})
+	assert.NoError(t, err)
+	policy, _ := parseCachePolicy(tool.Cache)
+	call := toolCall{Name: "lookup", Parameters: `{"q": "go"}`}
+	key, err := cacheKey(ctx, tool, call, policy)
+	assert.NoError(t, err)
+	assert.NoError(t, storeCachedResult(ctx, "lookup", key, []byte("cached"), time.Hour))
+	out, cache, err := executeToolCallCached(ctx, toolCall{Name: "lookup", Parameters: `{ "q" : "go" }`})
+	assert.NoError(t, err)
+	assert.Equal(t, cacheHit, cache)
+	assert.Equal(t, "cached", string(out))
+
+	token, _, err := createAPIToken(ctx, "admin", []string{ScopeToolsRegister}, nil, 0)
+	assert.NoError(t, err)
+	req := httptest.NewRequest(http.MethodDelete, "http://localhost/api/tools/lookup/cache", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	newHubHandler(ctx).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp RespPurgeToolCache
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Deleted)
+	_, ok = lookupCachedResult(ctx, key)
+	assert.False(t, ok)
+	_, ok = lookupCachedResult(ctx, "k3")
+	assert.True(t, ok, "results of other tools are kept")
+}
@@ -4,8 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -17,39 +23,252 @@ import (
 type BodyCallTool struct {
 	Name       string `json:"name"`
 	Parameters string `json:"parameters"`
+	Profile    string `json:"profile"` // profile applied to the call, the active profile when empty
+	// Files seed the workspace of tools running in one, by slash separated relative path. Base64 in JSON.
+	Files      map[string][]byte `json:"files"`
+	AllowDraft bool              `json:"allowDraft"` // call the tool even if it's a draft, see lifecycle.go
 }
 
+var errToolNotFound = errors.New("tool not found")
+
 func callTool(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	ctx = context.WithoutCancel(ctx)
 	var body BodyCallTool
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	var upload *callUpload
+	if isMultipartRequest(r) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxCallUploadSize)
+		var err error
+		body, upload, err = readMultipartCall(r)
+		if err != nil {
+			http.Error(w, err.Error(), callUploadStatus(err))
+			return
+		}
+		defer upload.remove()
+	} else if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if !requestAllowsTool(r, body.Name) {
+		http.Error(w, fmt.Sprintf("Forbidden: token may not call tool %s", body.Name), http.StatusForbidden)
+		return
+	}
 
-	// Fetch tool from database
-	tool, err := gorm.G[Tool](db).Where("name = ?", body.Name).Take(ctx)
+	callID := newCallID()
+	call := toolCall{Name: body.Name, Parameters: body.Parameters, Profile: body.Profile, Files: body.Files, CallID: callID, AllowDraft: body.AllowDraft}
+	if upload != nil {
+		var err error
+		if call.Parameters, err = upload.bindParameters(ctx, body.Name, body.Parameters); err != nil {
+			http.Error(w, err.Error(), callUploadStatus(err))
+			return
+		}
+		if upload.stdin != nil {
+			call.StdinReader = upload.stdin
+		}
+	}
+	w.Header().Set("X-Tool-Call-Id", callID)
+	if tool, err := gorm.G[Tool](db).Where("name = ?", body.Name).Take(ctx); err == nil {
+		setDeprecationHeaders(w.Header(), tool)
+	}
+	out, cache, err := executeToolCallCached(ctx, call)
+	if cache != "" {
+		w.Header().Set("X-Tool-Cache", cache)
+	}
+	if attempts, _ := listCallAttempts(ctx, callID); len(attempts) > 0 {
+		w.Header().Set("X-Tool-Call-Attempts", strconv.Itoa(len(attempts)))
+	}
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
+		if errors.Is(err, errToolNotFound) {
 			http.Error(w, fmt.Sprintf("Tool not found: %s", body.Name), http.StatusNotFound)
 			return
 		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		if errors.Is(err, errProfileNotFound) || errors.Is(err, errInvalidCallFiles) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if isLifecycleError(err) || errors.Is(err, errToolNotReady) {
+			http.Error(w, err.Error(), toolErrorStatus(err))
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Evaluate tool using frontend WebWorker
-	toolData, err := EvalTool(ctx, tool.Code, body.Parameters)
+	// Write response
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// RespCallTool is the result envelope of POST /api/tools/{ref}/call.
+type RespCallTool struct {
+	Error     string        `json:"error"`
+	Output    string        `json:"output"` // output of the tool
+	CallID    string        `json:"callId"`
+	Artifacts []Artifact    `json:"artifacts"` // files collected from the workspace of the call
+	Attempts  []CallAttempt `json:"attempts"`  // attempts of calls made with a retry policy
+	Cache     string        `json:"cache"`     // "hit" or "miss" for tools with a cache policy
+	Warnings  []string      `json:"warnings"`  // e.g. the tool is deprecated
+}
+
+// callToolByRef calls the tool referenced in the path with the request body as parameters,
+// the profile query parameter chooses the profile applied to the call and draft=true allows calling a draft.
+// Unlike callTool, the output is wrapped in RespCallTool so that clients get JSON whatever the tool prints.
+func callToolByRef(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	parameters, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeJSON(w, http.StatusBadRequest, RespCallTool{Error: "Invalid request body"})
+		return
+	}
+	tool, err := findTool(ctx, r.PathValue("ref"), false)
+	if err != nil {
+		writeJSON(w, toolErrorStatus(err), RespCallTool{Error: err.Error()})
 		return
 	}
+	if !requestAllowsTool(r, tool.Name) {
+		writeJSON(w, http.StatusForbidden, RespCallTool{Error: fmt.Sprintf("token may not call tool %s", tool.Name)})
+		return
+	}
+	setDeprecationHeaders(w.Header(), tool)
+	var warnings []string
+	if warning := deprecationWarning(tool); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	callID := newCallID()
+	query := r.URL.Query()
+	call := toolCall{Name: tool.Name, Parameters: string(parameters), Profile: query.Get("profile"), CallID: callID, AllowDraft: query.Get("draft") == "true"}
+	out, cache, err := executeToolCallCached(ctx, call)
+	attempts, _ := listCallAttempts(ctx, callID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errProfileNotFound) {
+			status = http.StatusBadRequest
+		} else if isLifecycleError(err) || errors.Is(err, errToolNotReady) {
+			status = toolErrorStatus(err)
+		}
+		writeJSON(w, status, RespCallTool{Error: err.Error(), Output: string(out), CallID: callID, Attempts: attempts, Cache: cache, Warnings: warnings})
+		return
+	}
+	artifacts, err := listArtifacts(ctx, callID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, RespCallTool{Error: err.Error(), Output: string(out), CallID: callID, Attempts: attempts, Cache: cache, Warnings: warnings})
+		return
+	}
+	writeJSON(w, http.StatusOK, RespCallTool{Output: string(out), CallID: callID, Artifacts: artifacts, Attempts: attempts, Cache: cache, Warnings: warnings})
+}
+
+// toolCall describes a call of a tool made inside the hub.
+type toolCall struct {
+	Name        string
+	Parameters  string
+	Stdin       *string           // replaces the stdin computed by the plugin when not nil
+	StdinReader io.Reader         // replaces the stdin computed by the plugin when not nil, takes precedence over Stdin
+	Profile     string            // profile applied to command line tools, the active profile when empty
+	Files       map[string][]byte // files seeding the workspace of the tool, see workspace.go
+	CallID      string            // identifies the artifacts of the call, generated when empty
+	AllowDraft  bool              // calls the tool even if it's a draft
+}
+
+// invokeTool evaluates the plugin of the named tool with parameters and executes the result.
+func invokeTool(ctx context.Context, name string, parameters string) ([]byte, error) {
+	return executeToolCall(ctx, toolCall{Name: name, Parameters: parameters})
+}
+
+// executeToolCall runs a tool call, it is shared by the HTTP handler and every in-process caller of tools.
+// Secret references are resolved after the plugin is evaluated, and secret values are redacted from the
+// output and errors.
+func executeToolCall(ctx context.Context, call toolCall) ([]byte, error) {
+	out, _, err := executeToolCallCached(ctx, call)
+	return out, err
+}
+
+// executeToolCallCached is executeToolCall reporting whether the output came from the cache of the tool,
+// "hit" or "miss", or empty when the call didn't go through the cache, see cache.go.
+func executeToolCallCached(ctx context.Context, call toolCall) ([]byte, string, error) {
+	if call.CallID == "" {
+		call.CallID = newCallID()
+	}
+	// Fetch tool from database
+	tool, err := gorm.G[Tool](db).Where("name = ?", call.Name).Take(ctx)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, "", fmt.Errorf("%w: %s", errToolNotFound, call.Name)
+		}
+		return nil, "", fmt.Errorf("database error: %w", err)
+	}
+	if err := checkToolLifecycle(tool, call.AllowDraft); err != nil {
+		return nil, "", err
+	}
+	policy, err := parseCachePolicy(tool.Cache)
+	if err != nil {
+		return nil, "", err
+	}
+	if policy != nil && cacheable(call) {
+		return executeCachedToolCall(ctx, tool, call, policy)
+	}
+	out, err := executeTool(ctx, tool, call)
+	return out, "", err
+}
+
+// executeTool runs a call of tool, see executeToolCall.
+func executeTool(ctx context.Context, tool Tool, call toolCall) ([]byte, error) {
+	if CategoryOfTool(tool.Category) == CategoryPipeline {
+		return runPipeline(ctx, tool, call, executeToolCall)
+	}
 
+	// Evaluate tool using frontend WebWorker
+	toolData, err := EvalTool(ctx, tool.Code, call.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkToolReady(ctx, tool, toolData, call.Profile); err != nil {
+		return nil, err
+	}
+
+	redactor, err := newSecretRedactor(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+	plan, err := parseRetryPolicy(toolData)
+	if err != nil {
+		return nil, err
+	}
+	attempt := func() ([]byte, error) {
+		if CategoryOfTool(tool.Category) == CategoryHTTP {
+			return executeHTTPTool(ctx, toolData)
+		}
+		return executeCommandLineTool(ctx, toolData, call)
+	}
+	var out []byte
+	if plan != nil {
+		out, err = runAttempts(ctx, plan, call, redactor, attempt)
+	} else {
+		out, err = attempt()
+	}
+	out = redactor.redact(out)
+	if err != nil {
+		return out, &redactedError{msg: redactor.redactString(err.Error()), err: err}
+	}
+	return out, nil
+}
+
+// redactedError hides secret values from the message of err.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// executeCommandLineTool runs the evaluated command line tool with the stdin and profile of call.
+func executeCommandLineTool(ctx context.Context, toolData []byte, call toolCall) ([]byte, error) {
 	// Parse the tool based on category
 	var commandLineTool CommandLineTool
 	if err := json.Unmarshal(toolData, &commandLineTool); err != nil {
-		http.Error(w, "Failed to parse tool response", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to parse tool response: %w", err)
+	}
+	if call.Stdin != nil {
+		commandLineTool.Extra.Stdin = *call.Stdin
 	}
 
 	// Parse environment variables
@@ -59,35 +278,185 @@ func callTool(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 			envMap = nil
 		}
 	}
-
 	// Parse timeout from tool configuration
 	var timeout time.Duration
 	if commandLineTool.Timeout != "" {
+		var err error
 		timeout, err = time.ParseDuration(commandLineTool.Timeout)
 		if err != nil {
 			timeout = 0 // Use default (no timeout)
 		}
 	}
 
+	envPolicy, err := toolEnvPolicy(ctx, commandLineTool.Extra)
+	if err != nil {
+		return nil, err
+	}
+	options := cmd.StreamOptions{
+		Cwd:       commandLineTool.Extra.WD,
+		Env:       envMap,
+		EnvPolicy: envPolicy,
+		Shell:     commandLineTool.Extra.Sh,
+		Timeout:   timeout,
+	}
+	profile, err := resolveProfile(ctx, call.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile != nil {
+		if err := applyProfile(*profile, &options); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range options.Env {
+		value, err := resolveSecrets(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("env %s: %w", k, err)
+		}
+		options.Env[k] = value
+	}
+
 	// Execute the command using shared runner
+	var stdin io.Reader = bytes.NewReader([]byte(commandLineTool.Extra.Stdin))
+	if call.StdinReader != nil {
+		stdin = call.StdinReader
+	}
 	input := cmd.Input{
-		Reader: bytes.NewReader([]byte(commandLineTool.Extra.Stdin)),
-		Options: cmd.StreamOptions{
-			Cwd:     commandLineTool.Extra.WD,
-			Env:     envMap,
-			Shell:   commandLineTool.Extra.Sh,
-			Timeout: timeout,
-		},
+		Reader:  stdin,
+		Options: options,
 		Command: []string{commandLineTool.Extra.Cmd},
 	}
 
-	out, err := cmd.SharedRunner.Run(input)
+	if !commandLineTool.Extra.Workspace {
+		if len(call.Files) > 0 {
+			return nil, fmt.Errorf("%w: tool %s doesn't run in a workspace", errInvalidCallFiles, call.Name)
+		}
+		out, err := cmd.SharedRunner.Run(input)
+		if err != nil {
+			return nil, fmt.Errorf("command execution failed: %w", err)
+		}
+		return out, nil
+	}
+
+	// the workspace is specific to the call, so the command gets a process of its own
+	if err := validateOutputPatterns(commandLineTool.Extra.Outputs); err != nil {
+		return nil, err
+	}
+	dir, err := prepareWorkspace(call.Files)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Command execution failed: %v", err), http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	input.Options.Cwd = dir
+	out, err := cmd.RunOnce(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("command execution failed: %w", err)
+	}
+	if _, err := collectArtifacts(ctx, dir, call.CallID, call.Name, commandLineTool.Extra.Outputs); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// toolEnvPolicy returns the environment inheritance policy of a command line tool,
+// the one of the tool when set, otherwise the hub-wide EnvPolicy setting, otherwise inheriting everything.
+func toolEnvPolicy(ctx context.Context, extra CommandLineToolExtra) (cmd.EnvPolicy, error) {
+	if extra.EnvPolicy != "" {
+		allow := extra.EnvAllow
+		if allow == "" {
+			allow = getSetting(ctx, SettingKeyEnvAllowlist, "")
+		}
+		return cmd.ParseEnvPolicy(extra.EnvPolicy, allow)
 	}
+	return cmd.ParseEnvPolicy(getSetting(ctx, SettingKeyEnvPolicy, cmd.EnvInheritAll), getSetting(ctx, SettingKeyEnvAllowlist, ""))
+}
 
-	// Write response
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(out)
+// maxHTTPToolResponseSize limits the body of responses read by HTTP tools.
+const maxHTTPToolResponseSize = 16 << 20
+
+// executeHTTPTool sends the request described by the evaluated HTTP tool and returns the response body.
+func executeHTTPTool(ctx context.Context, toolData []byte) ([]byte, error) {
+	var httpTool HTTPTool
+	if err := json.Unmarshal(toolData, &httpTool); err != nil {
+		return nil, fmt.Errorf("failed to parse tool response: %w", err)
+	}
+	extra := httpTool.Extra
+
+	rawURL, err := resolveSecrets(ctx, extra.URL)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid url %q", extra.URL)
+	}
+	query, err := resolveSecrets(ctx, extra.Query)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	if query != "" {
+		values := u.Query()
+		var params map[string]string
+		if json.Unmarshal([]byte(query), &params) == nil {
+			for k, v := range params {
+				values.Set(k, v)
+			}
+		} else {
+			extraValues, err := url.ParseQuery(strings.TrimPrefix(query, "?"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid query: %w", err)
+			}
+			for k, v := range extraValues {
+				values[k] = v
+			}
+		}
+		u.RawQuery = values.Encode()
+	}
+	body, err := resolveSecrets(ctx, extra.Body)
+	if err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+
+	method := strings.ToUpper(extra.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range extra.Headers {
+		value, err := resolveSecrets(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", k, err)
+		}
+		req.Header.Set(k, value)
+	}
+	if body != "" && req.Header.Get("Content-Type") == "" && json.Valid([]byte(body)) {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{}
+	if httpTool.Timeout != "" {
+		if timeout, err := time.ParseDuration(httpTool.Timeout); err == nil {
+			client.Timeout = timeout
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPToolResponseSize))
+	if err != nil {
+		return out, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return out, &httpStatusError{code: resp.StatusCode, status: resp.Status}
+	}
+	return out, nil
 }
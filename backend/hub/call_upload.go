@@ -0,0 +1,262 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// /api/callTool also accepts multipart/form-data requests carrying files, which are never base64 encoded:
+//
+//	name        form field, the tool to call
+//	parameters  form field, JSON parameters of the tool
+//	profile     form field, profile applied to the call
+//	allowDraft  form field, "true" calls the tool even if it's a draft
+//	stdin       file, the stdin of the command instead of the one computed by the plugin
+//	<param>     file bound to the parameter <param>, which receives the path of the file in a temporary
+//	            directory, or an array of paths when the parameter is an array
+//
+// When the JSON schema of a parameter declares "contentMediaType", e.g. "application/pdf" or "image/*",
+// the files bound to it must be of that type. The type is the Content-Type of the part, or the one
+// sniffed from the content when the client sends none or application/octet-stream.
+
+// maxCallUploadSize limits the size of multipart requests of /api/callTool.
+const maxCallUploadSize = 256 << 20
+
+// callUploadStdinField is the name of the part streamed to the stdin of the command.
+const callUploadStdinField = "stdin"
+
+// callUpload holds the files of a multipart call, spooled to a temporary directory.
+type callUpload struct {
+	dir   string
+	stdin *os.File
+	files []uploadedFile
+}
+
+type uploadedFile struct {
+	Field     string
+	Path      string
+	MediaType string
+}
+
+func isMultipartRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "multipart/form-data"
+}
+
+// readMultipartCall reads the fields and files of a multipart call, files are written to a temporary
+// directory which is removed by calling remove on the returned upload.
+func readMultipartCall(r *http.Request) (BodyCallTool, *callUpload, error) {
+	var body BodyCallTool
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return body, nil, fmt.Errorf("%w: %v", errInvalidCallFiles, err)
+	}
+	dir, err := os.MkdirTemp("", "tool-hub-upload-")
+	if err != nil {
+		return body, nil, err
+	}
+	upload := &callUpload{dir: dir}
+	for i := 0; ; i++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			upload.remove()
+			return body, nil, fmt.Errorf("%w: %w", errInvalidCallFiles, err)
+		}
+		err = upload.readPart(i, part, &body)
+		part.Close()
+		if err != nil {
+			upload.remove()
+			return body, nil, err
+		}
+	}
+	if upload.stdin != nil {
+		if _, err := upload.stdin.Seek(0, io.SeekStart); err != nil {
+			upload.remove()
+			return body, nil, err
+		}
+	}
+	return body, upload, nil
+}
+
+func (u *callUpload) readPart(i int, part *multipart.Part, body *BodyCallTool) error {
+	field := part.FormName()
+	if part.FileName() == "" && field != callUploadStdinField {
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		switch field {
+		case "name":
+			body.Name = string(value)
+		case "parameters":
+			body.Parameters = string(value)
+		case "profile":
+			body.Profile = string(value)
+		case "allowDraft":
+			if body.AllowDraft, err = strconv.ParseBool(string(value)); err != nil {
+				return fmt.Errorf("%w: invalid allowDraft %q", errInvalidCallFiles, value)
+			}
+		default:
+			return fmt.Errorf("%w: unknown field %q", errInvalidCallFiles, field)
+		}
+		return nil
+	}
+	if field == "" {
+		return fmt.Errorf("%w: file part without a name", errInvalidCallFiles)
+	}
+
+	if field == callUploadStdinField {
+		if u.stdin != nil {
+			return fmt.Errorf("%w: more than one stdin", errInvalidCallFiles)
+		}
+		f, err := os.CreateTemp(u.dir, "stdin-")
+		if err != nil {
+			return err
+		}
+		u.stdin = f
+		_, err = io.Copy(f, part)
+		return err
+	}
+
+	name := filepath.Base(part.FileName())
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		name = "upload"
+	}
+	// every file has a directory of its own so that files keep their name
+	p := filepath.Join(u.dir, strconv.Itoa(i), name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+	if _, err := f.Write(head); err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, part); err != nil {
+		return err
+	}
+	u.files = append(u.files, uploadedFile{Field: field, Path: p, MediaType: partMediaType(part, head)})
+	return nil
+}
+
+// partMediaType returns the type declared by the part, or the type sniffed from head when it declares none.
+func partMediaType(part *multipart.Part, head []byte) string {
+	mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if err != nil || mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	}
+	return mediaType
+}
+
+// matchMediaType reports whether mediaType matches pattern, "image/*" matches every image.
+func matchMediaType(pattern string, mediaType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	mediaType = strings.ToLower(mediaType)
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return pattern == mediaType
+}
+
+// bindParameters sets the parameters which files are bound to, after checking them against the JSON schema
+// of the tool's parameters.
+func (u *callUpload) bindParameters(ctx context.Context, toolName string, parameters string) (string, error) {
+	if len(u.files) == 0 {
+		return parameters, nil
+	}
+	tool, err := gorm.G[Tool](db).Where("name = ?", toolName).Take(ctx)
+	if err == gorm.ErrRecordNotFound {
+		return "", fmt.Errorf("%w: %s", errToolNotFound, toolName)
+	}
+	if err != nil {
+		return "", err
+	}
+	var schema struct {
+		Properties map[string]struct {
+			Type             any    `json:"type"`
+			ContentMediaType string `json:"contentMediaType"`
+		} `json:"properties"`
+	}
+	if tool.Parameters != "" {
+		if err := json.Unmarshal([]byte(tool.Parameters), &schema); err != nil {
+			return "", fmt.Errorf("invalid parameters schema of tool %s: %w", toolName, err)
+		}
+	}
+	params := map[string]any{}
+	if strings.TrimSpace(parameters) != "" {
+		if err := json.Unmarshal([]byte(parameters), &params); err != nil {
+			return "", fmt.Errorf("%w: parameters should be a JSON object: %v", errInvalidCallFiles, err)
+		}
+	}
+	bound := map[string]bool{}
+	for _, file := range u.files {
+		prop, ok := schema.Properties[file.Field]
+		if !ok {
+			return "", fmt.Errorf("%w: tool %s has no parameter %s", errInvalidCallFiles, toolName, file.Field)
+		}
+		if prop.ContentMediaType != "" && !matchMediaType(prop.ContentMediaType, file.MediaType) {
+			return "", fmt.Errorf("%w: parameter %s expects %s, got %s", errInvalidCallFiles, file.Field, prop.ContentMediaType, file.MediaType)
+		}
+		if prop.Type == "array" {
+			paths, _ := params[file.Field].([]any)
+			params[file.Field] = append(paths, file.Path)
+			continue
+		}
+		if bound[file.Field] {
+			return "", fmt.Errorf("%w: more than one file for parameter %s", errInvalidCallFiles, file.Field)
+		}
+		bound[file.Field] = true
+		params[file.Field] = file.Path
+	}
+	bs, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+// remove deletes the files of the upload.
+func (u *callUpload) remove() {
+	if u.stdin != nil {
+		u.stdin.Close()
+	}
+	os.RemoveAll(u.dir)
+}
+
+// callUploadStatus is the status of the response to a multipart call which failed with err.
+func callUploadStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errToolNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errInvalidCallFiles):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,131 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// multipartCall builds a multipart call, files maps "field:filename:content type" to the content.
+func multipartCall(t *testing.T, fields map[string]string, files map[string]string) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		assert.NoError(t, mw.WriteField(k, v))
+	}
+	for spec, content := range files {
+		parts := strings.SplitN(spec, ":", 3)
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+parts[0]+`"; filename="`+parts[1]+`"`)
+		if parts[2] != "" {
+			h.Set("Content-Type", parts[2])
+		}
+		w, err := mw.CreatePart(h)
+		assert.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	assert.NoError(t, mw.Close())
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/api/callTool", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestReadMultipartCall(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	_, err := createTool(ctx, Tool{Name: "pdf2text", Category: "commandLine", Parameters: `{
+		"type": "object",
+		"properties": {
+			"document": {"type": "string", "contentMediaType": "application/pdf"},
+			"images": {"type": "array", "items": {"type": "string", "contentMediaType": "image/*"}}
+		}
+	}`})
+	assert.NoError(t, err)
+
+	req := multipartCall(t, map[string]string{"name": "pdf2text", "parameters": `{"pages": 2}`}, map[string]string{
+		"document:report.pdf:":   "%PDF-1.7 ...",
+		"images:a.png:image/png": "png",
+		"stdin:-:":               "\x00\x01binary",
+	})
+	body, upload, err := readMultipartCall(req)
+	assert.NoError(t, err)
+	defer upload.remove()
+	assert.Equal(t, "pdf2text", body.Name)
+	stdin, err := io.ReadAll(upload.stdin)
+	assert.NoError(t, err)
+	assert.Equal(t, "\x00\x01binary", string(stdin))
+
+	parameters, err := upload.bindParameters(ctx, body.Name, body.Parameters)
+	assert.NoError(t, err)
+	var params struct {
+		Pages    int      `json:"pages"`
+		Document string   `json:"document"`
+		Images   []string `json:"images"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(parameters), &params))
+	assert.Equal(t, 2, params.Pages)
+	assert.True(t, strings.HasSuffix(params.Document, "report.pdf"))
+	content, err := os.ReadFile(params.Document)
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.7 ...", string(content), "the type of the pdf should be sniffed")
+	assert.Len(t, params.Images, 1)
+
+	upload.remove()
+	assert.NoFileExists(t, params.Document)
+}
+
+func TestCallTool_multipartChecks(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	_, err := createTool(ctx, Tool{Name: "pdf2text", Category: "commandLine",
+		Parameters: `{"type": "object", "properties": {"document": {"type": "string", "contentMediaType": "application/pdf"}}}`})
+	assert.NoError(t, err)
+	token, _, err := createAPIToken(ctx, "scripts", []string{ScopeToolsCall}, nil, 0)
+	assert.NoError(t, err)
+	handler := newHubHandler(ctx)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(multipartCall(t, map[string]string{"name": "pdf2text"}, map[string]string{"document:a.zip:application/zip": "PK"}))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "expects application/pdf")
+
+	rec = serve(multipartCall(t, map[string]string{"name": "pdf2text"}, map[string]string{"unknown:a.pdf:application/pdf": "%PDF"}))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(multipartCall(t, map[string]string{"name": "missing"}, map[string]string{"document:a.pdf:application/pdf": "%PDF"}))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// drafts are called with files or stdin when the call allows them
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalCache), "false").Error)
+	fakeEvalFrontend(t, func(r EvalToolRequestEvent) {
+		deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Success: true, Tool: json.RawMessage(r.Code)})
+	})
+	_, err = createTool(ctx, Tool{Name: "cat", Category: "commandLine", Code: `{"extra": {"sh": "sh", "cmd": "cat"}}`, Status: ToolStatusDraft})
+	assert.NoError(t, err)
+	rec = serve(multipartCall(t, map[string]string{"name": "cat"}, map[string]string{"stdin:-:": "streamed"}))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = serve(multipartCall(t, map[string]string{"name": "cat", "allowDraft": "true"}, map[string]string{"stdin:-:": "streamed"}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "streamed")
+	rec = serve(multipartCall(t, map[string]string{"name": "cat", "allowDraft": "maybe"}, nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	assert.True(t, matchMediaType("image/*", "image/png"))
+	assert.False(t, matchMediaType("image/*", "application/pdf"))
+}
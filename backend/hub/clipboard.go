@@ -0,0 +1,366 @@
+package hub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+const (
+	maxClipboardContentSize      = 1 << 20 // 1MB
+	defaultClipboardHistoryLimit = 1000
+	clipboardPollInterval        = time.Second
+)
+
+var (
+	// clipboardLastText is the last text seen on or written to the system clipboard,
+	// so the watcher doesn't record an entry twice.
+	clipboardLastText   string
+	clipboardLastTextMu sync.Mutex
+)
+
+func clipboardHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func detectClipboardContentType(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return "application/json"
+	}
+	return "text/plain"
+}
+
+// addClipboardEntry records content in the clipboard history.
+// Content already in the history is moved to the top instead of being duplicated.
+func addClipboardEntry(ctx context.Context, content string, contentType string, source string) (ClipboardEntry, error) {
+	if content == "" {
+		return ClipboardEntry{}, fmt.Errorf("empty content")
+	}
+	if len(content) > maxClipboardContentSize {
+		return ClipboardEntry{}, fmt.Errorf("content is larger than %d bytes", maxClipboardContentSize)
+	}
+	if contentType == "" {
+		contentType = detectClipboardContentType(content)
+	}
+	hash := clipboardHash(content)
+
+	entry, err := gorm.G[ClipboardEntry](db).Where("hash = ?", hash).Take(ctx)
+	if err == nil {
+		entry.UpdatedAt = time.Now().UnixMilli()
+		if _, err := gorm.G[ClipboardEntry](db).Where("id = ?", entry.ID).Update(ctx, "updated_at", entry.UpdatedAt); err != nil {
+			return entry, err
+		}
+		return entry, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return entry, err
+	}
+
+	entry = ClipboardEntry{
+		Content:     content,
+		ContentType: contentType,
+		Source:      source,
+		Hash:        hash,
+	}
+	if err := gorm.G[ClipboardEntry](db).Create(ctx, &entry); err != nil {
+		return entry, err
+	}
+	return entry, trimClipboardHistory(ctx)
+}
+
+// trimClipboardHistory deletes the oldest unpinned entries exceeding the history limit.
+func trimClipboardHistory(ctx context.Context) error {
+	limit, err := strconv.Atoi(getSetting(ctx, SettingKeyClipboardHistoryLimit, ""))
+	if err != nil || limit <= 0 {
+		limit = defaultClipboardHistoryLimit
+	}
+	_, err = gorm.G[ClipboardEntry](db).
+		Where("pinned = ? AND id NOT IN (SELECT id FROM clipboard_entries WHERE pinned = ? ORDER BY updated_at DESC, id DESC LIMIT ?)", false, false, limit).
+		Delete(ctx)
+	return err
+}
+
+// searchClipboardEntries lists entries matching query by full-text search, pinned and recent entries first.
+func searchClipboardEntries(ctx context.Context, query string, pinnedOnly bool, offset int, limit int) ([]ClipboardEntry, int64, error) {
+	q := gorm.G[ClipboardEntry](db).Order("pinned DESC, updated_at DESC, id DESC")
+	if query = strings.TrimSpace(query); query != "" {
+		q = q.Where("id IN (SELECT rowid FROM clipboard_entries_fts WHERE clipboard_entries_fts MATCH ?)", ftsMatchQuery("clipboard_entries_fts", query))
+	}
+	if pinnedOnly {
+		q = q.Where("pinned = ?", true)
+	}
+	total, err := q.Count(ctx, "*")
+	if err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	list, err := q.Offset(offset).Limit(limit).Find(ctx)
+	return list, total, err
+}
+
+// pipeClipboardEntry runs a tool with the content of an entry and stores the tool's output as a new entry.
+// The content is passed as the parameter named param, or as stdin of the tool when param is empty.
+// parameters defaults to the tool's default parameters.
+func pipeClipboardEntry(ctx context.Context, id int, toolName string, param string, parameters string) (ClipboardEntry, error) {
+	entry, err := gorm.G[ClipboardEntry](db).Where("id = ?", id).Take(ctx)
+	if err != nil {
+		return ClipboardEntry{}, fmt.Errorf("failed to get clipboard entry: %w", err)
+	}
+	if parameters == "" {
+		tool, err := gorm.G[Tool](db).Where("name = ?", toolName).Take(ctx)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ClipboardEntry{}, fmt.Errorf("%w: %s", errToolNotFound, toolName)
+			}
+			return ClipboardEntry{}, err
+		}
+		parameters = tool.DefaultParams
+	}
+
+	call := toolCall{Name: toolName, Parameters: parameters}
+	if param == "" {
+		call.Stdin = &entry.Content
+	} else {
+		params := map[string]any{}
+		if parameters != "" {
+			if err := json.Unmarshal([]byte(parameters), &params); err != nil {
+				return ClipboardEntry{}, fmt.Errorf("invalid parameters: %w", err)
+			}
+		}
+		params[param] = entry.Content
+		bs, err := json.Marshal(params)
+		if err != nil {
+			return ClipboardEntry{}, err
+		}
+		call.Parameters = string(bs)
+	}
+
+	out, err := executeToolCall(ctx, call)
+	if err != nil {
+		return ClipboardEntry{}, err
+	}
+	return addClipboardEntry(ctx, string(out), "", "tool:"+toolName)
+}
+
+// watchClipboard records the text of the system clipboard whenever it changes, until ctx is done.
+// It only works when ctx is the Wails application context.
+func watchClipboard(ctx context.Context) {
+	ticker := time.NewTicker(clipboardPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if getSetting(ctx, SettingKeyClipboardCapture, "true") == "false" {
+			continue
+		}
+		text, err := runtime.ClipboardGetText(ctx)
+		if err != nil || text == "" {
+			continue
+		}
+		clipboardLastTextMu.Lock()
+		changed := text != clipboardLastText
+		clipboardLastText = text
+		clipboardLastTextMu.Unlock()
+		if !changed {
+			continue
+		}
+		if _, err := addClipboardEntry(ctx, text, "", "clipboard"); err != nil {
+			runtime.LogWarningf(ctx, "failed to record clipboard: %v", err)
+		}
+	}
+}
+
+// #region Clipboard HTTP
+
+// BodyPushClipboard represents the request body for pushing an entry to the clipboard history
+type BodyPushClipboard struct {
+	Content     string `json:"content"`
+	ContentType string `json:"contentType"`
+	Source      string `json:"source"`
+}
+
+// BodyPipeClipboard represents the request body for piping a clipboard entry into a tool
+type BodyPipeClipboard struct {
+	ID         int    `json:"id"`
+	Tool       string `json:"tool"`
+	Param      string `json:"param"`      // parameter receiving the content, stdin is used when empty
+	Parameters string `json:"parameters"` // defaults to the tool's default parameters
+}
+
+func listClipboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	query := r.URL.Query()
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	var resp RespGetClipboardList
+	var err error
+	resp.List, resp.Total, err = searchClipboardEntries(ctx, query.Get("q"), query.Get("pinned") == "true", offset, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list clipboard: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func pushClipboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	var body BodyPushClipboard
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxClipboardContentSize+4096)).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.Source == "" {
+		body.Source = "http"
+	}
+	entry, err := addClipboardEntry(ctx, body.Content, body.ContentType, body.Source)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to push clipboard entry: %v", err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RespClipboardEntry{Item: entry})
+}
+
+func pipeClipboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	var body BodyPipeClipboard
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !requestAllowsTool(r, body.Tool) {
+		http.Error(w, fmt.Sprintf("Forbidden: token may not call tool %s", body.Tool), http.StatusForbidden)
+		return
+	}
+	entry, err := pipeClipboardEntry(ctx, body.ID, body.Tool, body.Param, body.Parameters)
+	if err != nil {
+		if errors.Is(err, errToolNotFound) {
+			http.Error(w, fmt.Sprintf("Tool not found: %s", body.Tool), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RespClipboardEntry{Item: entry})
+}
+
+// #endregion
+
+// #region Clipboard Bindings
+
+type RespGetClipboardList struct {
+	Error string           `json:"error"`
+	List  []ClipboardEntry `json:"list"`
+	Total int64            `json:"total"`
+}
+
+// GetClipboardList lists the clipboard history, query is matched by full-text search when not empty.
+func (m *Model) GetClipboardList(query string, pinnedOnly bool, offset int, limit int) (resp RespGetClipboardList) {
+	var err error
+	resp.List, resp.Total, err = searchClipboardEntries(m.ctx, query, pinnedOnly, offset, limit)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to list clipboard entries: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespPinClipboardEntry struct {
+	Error string `json:"error"`
+}
+
+func (m *Model) PinClipboardEntry(id int, pinned bool) (resp RespPinClipboardEntry) {
+	_, err := gorm.G[ClipboardEntry](db).Where("id = ?", id).Update(m.ctx, "pinned", pinned)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to pin clipboard entry: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespDeleteClipboardEntry struct {
+	Error string `json:"error"`
+}
+
+func (m *Model) DeleteClipboardEntry(id int) (resp RespDeleteClipboardEntry) {
+	_, err := gorm.G[ClipboardEntry](db).Where("id = ?", id).Delete(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to delete clipboard entry: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespCopyClipboardEntry struct {
+	Error string `json:"error"`
+}
+
+// CopyClipboardEntry writes the content of an entry to the system clipboard.
+func (m *Model) CopyClipboardEntry(id int) (resp RespCopyClipboardEntry) {
+	entry, err := gorm.G[ClipboardEntry](db).Where("id = ?", id).Take(m.ctx)
+	if err == nil {
+		clipboardLastTextMu.Lock()
+		clipboardLastText = entry.Content
+		clipboardLastTextMu.Unlock()
+		err = runtime.ClipboardSetText(m.ctx, entry.Content)
+	}
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to copy clipboard entry: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespClipboardEntry struct {
+	Error string         `json:"error"`
+	Item  ClipboardEntry `json:"item"`
+}
+
+// PipeClipboardEntry runs a tool with the content of an entry as stdin, or as the parameter named param,
+// and stores the tool's output as a new entry.
+func (m *Model) PipeClipboardEntry(id int, toolName string, param string, parameters string) (resp RespClipboardEntry) {
+	var err error
+	resp.Item, err = pipeClipboardEntry(m.ctx, id, toolName, param, parameters)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to pipe clipboard entry: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// #endregion
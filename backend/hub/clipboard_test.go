@@ -0,0 +1,73 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClipboardEntries(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+
+	first, err := addClipboardEntry(ctx, "hello world", "", "http")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", first.ContentType)
+
+	second, err := addClipboardEntry(ctx, `{"greeting": "hello"}`, "", "http")
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", second.ContentType)
+
+	time.Sleep(2 * time.Millisecond)
+	again, err := addClipboardEntry(ctx, "hello world", "", "clipboard")
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID, again.ID, "duplicated content should reuse the entry")
+
+	_, err = addClipboardEntry(ctx, "", "", "http")
+	assert.Error(t, err)
+
+	list, total, err := searchClipboardEntries(ctx, "", false, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, first.ID, list[0].ID, "most recently used entry should be first")
+
+	list, total, err = searchClipboardEntries(ctx, "greet", false, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, second.ID, list[0].ID)
+
+	assert.Empty(t, model.PinClipboardEntry(second.ID, true).Error)
+	list, _, err = searchClipboardEntries(ctx, "", true, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.True(t, list[0].Pinned)
+
+	assert.Empty(t, model.DeleteClipboardEntry(second.ID).Error)
+	_, total, err = searchClipboardEntries(ctx, "greet", false, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+}
+
+func TestClipboardHistoryLimit(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	assert.Empty(t, model.SaveSetting(string(SettingKeyClipboardHistoryLimit), "3").Error)
+
+	pinned, err := addClipboardEntry(ctx, "pinned", "", "http")
+	assert.NoError(t, err)
+	assert.Empty(t, model.PinClipboardEntry(pinned.ID, true).Error)
+	for i := 0; i < 5; i++ {
+		_, err := addClipboardEntry(ctx, fmt.Sprintf("entry %d", i), "", "http")
+		assert.NoError(t, err)
+	}
+
+	list, total, err := searchClipboardEntries(ctx, "", false, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Equal(t, "pinned", list[0].Content)
+	assert.Equal(t, "entry 4", list[1].Content)
+	assert.Equal(t, "entry 2", list[3].Content)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Environment inheritance modes of EnvPolicy.
+const (
+	EnvInheritAll       = "all"       // inherit the whole environment of the hub
+	EnvInheritAllowlist = "allowlist" // inherit the variables matching EnvPolicy.Allow
+	EnvInheritNone      = "clean"     // start from an empty environment
+)
+
+// DefaultEnvAllowlist is inherited in allowlist mode when EnvPolicy.Allow is empty.
+var DefaultEnvAllowlist = []string{"HOME", "USER", "LOGNAME", "LANG", "LC_*", "TZ", "TMPDIR", "TERM", "SHELL"}
+
+// EnvPolicy controls which variables of the hub's environment a command inherits.
+// Whatever the mode, PATH is inherited unless Env sets it so that commands can still be found, and the
+// variables of Env are added last.
+type EnvPolicy struct {
+	Mode  string   // one of EnvInheritAll (default when empty), EnvInheritAllowlist, EnvInheritNone
+	Allow []string // names of inherited variables in allowlist mode, a trailing "*" matches a prefix
+}
+
+// ParseEnvPolicy builds a policy from a mode and a comma separated allowlist.
+func ParseEnvPolicy(mode string, allow string) (EnvPolicy, error) {
+	policy := EnvPolicy{Mode: strings.TrimSpace(mode)}
+	switch policy.Mode {
+	case "", EnvInheritAll, EnvInheritAllowlist, EnvInheritNone:
+	default:
+		return policy, fmt.Errorf("unknown env policy %q", mode)
+	}
+	for _, name := range strings.Split(allow, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			policy.Allow = append(policy.Allow, name)
+		}
+	}
+	return policy, nil
+}
+
+func (p EnvPolicy) inheritsAll() bool {
+	return p.Mode == "" || p.Mode == EnvInheritAll
+}
+
+// allows reports whether the variable name is inherited.
+func (p EnvPolicy) allows(name string) bool {
+	switch {
+	case p.inheritsAll():
+		return true
+	case p.Mode == EnvInheritNone:
+		return false
+	}
+	allow := p.Allow
+	if len(allow) == 0 {
+		allow = DefaultEnvAllowlist
+	}
+	for _, pattern := range allow {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if hasEnvPrefix(name, prefix) {
+				return true
+			}
+		} else if envNameEqual(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// key identifies the policy in StreamOptions.Key.
+func (p EnvPolicy) key() string {
+	if p.inheritsAll() {
+		return EnvInheritAll
+	}
+	if p.Mode == EnvInheritAllowlist {
+		return p.Mode + ":" + strings.Join(p.Allow, "|")
+	}
+	return p.Mode
+}
+
+// buildEnv returns the environment of a command, nil means inheriting the hub's environment unchanged.
+func buildEnv(policy EnvPolicy, env map[string]string) []string {
+	if policy.inheritsAll() && env == nil {
+		return nil
+	}
+	result := make([]string, 0, len(env)+16)
+	_, hasPath := env["PATH"]
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if policy.allows(name) || (!hasPath && envNameEqual(name, "PATH")) {
+			result = append(result, kv)
+		}
+	}
+	for k, v := range env {
+		result = append(result, fmt.Sprintf("%s=%s", k, v))
+	}
+	return result
+}
+
+// environment variable names are case insensitive on windows
+func envNameEqual(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+func hasEnvPrefix(name, prefix string) bool {
+	if runtime.GOOS == "windows" {
+		return len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix)
+	}
+	return strings.HasPrefix(name, prefix)
+}
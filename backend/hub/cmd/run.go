@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
 	"sort"
 	"strings"
@@ -13,10 +12,11 @@ import (
 
 // Options holds options for running a command.
 type Options struct {
-	Cwd     string
-	Env     map[string]string
-	Stdin   io.Reader
-	Timeout time.Duration
+	Cwd       string
+	Env       map[string]string
+	EnvPolicy EnvPolicy // which variables of the hub's environment are inherited
+	Stdin     io.Reader
+	Timeout   time.Duration
 }
 
 // Result holds the result of a command execution.
@@ -38,14 +38,7 @@ func Run(ctx context.Context, options Options, command ...string) (Result, error
 	}
 	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
 	cmd.Dir = options.Cwd
-
-	if options.Env != nil {
-		env := os.Environ()
-		for k, v := range options.Env {
-			env = append(env, fmt.Sprintf("%s=%s", k, v))
-		}
-		cmd.Env = env
-	}
+	cmd.Env = buildEnv(options.EnvPolicy, options.Env)
 
 	if options.Stdin != nil {
 		cmd.Stdin = options.Stdin
@@ -71,10 +64,11 @@ func Run(ctx context.Context, options Options, command ...string) (Result, error
 // StreamOptions holds options for streaming command execution.
 // Stdin is exposed in StreamResult
 type StreamOptions struct {
-	Cwd     string
-	Env     map[string]string
-	Shell   string
-	Timeout time.Duration
+	Cwd       string
+	Env       map[string]string
+	EnvPolicy EnvPolicy // which variables of the hub's environment are inherited
+	Shell     string
+	Timeout   time.Duration
 }
 
 // Key generates a unique key for the StreamOptions, useful for identification.
@@ -92,7 +86,7 @@ func (o *StreamOptions) Key() string {
 		}
 		env = strings.Join(parts, ";")
 	}
-	return fmt.Sprintf("cwd=%s,shell=%s,env=%v", o.Cwd, o.Shell, env)
+	return fmt.Sprintf("cwd=%s,shell=%s,env=%v,envPolicy=%s", o.Cwd, o.Shell, env, o.EnvPolicy.key())
 }
 
 // StreamResult holds the output streams of a command execution.
@@ -129,14 +123,7 @@ func RunStream(ctx context.Context, options StreamOptions, command ...string) (r
 		cmd = exec.CommandContext(ctx, command[0], command[1:]...)
 	}
 	cmd.Dir = options.Cwd
-
-	if options.Env != nil {
-		env := os.Environ()
-		for k, v := range options.Env {
-			env = append(env, fmt.Sprintf("%s=%s", k, v))
-		}
-		cmd.Env = env
-	}
+	cmd.Env = buildEnv(options.EnvPolicy, options.Env)
 
 	pr, pw := io.Pipe()
 	cmd.Stdin = pr
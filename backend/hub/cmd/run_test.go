@@ -70,3 +70,54 @@ func TestStream_timeout(t *testing.T) {
 	err = stream.Wait()
 	assert.ErrorIs(t, err, context.DeadlineExceeded)
 }
+
+func TestRun_envPolicy(t *testing.T) {
+	t.Setenv("TOOL_HUB_TEST_SECRET", "leaked")
+	t.Setenv("TOOL_HUB_TEST_KEEP", "kept")
+	run := func(policy EnvPolicy) string {
+		res, err := Run(context.Background(), Options{EnvPolicy: policy, Env: map[string]string{"EXTRA": "1"}}, "env")
+		assert.NoError(t, err)
+		return string(res.Stdout)
+	}
+
+	out := run(EnvPolicy{})
+	assert.Contains(t, out, "TOOL_HUB_TEST_SECRET=leaked")
+	assert.Contains(t, out, "EXTRA=1")
+
+	out = run(EnvPolicy{Mode: EnvInheritAllowlist, Allow: []string{"TOOL_HUB_TEST_K*"}})
+	assert.Contains(t, out, "TOOL_HUB_TEST_KEEP=kept")
+	assert.NotContains(t, out, "TOOL_HUB_TEST_SECRET")
+	assert.Contains(t, out, "PATH=", "PATH should be inherited whatever the policy")
+
+	out = run(EnvPolicy{Mode: EnvInheritNone})
+	assert.NotContains(t, out, "TOOL_HUB_TEST_")
+	assert.Contains(t, out, "EXTRA=1")
+	assert.Contains(t, out, "PATH=")
+}
+
+func TestStream_envPolicy(t *testing.T) {
+	t.Setenv("TOOL_HUB_TEST_SECRET", "leaked")
+	stream, err := RunStream(context.Background(), StreamOptions{EnvPolicy: EnvPolicy{Mode: EnvInheritNone}, Env: map[string]string{"PATH": "/usr/bin:/bin"}}, "env")
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&out, stream.Stdout)
+		close(done)
+	}()
+	stream.Stdin.Close()
+	<-done
+	assert.NoError(t, stream.Wait())
+	assert.NotContains(t, out.String(), "TOOL_HUB_TEST_SECRET")
+	assert.Contains(t, out.String(), "PATH=/usr/bin:/bin\n")
+}
+
+func TestStreamOptions_Key_envPolicy(t *testing.T) {
+	all := StreamOptions{Cwd: "/tmp"}
+	clean := StreamOptions{Cwd: "/tmp", EnvPolicy: EnvPolicy{Mode: EnvInheritNone}}
+	allowA := StreamOptions{Cwd: "/tmp", EnvPolicy: EnvPolicy{Mode: EnvInheritAllowlist, Allow: []string{"A"}}}
+	allowB := StreamOptions{Cwd: "/tmp", EnvPolicy: EnvPolicy{Mode: EnvInheritAllowlist, Allow: []string{"B"}}}
+	assert.Equal(t, all.Key(), (&StreamOptions{Cwd: "/tmp", EnvPolicy: EnvPolicy{Mode: EnvInheritAll}}).Key())
+	assert.NotEqual(t, all.Key(), clean.Key())
+	assert.NotEqual(t, allowA.Key(), allowB.Key())
+}
@@ -22,6 +22,46 @@ type runner struct {
 	worker      *StreamResult
 	queue       chan inputTask
 	idleTimeout time.Duration
+	exit        *workerExit // exit of the current worker
+}
+
+// workerExit records the exit of a worker process.
+type workerExit struct {
+	done chan struct{} // closed once the worker exited, err is then set
+	err  error
+}
+
+func (e *workerExit) exited() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrWorkerExited reports that the worker process went away before answering. The error of its exit is
+// wrapped as well when known, e.g. *exec.ExitError or context.DeadlineExceeded for a timeout.
+var ErrWorkerExited = errors.New("worker exited")
+
+// workerExitWait is how long a failed read waits for the worker to exit, to report why it did.
+const workerExitWait = time.Second
+
+func exitError(waitErr error, readErr error) error {
+	if waitErr != nil {
+		return fmt.Errorf("%w: %w", ErrWorkerExited, waitErr)
+	}
+	return fmt.Errorf("%w: %w", ErrWorkerExited, readErr)
+}
+
+// exitError waits shortly for the worker the output couldn't be read from to exit, and describes why it did.
+func (r *runner) exitError(readErr error) error {
+	select {
+	case <-r.exit.done:
+		return exitError(r.exit.err, readErr)
+	case <-time.After(workerExitWait):
+		return exitError(nil, readErr)
+	}
 }
 
 type result struct {
@@ -102,16 +142,21 @@ func (m *manager) stopRunner(key string) {
 }
 
 func (r *runner) getWorker(ctx context.Context, task inputTask) (*StreamResult, error) {
+	if r.worker != nil && r.exit.exited() {
+		r.worker = nil
+	}
 	if r.worker == nil {
 		worker, err := runStream(ctx, task.Options, task.Command...)
 		if err != nil {
 			return nil, err
 		}
 		r.worker = &worker
+		exit := &workerExit{done: make(chan struct{})}
+		r.exit = exit
 		go func() {
-			err = r.worker.Wait()
+			exit.err = worker.Wait()
 			// log.Error().Err(err).Msg("Worker exited")
-			r.worker = nil
+			close(exit.done)
 		}()
 	}
 	return r.worker, nil
@@ -145,12 +190,12 @@ func (r *runner) loop(ctx context.Context) error {
 				}
 				err = writeChunk(worker.Stdin, data)
 				if err != nil {
-					task.result <- result{nil, fmt.Errorf("Failed to write to stdin: %w", err)}
+					task.result <- result{nil, fmt.Errorf("Failed to write to stdin: %w", r.exitError(err))}
 					continue
 				}
 				out, err := readChunk(worker.Stdout)
 				if err != nil {
-					task.result <- result{nil, fmt.Errorf("Failed to read from stdout: %w", err)}
+					task.result <- result{nil, fmt.Errorf("Failed to read from stdout: %w", r.exitError(err))}
 					continue
 				}
 				task.result <- result{out, nil}
@@ -217,3 +262,36 @@ func closePendingTasks(queue chan inputTask) {
 		}
 	}
 }
+
+// RunOnce executes the given Input with a process of its own which exits afterwards,
+// for options which are specific to a call such as a temporary working directory.
+func RunOnce(ctx context.Context, input Input) ([]byte, error) {
+	worker, err := runStream(ctx, input.Options, input.Command...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to start worker: %w", err)
+	}
+	waited := false
+	defer func() {
+		if !waited {
+			worker.Stdin.Close()
+			worker.Wait()
+		}
+	}()
+	data, err := io.ReadAll(input.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read input: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("No input data")
+	}
+	if err := writeChunk(worker.Stdin, data); err != nil {
+		return nil, fmt.Errorf("Failed to write to stdin: %w", err)
+	}
+	out, err := readChunk(worker.Stdout)
+	if err != nil {
+		worker.Stdin.Close()
+		waited = true
+		return nil, fmt.Errorf("Failed to read from stdout: %w", exitError(worker.Wait(), err))
+	}
+	return out, nil
+}
@@ -121,3 +121,74 @@ func TestSharedRunnerConcurrent(t *testing.T) {
 		assert.NoError(t, e, "Concurrent Run failed")
 	}
 }
+
+func TestRunOnce(t *testing.T) {
+	old := runStream
+	defer func() { runStream = old }()
+
+	var started, waited int
+	runStream = func(ctx context.Context, options StreamOptions, command ...string) (StreamResult, error) {
+		started++
+		assert.Equal(t, "/tmp/ws", options.Cwd)
+		prOut, pwOut := io.Pipe()
+		prIn, pwIn := io.Pipe()
+		go func() {
+			defer pwOut.Close()
+			data, err := readChunk(prIn)
+			if err != nil {
+				return
+			}
+			writeChunk(pwOut, bytes.ToUpper(data))
+		}()
+		return StreamResult{
+			Stdin:    pwIn,
+			Stdout:   prOut,
+			Stderr:   io.NopCloser(bytes.NewReader(nil)),
+			waitFunc: func() error { waited++; return nil },
+		}, nil
+	}
+
+	input := Input{Options: StreamOptions{Cwd: "/tmp/ws"}, Command: []string{"fake"}}
+	for i := 0; i < 2; i++ {
+		input.Reader = bytes.NewBufferString("hello")
+		out, err := RunOnce(context.Background(), input)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("HELLO"), out)
+	}
+	assert.Equal(t, 2, started, "every call should start its own process")
+	assert.Equal(t, 2, waited, "the process should be waited for")
+}
+
+func TestWorkerExitError(t *testing.T) {
+	SharedRunner = manager{cmds: make(map[string]*runner)}
+	old := runStream
+	defer func() { runStream = old }()
+
+	// the worker reads the input and exits without answering
+	runStream = func(ctx context.Context, options StreamOptions, command ...string) (StreamResult, error) {
+		prOut, pwOut := io.Pipe()
+		prIn, pwIn := io.Pipe()
+		exited := make(chan struct{})
+		go func() {
+			defer close(exited)
+			defer pwOut.Close()
+			readChunk(prIn)
+		}()
+		return StreamResult{
+			Stdin:    pwIn,
+			Stdout:   prOut,
+			Stderr:   io.NopCloser(bytes.NewReader(nil)),
+			waitFunc: func() error { <-exited; return context.DeadlineExceeded },
+		}, nil
+	}
+
+	input := Input{Reader: bytes.NewBufferString("hello"), Options: StreamOptions{Cwd: "/tmp/exit"}, Command: []string{"fake"}}
+	_, err := SharedRunner.Run(input)
+	assert.ErrorIs(t, err, ErrWorkerExited)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the error of the exit should be reported")
+
+	input.Reader = bytes.NewBufferString("hello")
+	_, err = RunOnce(context.Background(), input)
+	assert.ErrorIs(t, err, ErrWorkerExited)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
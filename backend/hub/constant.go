@@ -3,5 +3,18 @@ package hub
 type StringValues string
 
 const (
-	SettingKeyToolDir StringValues = "ToolsDir"
+	SettingKeyToolDir               StringValues = "ToolsDir"
+	SettingKeyClipboardCapture      StringValues = "ClipboardCapture"      // "false" disables capturing the system clipboard
+	SettingKeyClipboardHistoryLimit StringValues = "ClipboardHistoryLimit" // max number of unpinned clipboard entries
+	SettingKeyListeners             StringValues = "Listeners"             // JSON array of ListenerConfig
+	SettingKeyAllowedOrigins        StringValues = "AllowedOrigins"        // comma separated origins allowed to make cross-origin requests
+	SettingKeyAllowedHosts          StringValues = "AllowedHosts"          // comma separated host names accepted in the Host header besides localhost
+	SettingKeyActiveProfile         StringValues = "ActiveProfile"         // name of the Profile applied to calls which don't choose one
+	SettingKeyEnvPolicy             StringValues = "EnvPolicy"             // default environment inheritance of tools: "all", "allowlist" or "clean"
+	SettingKeyEnvAllowlist          StringValues = "EnvAllowlist"          // comma separated variables inherited in allowlist mode
+	SettingKeyArtifactRetention     StringValues = "ArtifactRetention"     // how long artifacts of tool calls are kept, e.g. "168h"
+	SettingKeyResultCacheSize       StringValues = "ResultCacheSize"       // bytes of cached tool results kept, the least recently used are evicted
+	SettingKeyEvalCache             StringValues = "EvalCache"             // "false" disables caching evaluated plugins
+	SettingKeyEvalConcurrency       StringValues = "EvalConcurrency"       // number of plugins evaluated at once by the pool of workers
+	SettingKeyEvalTimeout           StringValues = "EvalTimeout"           // how long the evaluation of a plugin may take, e.g. "30s"
 )
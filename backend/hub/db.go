@@ -15,7 +15,7 @@ import (
 
 var db *gorm.DB
 
-var models = []any{&Setting{}, &ToolTestcase{}}
+var models = []any{&Tool{}, &Setting{}, &ToolTestcase{}, &Prompt{}, &PromptVersion{}, &ClipboardEntry{}, &APIToken{}, &Secret{}, &Profile{}, &Artifact{}, &PipelineStepResult{}, &Schedule{}, &Trigger{}, &CallAttempt{}, &CachedResult{}}
 
 // InitDB initializes the database connection and performs auto migration for all models.
 func InitDB(ctx context.Context, isProduction bool) {
@@ -31,8 +31,8 @@ func InitDB(ctx context.Context, isProduction bool) {
 
 	// Get database file path - use user's home directory for .app bundles
 	dbPath := "hub.db"
-	if homeDir, err := os.UserHomeDir(); err == nil {
-		dbPath = filepath.Join(homeDir, ".tool-hub", "hub.db")
+	if dir := hubDataDir(); dir != "" {
+		dbPath = filepath.Join(dir, "hub.db")
 		// Create directory if it doesn't exist
 		if mkdirErr := os.MkdirAll(filepath.Dir(dbPath), 0o755); mkdirErr != nil {
 			runtime.LogErrorf(ctx, "failed to create database directory: %v", mkdirErr)
@@ -56,6 +56,10 @@ func InitDB(ctx context.Context, isProduction bool) {
 	if err != nil {
 		runtime.LogFatalf(ctx, "failed to autoMigrate %v", err)
 	}
+	err = migrateFTS(db)
+	if err != nil {
+		runtime.LogFatalf(ctx, "failed to migrate full-text indexes %v", err)
+	}
 	var v string
 	result := db.Raw("SELECT sqlite_version()").Scan(&v)
 	if result.Error != nil {
@@ -66,6 +70,14 @@ func InitDB(ctx context.Context, isProduction bool) {
 	setModelContext(ctx)
 }
 
+// hubDataDir returns the directory holding the database and other files of the hub, "" when home is unknown.
+func hubDataDir() string {
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(homeDir, ".tool-hub")
+	}
+	return ""
+}
+
 type dbLoggerForTest struct{}
 
 var dbLoggerForTestInstance = dbLoggerForTest{}
@@ -0,0 +1,31 @@
+package hub
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupTestDB replaces the package db with an in-memory database for the duration of a test.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	testDB, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: dbLoggerForTestInstance})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := testDB.AutoMigrate(models...); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	if err := migrateFTS(testDB); err != nil {
+		t.Fatalf("failed to migrate full-text indexes: %v", err)
+	}
+	old := db
+	db = testDB
+	t.Cleanup(func() {
+		db = old
+		if sqlDB, err := testDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package hub
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Evaluating a plugin is a round trip to the WebWorkers of the frontend, while plugins
+// are pure functions of their code and parameters. evalCache keeps the latest results of EvalTool in memory,
+// it is cleared whenever the tool catalog changes and bypassed when the EvalCache setting is "false".
+
+const maxEvalCacheEntries = 1024
+
+// EvalCacheStats reports the use of the cache of evaluated plugins since the hub started.
+type EvalCacheStats struct {
+	Entries   int   `json:"entries"`
+	Capacity  int   `json:"capacity"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+type evalCacheEntry struct {
+	key  string
+	tool json.RawMessage
+}
+
+// evalCache is a LRU cache of evaluated plugins.
+type evalCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // most recently used first
+	stats    EvalCacheStats
+}
+
+var hubEvalCache = newEvalCache(maxEvalCacheEntries)
+
+func newEvalCache(capacity int) *evalCache {
+	return &evalCache{capacity: capacity, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// evalCacheKey hashes the code of a plugin and its canonicalized parameters.
+func evalCacheKey(code string, parameters string) string {
+	if canonical, err := canonicalJSON(parameters); err == nil {
+		parameters = canonical
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%s;%s", len(code), code, parameters)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *evalCache) get(key string) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(e)
+	return e.Value.(*evalCacheEntry).tool, true
+}
+
+func (c *evalCache) put(key string, tool json.RawMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*evalCacheEntry).tool = tool
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&evalCacheEntry{key: key, tool: tool})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*evalCacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// clear removes every entry, the stats are kept.
+func (c *evalCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]*list.Element{}
+	c.order.Init()
+}
+
+func (c *evalCache) snapshot() EvalCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	stats.Capacity = c.capacity
+	return stats
+}
+
+// #region EvalCache Bindings
+
+type RespGetEvalCacheStats struct {
+	Error string         `json:"error"`
+	Stats EvalCacheStats `json:"stats"`
+}
+
+func (m *Model) GetEvalCacheStats() (resp RespGetEvalCacheStats) {
+	resp.Stats = hubEvalCache.snapshot()
+	return
+}
+
+type RespClearEvalCache struct {
+	Error string `json:"error"`
+}
+
+func (m *Model) ClearEvalCache() (resp RespClearEvalCache) {
+	hubEvalCache.clear()
+	return
+}
+
+// #endregion
@@ -0,0 +1,52 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalCache(t *testing.T) {
+	c := newEvalCache(2)
+	a := evalCacheKey("code", `{"x": 1, "y": 2}`)
+	assert.Equal(t, a, evalCacheKey("code", `{"y":2,"x":1}`), "parameters should be canonicalized")
+	assert.NotEqual(t, a, evalCacheKey("code v2", `{"x": 1, "y": 2}`))
+	b := evalCacheKey("code", `{"x": 2}`)
+
+	_, ok := c.get(a)
+	assert.False(t, ok)
+	c.put(a, json.RawMessage(`{"a": 1}`))
+	c.put(b, json.RawMessage(`{"b": 1}`))
+	tool, ok := c.get(a)
+	assert.True(t, ok)
+	assert.JSONEq(t, `{"a": 1}`, string(tool))
+	c.put("c", json.RawMessage(`{}`))
+	_, ok = c.get(b)
+	assert.False(t, ok, "the least recently used entry should be evicted")
+	assert.Equal(t, EvalCacheStats{Entries: 2, Capacity: 2, Hits: 1, Misses: 2, Evictions: 1}, c.snapshot())
+
+	c.clear()
+	_, ok = c.get(a)
+	assert.False(t, ok)
+}
+
+func TestEvalToolCached(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	defer hubEvalCache.clear()
+
+	code := fmt.Sprintf("export default () => %q", t.Name())
+	hubEvalCache.put(evalCacheKey(code, `{"q": 1}`), json.RawMessage(`{"name": "cached"}`))
+	tool, err := EvalTool(ctx, code, `{ "q": 1 }`)
+	assert.NoError(t, err, "a cached result shouldn't need the frontend")
+	assert.JSONEq(t, `{"name": "cached"}`, string(tool))
+
+	// saving a tool clears the cache
+	_, err = createTool(ctx, Tool{Name: "echo", Category: "commandLine"})
+	assert.NoError(t, err)
+	_, ok := hubEvalCache.get(evalCacheKey(code, `{"q": 1}`))
+	assert.False(t, ok)
+}
@@ -3,7 +3,9 @@ package hub
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -28,10 +30,24 @@ type EvalToolResponseEvent struct {
 	Error     string          `json:"error"`
 }
 
+// EvalToolCancelEvent tells the frontend to abandon an evaluation nobody waits for anymore.
+type EvalToolCancelEvent struct {
+	RequestID string `json:"requestId"`
+}
+
+const (
+	defaultEvalConcurrency = 4
+	maxEvalConcurrency     = 32
+	defaultEvalTimeout     = 30 * time.Second
+)
+
 var (
 	evalToolLimiter       = fifo.DefaultGroupLimiter
 	pendingEvalRequests   = make(map[string]chan EvalToolResponseEvent)
 	pendingEvalRequestsMu sync.RWMutex
+
+	// emitEvalEvent sends events to the frontend, tests replace it.
+	emitEvalEvent = runtime.EventsEmit
 )
 
 // InitToolEvalListener sets up the global event listener for tool evaluation responses
@@ -43,30 +59,64 @@ func InitToolEvalListener(ctx context.Context) {
 				// Convert map to struct
 				jsonBytes, _ := json.Marshal(responseMap)
 				json.Unmarshal(jsonBytes, &response)
-
-				// Find the corresponding pending request
-				pendingEvalRequestsMu.RLock()
-				responseChan, exists := pendingEvalRequests[response.RequestID]
-				pendingEvalRequestsMu.RUnlock()
-
-				if exists {
-					select {
-					case responseChan <- response:
-					default:
-					}
+				if !deliverEvalResponse(response) {
+					runtime.LogDebugf(ctx, "dropped the late response of evaluation %s", response.RequestID)
 				}
 			}
 		}
 	})
 }
 
-// EvalTool evaluates a tool plugin with the given code and parameters using the frontend WebWorker
+// deliverEvalResponse hands a response to the pending request with the same ID. It reports false when the
+// request is gone, e.g. it timed out.
+func deliverEvalResponse(response EvalToolResponseEvent) bool {
+	pendingEvalRequestsMu.RLock()
+	responseChan, exists := pendingEvalRequests[response.RequestID]
+	pendingEvalRequestsMu.RUnlock()
+	if !exists {
+		return false
+	}
+	select {
+	case responseChan <- response:
+	default:
+	}
+	return true
+}
+
+// evalLimits returns how many evaluations may run at once and how long one may take, see the
+// EvalConcurrency and EvalTimeout settings.
+func evalLimits(ctx context.Context) (uint, time.Duration) {
+	concurrency, err := strconv.Atoi(getSetting(ctx, SettingKeyEvalConcurrency, ""))
+	if err != nil || concurrency < 1 {
+		concurrency = defaultEvalConcurrency
+	}
+	timeout, err := time.ParseDuration(getSetting(ctx, SettingKeyEvalTimeout, ""))
+	if err != nil || timeout <= 0 {
+		timeout = defaultEvalTimeout
+	}
+	return uint(min(concurrency, maxEvalConcurrency)), timeout
+}
+
+// EvalTool evaluates a tool plugin with the given code and parameters using the frontend WebWorker,
+// unless the result is in the cache of evaluated plugins, see eval_cache.go.
+// Requests are told apart by their ID, so that several evaluations run at once on a pool of workers.
 func EvalTool(ctx context.Context, code string, parameters string) (json.RawMessage, error) {
-	// Acquire semaphore to prevent event confusion (only one eval at a time)
-	if err := evalToolLimiter.Acquire(ctx, "eval-tool", 1); err != nil {
-		return nil, fmt.Errorf("failed to acquire eval lock: %w", err)
+	cached := getSetting(ctx, SettingKeyEvalCache, "true") != "false"
+	key := evalCacheKey(code, parameters)
+	if cached {
+		if tool, ok := hubEvalCache.get(key); ok {
+			return tool, nil
+		}
 	}
 
+	// the group is named after the concurrency, so that a new setting applies to the next evaluations
+	concurrency, timeout := evalLimits(ctx)
+	group := fmt.Sprintf("eval-tool/%d", concurrency)
+	if err := evalToolLimiter.Acquire(ctx, group, concurrency); err != nil {
+		return nil, fmt.Errorf("failed to acquire eval slot: %w", err)
+	}
+	defer evalToolLimiter.Release(group)
+
 	// Generate unique request ID
 	requestID := uuid.New().String()
 
@@ -91,23 +141,31 @@ func EvalTool(ctx context.Context, code string, parameters string) (json.RawMess
 		Code:       code,
 		Parameters: parameters,
 	}
-	runtime.EventsEmit(ctx, "eval-tool-request", request)
+	emitEvalEvent(ctx, "eval-tool-request", request)
 
 	// Wait for response with timeout
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 	var response EvalToolResponseEvent
 	select {
 	case response = <-responseChan:
-		// Release the limiter immediately after receiving response
-		evalToolLimiter.Release("eval-tool")
-
-	case <-time.After(30 * time.Second):
-		evalToolLimiter.Release("eval-tool")
-		return nil, fmt.Errorf("tool evaluation timeout")
+	case <-timer.C:
+		emitEvalEvent(ctx, "eval-tool-cancel", EvalToolCancelEvent{RequestID: requestID})
+		return nil, fmt.Errorf("tool evaluation timeout after %s", timeout)
+	case <-ctx.Done():
+		emitEvalEvent(context.WithoutCancel(ctx), "eval-tool-cancel", EvalToolCancelEvent{RequestID: requestID})
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("tool evaluation timeout: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("tool evaluation canceled: %w", ctx.Err())
 	}
 
 	if !response.Success {
 		return nil, fmt.Errorf("tool evaluation failed: %s", response.Error)
 	}
 
+	if cached {
+		hubEvalCache.put(key, response.Tool)
+	}
 	return response.Tool, nil
 }
@@ -0,0 +1,91 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEvalFrontend replaces the frontend, answer decides the response to each request.
+func fakeEvalFrontend(t *testing.T, answer func(EvalToolRequestEvent)) *[]string {
+	var mu sync.Mutex
+	var canceled []string
+	emit := emitEvalEvent
+	emitEvalEvent = func(ctx context.Context, name string, data ...interface{}) {
+		switch event := data[0].(type) {
+		case EvalToolRequestEvent:
+			go answer(event)
+		case EvalToolCancelEvent:
+			mu.Lock()
+			canceled = append(canceled, event.RequestID)
+			mu.Unlock()
+		}
+	}
+	t.Cleanup(func() { emitEvalEvent = emit })
+	return &canceled
+}
+
+func TestEvalToolConcurrent(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalCache), "false").Error)
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalConcurrency), "3").Error)
+
+	var running, peak atomic.Int32
+	fakeEvalFrontend(t, func(r EvalToolRequestEvent) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+		tool, _ := json.Marshal(map[string]string{"parameters": r.Parameters})
+		deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Success: true, Tool: tool})
+	})
+
+	var wg sync.WaitGroup
+	for i := range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parameters := fmt.Sprintf(`{"i": %d}`, i)
+			tool, err := EvalTool(ctx, "code", parameters)
+			assert.NoError(t, err)
+			var out map[string]string
+			assert.NoError(t, json.Unmarshal(tool, &out))
+			assert.Equal(t, parameters, out["parameters"], "responses shouldn't be mixed up")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), peak.Load(), "evaluations should run concurrently up to EvalConcurrency")
+}
+
+func TestEvalToolTimeout(t *testing.T) {
+	setupTestDB(t)
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalCache), "false").Error)
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalTimeout), "50ms").Error)
+
+	late := make(chan EvalToolRequestEvent, 1)
+	canceled := fakeEvalFrontend(t, func(r EvalToolRequestEvent) { late <- r })
+
+	_, err := EvalTool(context.Background(), "code", `{}`)
+	assert.ErrorContains(t, err, "timeout after 50ms")
+	r := <-late
+	assert.Equal(t, []string{r.RequestID}, *canceled, "an abandoned request should be canceled")
+	assert.False(t, deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Success: true}),
+		"a late response should be dropped")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fakeEvalFrontend(t, func(EvalToolRequestEvent) { cancel() })
+	_, err = EvalTool(ctx, "code", `{}`)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,116 @@
+package hub
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ftsIndex describes a full-text index over some text columns of a table.
+// The index is a FTS virtual table named <Table>_fts whose rowid is the id of the indexed row,
+// it is kept in sync by triggers.
+type ftsIndex struct {
+	Table   string
+	Columns []string
+	// Exprs computes the text of some columns from the indexed row, "%[1]s" standing for the row.
+	// The other columns index the column of the table with the same name.
+	Exprs map[string]string
+}
+
+var ftsIndexes = []ftsIndex{
+	{Table: "clipboard_entries", Columns: []string{"content"}},
+	// ranked by toolRank, the order of the columns matters
+	{Table: "tools", Columns: []string{"name", "description", "params", "tags"}, Exprs: map[string]string{
+		"params": `(SELECT group_concat(key, ' ') FROM json_each(CASE WHEN json_valid(%[1]s.parameters) THEN %[1]s.parameters ELSE '{}' END, '$.properties'))`,
+	}},
+}
+
+// ftsModules maps the name of every FTS table to the module it was created with, "fts5" or "fts4".
+// FTS5 requires go-sqlite3 to be built with the sqlite_fts5 tag, FTS4 is always available.
+var ftsModules = map[string]string{}
+
+func (idx ftsIndex) name() string {
+	return idx.Table + "_fts"
+}
+
+// values returns the indexed values of row, e.g. "new".
+func (idx ftsIndex) values(row string) string {
+	values := make([]string, len(idx.Columns))
+	for i, col := range idx.Columns {
+		if expr, ok := idx.Exprs[col]; ok {
+			values[i] = fmt.Sprintf(expr, row)
+		} else {
+			values[i] = row + "." + col
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// migrateFTS creates the FTS tables and their triggers when missing.
+func migrateFTS(db *gorm.DB) error {
+	var fts5 bool
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5).Error; err != nil {
+		return err
+	}
+	for _, idx := range ftsIndexes {
+		name := idx.name()
+		var sql string
+		db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&sql)
+		module := "fts4"
+		if sql != "" {
+			if strings.Contains(strings.ToLower(sql), "fts5") {
+				module = "fts5"
+			}
+		} else {
+			if fts5 {
+				module = "fts5"
+			}
+			cols := strings.Join(idx.Columns, ", ")
+			newCols := idx.values("new")
+			// computed columns depend on other columns, so any update refreshes the index
+			updateOf := " OF " + cols
+			if len(idx.Exprs) > 0 {
+				updateOf = ""
+			}
+			stmts := []string{
+				fmt.Sprintf("CREATE VIRTUAL TABLE %s USING %s(%s)", name, module, cols),
+				fmt.Sprintf("INSERT INTO %s(rowid, %s) SELECT id, %s FROM %s", name, cols, idx.values(idx.Table), idx.Table),
+				fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ai AFTER INSERT ON %s BEGIN INSERT INTO %s(rowid, %s) VALUES (new.id, %s); END",
+					name, idx.Table, name, cols, newCols),
+				fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ad AFTER DELETE ON %s BEGIN DELETE FROM %s WHERE rowid = old.id; END",
+					name, idx.Table, name),
+				fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_au AFTER UPDATE%s ON %s BEGIN DELETE FROM %s WHERE rowid = old.id; INSERT INTO %s(rowid, %s) VALUES (new.id, %s); END",
+					name, updateOf, idx.Table, name, name, cols, newCols),
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				for _, stmt := range stmts {
+					if err := tx.Exec(stmt).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", name, err)
+			}
+		}
+		ftsModules[name] = module
+	}
+	return nil
+}
+
+// ftsMatchQuery turns user input into a query for the FTS table matching rows with all the terms as prefixes,
+// every term is quoted so that FTS syntax characters in the input are not interpreted.
+func ftsMatchQuery(table string, input string) string {
+	terms := strings.Fields(input)
+	for i, t := range terms {
+		t = strings.ReplaceAll(t, `"`, `""`)
+		if ftsModules[table] == "fts5" {
+			terms[i] = `"` + t + `"*`
+		} else {
+			terms[i] = `"` + t + `*"`
+		}
+	}
+	return strings.Join(terms, " ")
+}
@@ -3,65 +3,191 @@ package hub
 import (
 	"context"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
-// StartHub starts the HTTP server and initializes tool evaluation listener
+// route describes an endpoint of the hub API.
+type route struct {
+	Method  string // empty matches every method
+	Path    string
+	Scope   string // scope required from the API token, empty for public routes
+	Handler func(ctx context.Context, w http.ResponseWriter, r *http.Request)
+}
+
+// hubRoutes lists all endpoints of the hub API, every route but ping requires an API token, see auth.go.
+// Routes are described in the OpenAPI document by routeDocs, see openapi.go.
+var hubRoutes = []route{
+	{"", "/api/ping", "", func(_ context.Context, w http.ResponseWriter, r *http.Request) { pingHandler(w, r) }},
+	{http.MethodPost, "/api/registerTool", ScopeToolsRegister, registerTool},
+	{http.MethodPost, "/api/callTool", ScopeToolsCall, callTool},
+	{http.MethodGet, "/api/tools", ScopeToolsRead, listToolsHandler},
+	{http.MethodPost, "/api/tools", ScopeToolsRegister, createToolHandler},
+	{http.MethodGet, "/api/tools/{ref}", ScopeToolsRead, getToolHandler},
+	{http.MethodPatch, "/api/tools/{ref}", ScopeToolsRegister, updateToolHandler},
+	{http.MethodDelete, "/api/tools/{ref}", ScopeToolsRegister, deleteToolHandler},
+	{http.MethodPost, "/api/tools/{ref}/restore", ScopeToolsRegister, restoreToolHandler},
+	{http.MethodPost, "/api/tools/{ref}/evaluate", ScopeToolsRead, evaluateToolHandler},
+	{http.MethodPost, "/api/tools/{ref}/call", ScopeToolsCall, callToolByRef},
+	{http.MethodDelete, "/api/tools/{ref}/cache", ScopeToolsRegister, purgeToolCacheHandler},
+	{http.MethodPost, "/api/tools/{ref}/lifecycle", ScopeToolsRegister, setToolLifecycleHandler},
+	{http.MethodPost, "/api/tools/{ref}/preflight", ScopeToolsCall, preflightToolHandler},
+	{http.MethodPost, "/api/preflight", ScopeToolsCall, preflightToolsHandler},
+	{http.MethodGet, "/api/calls/{callId}/steps", ScopeToolsCall, listPipelineStepsHandler},
+	{http.MethodGet, "/api/artifacts", ScopeToolsCall, listArtifactsHandler},
+	{http.MethodGet, "/api/artifacts/{id}", ScopeToolsCall, downloadArtifact},
+	{http.MethodGet, "/api/bundle", ScopeToolsRead, exportBundle},
+	{http.MethodPost, "/api/bundle", ScopeToolsRegister, importBundle},
+	{http.MethodGet, "/api/clipboard", ScopeClipboardRead, listClipboard},
+	{http.MethodPost, "/api/clipboard", ScopeClipboardWrite, pushClipboard},
+	{http.MethodPost, "/api/clipboard/pipe", ScopeClipboardWrite, pipeClipboard},
+	// {"", "/ws/callStreamTool", ScopeToolsCall, callStreamTool},
+	// {"", "/terminal", ScopeAdmin, terminal},
+}
+
+// corsAllowHeaders are the request headers browsers from allowed origins may send.
+const corsAllowHeaders = "Content-Type, Authorization, X-Tool-Hub-Request"
+
+// hubHandler is the handler served on every listener.
+var hubHandler http.Handler
+
+// StartHub starts the HTTP servers on the configured listeners and initializes tool evaluation listener.
+// It returns once the listeners are started, failures are reported to the UI, see startListeners.
 func StartHub(ctx context.Context) {
 	// Initialize the global event listener for tool evaluation
 	InitToolEvalListener(ctx)
+	go watchClipboard(ctx)
+	hubTriggers.start(ctx)
+	if err := cleanupArtifacts(ctx); err != nil {
+		runtime.LogErrorf(ctx, "failed to clean up artifacts: %v", err)
+	}
 
-	http.HandleFunc("/api/ping", pingHandler)
-	http.HandleFunc("/api/registerTool", registerToolHandler(ctx))
-	http.HandleFunc("/api/callTool", callToolHandler(ctx))
-	// http.HandleFunc("/ws/callStreamTool", callStreamToolHandler)
-	// http.HandleFunc("/terminal", createTerminalHandler(ctx))
-
-	server := &http.Server{Addr: "0.0.0.0:9573"}
+	hubHandler = newHubHandler(ctx)
+	startListeners(ctx, hubHandler)
 	go func() {
 		<-ctx.Done()
-		server.Shutdown(context.Background())
+		stopListeners()
 	}()
-	log.Fatal(server.ListenAndServe())
 }
 
-func pingHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "pong")
+var frontendReadyOnce sync.Once
+
+// FrontendReady starts what evaluates plugins on its own, which has to wait for the frontend listening to
+// evaluation requests: the scheduler, whose catch-up runs are due at once, the preflight of every tool and
+// the sync of the tools directory, which lints the tools it stores.
+// It is called whenever the frontend is loaded, they are only started the first time.
+func FrontendReady(ctx context.Context) {
+	frontendReadyOnce.Do(func() {
+		go hubScheduler.loop(ctx)
+		startPreflight(ctx)
+		startToolsDirSync(ctx)
+	})
 }
 
-func registerToolHandler(ctx context.Context) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			w.WriteHeader(http.StatusNoContent)
-			return
+// newHubHandler builds the handler serving hubRoutes behind the browser protections of protectHandler.
+func newHubHandler(ctx context.Context) http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range hubRoutes {
+		handler := rt.Handler
+		next := func(w http.ResponseWriter, r *http.Request) {
+			handler(ctx, w, r)
 		}
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
+		if rt.Scope != "" {
+			next = requireScope(rt.Scope, next)
 		}
-		registerTool(ctx, w, r)
+		pattern := rt.Path
+		if rt.Method != "" {
+			pattern = rt.Method + " " + rt.Path
+		}
+		mux.HandleFunc(pattern, next)
 	}
+	return protectHandler(ctx, mux)
 }
 
-func callToolHandler(ctx context.Context) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// protectHandler guards next against requests made by web pages the user visits:
+//   - the Host header must be an IP, localhost or one of the AllowedHosts setting, which defeats DNS rebinding
+//   - cross-origin requests are only served to origins in the AllowedOrigins setting, preflight included
+//   - state-changing requests sent by browsers must carry a non-simple header, Authorization or
+//     X-Tool-Hub-Request, so they can't be issued by a plain form or a no-cors fetch
+//
+// Requests coming through unix sockets can't be made by browsers and are only subject to authentication.
+func protectHandler(ctx context.Context, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if network, _ := r.Context().Value(listenerNetworkContextKey{}).(string); network == "unix" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !isAllowedHost(ctx, r.Host) {
+			http.Error(w, fmt.Sprintf("Forbidden: host %s is not allowed", r.Host), http.StatusForbidden)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		crossOrigin := origin != "" && !isSameOrigin(origin, r)
+		if crossOrigin {
+			if !isAllowedOrigin(ctx, origin) {
+				http.Error(w, fmt.Sprintf("Forbidden: origin %s is not allowed", origin), http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			w.Header().Set("Access-Control-Max-Age", "600")
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+		fetchSite := r.Header.Get("Sec-Fetch-Site")
+		fromBrowser := crossOrigin || fetchSite == "cross-site" || fetchSite == "same-site"
+		if fromBrowser && !isSafeMethod(r.Method) && r.Header.Get("Authorization") == "" && r.Header.Get("X-Tool-Hub-Request") == "" {
+			http.Error(w, "Forbidden: cross-site request without X-Tool-Hub-Request header", http.StatusForbidden)
 			return
 		}
-		callTool(ctx, w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func isSameOrigin(origin string, r *http.Request) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// isAllowedHost reports whether a request with the Host header host may be served.
+// IP literals can't be rebound, so only host names need to be allowed explicitly.
+func isAllowedHost(ctx context.Context, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
 	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "" || net.ParseIP(host) != nil || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	for _, allowed := range splitList(getSetting(ctx, SettingKeyAllowedHosts, "")) {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAllowedOrigin reports whether the origin is in the AllowedOrigins setting, e.g. "http://localhost:5173".
+func isAllowedOrigin(ctx context.Context, origin string) bool {
+	return origin != "null" && slices.Contains(splitList(getSetting(ctx, SettingKeyAllowedOrigins, "")), origin)
+}
+
+func pingHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "pong")
 }
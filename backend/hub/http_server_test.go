@@ -0,0 +1,96 @@
+package hub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtectHandler(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	assert.Empty(t, model.SaveSetting(string(SettingKeyAllowedOrigins), "http://localhost:5173").Error)
+	assert.Empty(t, model.SaveSetting(string(SettingKeyAllowedHosts), "my-box.local").Error)
+
+	handler := protectHandler(ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(method string, host string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://"+host+"/api/callTool", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// DNS rebinding
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "localhost:9573", nil).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "127.0.0.1:9573", nil).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "[::1]:9573", nil).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "my-box.local:9573", nil).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "attacker.example:9573", nil).Code)
+
+	// preflight
+	rec := serve(http.MethodOptions, "localhost:9573", map[string]string{
+		"Origin":                        "http://localhost:5173",
+		"Access-Control-Request-Method": "POST",
+	})
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "http://localhost:5173", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+	rec = serve(http.MethodOptions, "localhost:9573", map[string]string{
+		"Origin":                        "https://attacker.example",
+		"Access-Control-Request-Method": "POST",
+	})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// cross-origin requests
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "localhost:9573", map[string]string{
+		"Origin": "https://attacker.example", "Authorization": "Bearer x",
+	}).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "localhost:9573", map[string]string{
+		"Origin": "http://localhost:5173", "Content-Type": "text/plain",
+	}).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "localhost:9573", map[string]string{
+		"Origin": "http://localhost:5173", "X-Tool-Hub-Request": "1",
+	}).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "localhost:9573", map[string]string{
+		"Sec-Fetch-Site": "same-site", "Content-Type": "application/x-www-form-urlencoded",
+	}).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "localhost:9573", map[string]string{
+		"Origin": "http://localhost:9573", "Sec-Fetch-Site": "same-origin",
+	}).Code)
+
+	// command line clients send neither Origin nor Sec-Fetch-Site
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "localhost:9573", nil).Code)
+
+	// unix sockets are not reachable from browsers
+	req := httptest.NewRequest(http.MethodPost, "http://hub/api/callTool", nil)
+	req = req.WithContext(context.WithValue(req.Context(), listenerNetworkContextKey{}, "unix"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHubHandler_routes(t *testing.T) {
+	setupTestDB(t)
+	handler := newHubHandler(context.Background())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://localhost/api/ping", nil))
+	assert.Equal(t, "pong", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://localhost/api/callTool", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "http://localhost/api/callTool", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,185 @@
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound is returned when a path doesn't match anything in a document.
+var ErrNotFound = errors.New("path not found")
+
+// Path is a compiled JSON path expression evaluated against documents decoded by encoding/json,
+// i.e. made of map[string]any, []any, string, float64, bool and nil.
+//
+// The supported subset of JSONPath is:
+//
+//	$            the root of the document
+//	.name        member of an object, name is made of letters, digits, "_" and "-"
+//	['name']     member of an object with any name, double quotes work too
+//	[2], [-1]    element of an array, negative indexes count from the end
+//	[*], .*      every element of an array or member of an object
+//
+// Once a wildcard matched, the result is the array of the values matched by the rest of the path.
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+type segment struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// Compile parses expr.
+func Compile(expr string) (*Path, error) {
+	p := &Path{expr: expr}
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("invalid path %q: should start with $", expr)
+	}
+	rest := expr[1:]
+	for rest != "" {
+		var seg segment
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, "*") {
+				seg.wildcard = true
+				rest = rest[1:]
+				break
+			}
+			n := 0
+			for n < len(rest) && isNameChar(rest[n]) {
+				n++
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("invalid path %q: missing name after .", expr)
+			}
+			seg.name, rest = rest[:n], rest[n:]
+		case '[':
+			if len(rest) > 1 && (rest[1] == '\'' || rest[1] == '"') {
+				quote := rest[1]
+				closing := strings.IndexByte(rest[2:], quote)
+				if closing < 0 || len(rest) < closing+4 || rest[closing+3] != ']' {
+					return nil, fmt.Errorf("invalid path %q: unterminated name", expr)
+				}
+				seg.name, rest = rest[2:closing+2], rest[closing+4:]
+				break
+			}
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing ]", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if inner == "*" {
+				seg.wildcard = true
+				break
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: invalid index %q", expr, inner)
+			}
+			seg.index, seg.isIndex = index, true
+		default:
+			return nil, fmt.Errorf("invalid path %q: unexpected %q", expr, rest[0])
+		}
+		p.segments = append(p.segments, seg)
+	}
+	return p, nil
+}
+
+// MustCompile is like Compile but panics when expr is invalid.
+func MustCompile(expr string) *Path {
+	p, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Get returns the value at the path in doc.
+func (p *Path) Get(doc any) (any, error) {
+	values := []any{doc}
+	multi := false
+	for _, seg := range p.segments {
+		var next []any
+		for _, v := range values {
+			next = append(next, seg.apply(v)...)
+		}
+		if seg.wildcard {
+			multi = true
+		}
+		values = next
+		if !multi && len(values) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, p.expr)
+		}
+	}
+	if multi {
+		if values == nil {
+			values = []any{}
+		}
+		return values, nil
+	}
+	return values[0], nil
+}
+
+// apply returns the values matched by the segment in v.
+func (s segment) apply(v any) []any {
+	switch {
+	case s.wildcard:
+		switch v := v.(type) {
+		case []any:
+			return v
+		case map[string]any:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys) // deterministic order of members
+			values := make([]any, 0, len(keys))
+			for _, k := range keys {
+				values = append(values, v[k])
+			}
+			return values
+		}
+	case s.isIndex:
+		if arr, ok := v.([]any); ok {
+			i := s.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i >= 0 && i < len(arr) {
+				return []any{arr[i]}
+			}
+		}
+	default:
+		if obj, ok := v.(map[string]any); ok {
+			if value, ok := obj[s.name]; ok {
+				return []any{value}
+			}
+		}
+	}
+	return nil
+}
+
+// Get evaluates expr against doc.
+func Get(doc any, expr string) (any, error) {
+	p, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Get(doc)
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
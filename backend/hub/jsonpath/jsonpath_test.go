@@ -0,0 +1,50 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	var doc any
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"input": {"urls": ["a", "b"], "odd key": true},
+		"steps": {"fetch": {"output": [{"status": 200, "tags": ["x"]}, {"status": 404, "tags": []}]}}
+	}`), &doc))
+
+	tests := []struct {
+		expr string
+		want any
+	}{
+		{"$", doc},
+		{"$.input.urls", []any{"a", "b"}},
+		{"$.input.urls[1]", "b"},
+		{"$.input.urls[-1]", "b"},
+		{"$.input['odd key']", true},
+		{`$["input"]["urls"][0]`, "a"},
+		{"$.steps.fetch.output[*].status", []any{float64(200), float64(404)}},
+		{"$.steps.fetch.output[*].tags[0]", []any{"x"}},
+		{"$.input.*", []any{true, []any{"a", "b"}}},
+		{"$.input.urls[*].missing", []any{}},
+	}
+	for _, tt := range tests {
+		got, err := Get(doc, tt.expr)
+		assert.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, got, tt.expr)
+	}
+
+	for _, expr := range []string{"$.input.missing", "$.input.urls[2]", "$.input.urls.length", "$.input.missing[*]"} {
+		_, err := Get(doc, expr)
+		assert.ErrorIs(t, err, ErrNotFound, expr)
+	}
+}
+
+func TestCompile_invalid(t *testing.T) {
+	for _, expr := range []string{"input", "$.", "$[", "$[x]", "$['a]", "$..a", "$a"} {
+		_, err := Compile(expr)
+		assert.Error(t, err, expr)
+	}
+	assert.Equal(t, "$.a[0]", MustCompile("$.a[0]").String())
+}
@@ -0,0 +1,248 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The parameters of tools are described by JSON schemas generated from zod by the frontend. checkJSONSchema
+// and validateJSONSchema understand the keywords those schemas use, other keywords are ignored.
+
+var jsonSchemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true, "integer": true, "boolean": true, "null": true,
+}
+
+// checkJSONSchema reports the problems of a JSON schema, path locates schema in the document, e.g. "#/properties/dir".
+func checkJSONSchema(schema any, path string) []string {
+	if _, ok := schema.(bool); ok {
+		return nil
+	}
+	s, ok := schema.(map[string]any)
+	if !ok {
+		return []string{fmt.Sprintf("%s: a schema should be an object", path)}
+	}
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+	if t, ok := s["type"]; ok {
+		for _, name := range schemaTypes(t) {
+			if !jsonSchemaTypes[name] {
+				add("unknown type %q", name)
+			}
+		}
+		if _, isString := t.(string); !isString {
+			if _, isArray := t.([]any); !isArray || len(schemaTypes(t)) == 0 {
+				add("type should be a string or an array of strings")
+			}
+		}
+	}
+	if properties, ok := s["properties"]; ok {
+		if m, ok := properties.(map[string]any); ok {
+			for _, name := range sortedKeys(m) {
+				problems = append(problems, checkJSONSchema(m[name], path+"/properties/"+name)...)
+			}
+		} else {
+			add("properties should be an object")
+		}
+	}
+	if required, ok := s["required"]; ok {
+		if names, ok := required.([]any); ok {
+			for _, name := range names {
+				if _, ok := name.(string); !ok {
+					add("required should list property names")
+					break
+				}
+			}
+		} else {
+			add("required should be an array")
+		}
+	}
+	if items, ok := s["items"]; ok {
+		problems = append(problems, checkJSONSchema(items, path+"/items")...)
+	}
+	if additional, ok := s["additionalProperties"]; ok {
+		problems = append(problems, checkJSONSchema(additional, path+"/additionalProperties")...)
+	}
+	if enum, ok := s["enum"]; ok {
+		if _, ok := enum.([]any); !ok {
+			add("enum should be an array")
+		}
+	}
+	for _, keyword := range []string{"minimum", "maximum", "minLength", "maxLength", "minItems", "maxItems"} {
+		if v, ok := s[keyword]; ok {
+			if _, ok := v.(float64); !ok {
+				add("%s should be a number", keyword)
+			}
+		}
+	}
+	if pattern, ok := s["pattern"]; ok {
+		if p, ok := pattern.(string); !ok {
+			add("pattern should be a string")
+		} else if _, err := regexp.Compile(p); err != nil {
+			add("invalid pattern: %v", err)
+		}
+	}
+	return problems
+}
+
+// validateJSONSchema reports how value doesn't conform to schema, path locates value, e.g. "$.dir".
+// schema is expected to pass checkJSONSchema.
+func validateJSONSchema(schema any, value any, path string) []string {
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			return []string{fmt.Sprintf("%s: not allowed", path)}
+		}
+		return nil
+	}
+	s, _ := schema.(map[string]any)
+	if t, ok := s["type"]; ok {
+		types := schemaTypes(t)
+		matched := false
+		for _, name := range types {
+			if jsonTypeMatches(name, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return []string{fmt.Sprintf("%s: should be %s", path, strings.Join(types, " or "))}
+		}
+	}
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, item := range enum {
+			if jsonEqual(item, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("should be one of %s", compactJSON(enum))
+		}
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		required, _ := s["required"].([]any)
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, ok := v[name]; !ok {
+					add("%s is required", name)
+				}
+			}
+		}
+		properties, _ := s["properties"].(map[string]any)
+		for _, name := range sortedKeys(v) {
+			if property, ok := properties[name]; ok {
+				problems = append(problems, validateJSONSchema(property, v[name], path+"."+name)...)
+			} else if additional, ok := s["additionalProperties"]; ok {
+				if allowed, ok := additional.(bool); ok && !allowed {
+					add("unknown property %s", name)
+				} else {
+					problems = append(problems, validateJSONSchema(additional, v[name], path+"."+name)...)
+				}
+			}
+		}
+	case []any:
+		if items, ok := s["items"]; ok {
+			for i, item := range v {
+				problems = append(problems, validateJSONSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+		if n, ok := s["minItems"].(float64); ok && float64(len(v)) < n {
+			add("should have at least %v items", n)
+		}
+		if n, ok := s["maxItems"].(float64); ok && float64(len(v)) > n {
+			add("should have at most %v items", n)
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := s["minLength"].(float64); ok && length < n {
+			add("should be at least %v characters long", n)
+		}
+		if n, ok := s["maxLength"].(float64); ok && length > n {
+			add("should be at most %v characters long", n)
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				add("should match %s", pattern)
+			}
+		}
+	case float64:
+		if n, ok := s["minimum"].(float64); ok && v < n {
+			add("should be at least %v", n)
+		}
+		if n, ok := s["maximum"].(float64); ok && v > n {
+			add("should be at most %v", n)
+		}
+	}
+	return problems
+}
+
+func schemaTypes(t any) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func jsonTypeMatches(name string, value any) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+func jsonEqual(a, b any) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+func compactJSON(v any) string {
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,189 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// Tools have a lifecycle status, checked whenever they are called:
+//
+//   - active tools are called as usual, tools stored before statuses existed have an empty status and are active
+//   - drafts are registered despite their errors, see registerTool, they are only called when the call allows drafts
+//   - deprecated tools are called with a warning naming their replacement, until their sunset date if they have one
+//   - disabled tools aren't called
+//
+// so that tools are retired by deprecating them with a sunset date, callers being warned in the meantime.
+
+var (
+	errToolDisabled = errors.New("tool is disabled")
+	errToolSunset   = errors.New("tool is past its sunset date")
+)
+
+// ToolLifecycle is the lifecycle status a tool is moved to.
+type ToolLifecycle struct {
+	Status     string `json:"status"`     // ToolStatusActive, ToolStatusDraft, ToolStatusDeprecated or ToolStatusDisabled
+	ReplacedBy string `json:"replacedBy"` // name of the tool replacing a deprecated one, optional
+	SunsetAt   int64  `json:"sunsetAt"`   // unix milli from which calls of a deprecated tool fail, 0 for never
+}
+
+// toolStatus returns the lifecycle status of tool.
+func toolStatus(tool Tool) string {
+	if tool.Status == "" {
+		return ToolStatusActive
+	}
+	return tool.Status
+}
+
+func validToolStatus(status string) bool {
+	switch status {
+	case "", ToolStatusActive, ToolStatusDraft, ToolStatusDeprecated, ToolStatusDisabled:
+		return true
+	}
+	return false
+}
+
+// newToolLifecycle returns tool with the lifecycle of a tool being created: active, or a draft, whatever the
+// lifecycle fields it was given. Tools are only deprecated or disabled afterwards, with setToolLifecycle.
+func newToolLifecycle(tool Tool) Tool {
+	if tool.Status != ToolStatusDraft {
+		tool.Status = ToolStatusActive
+	}
+	tool.ReplacedBy, tool.DeprecatedAt, tool.SunsetAt = "", 0, 0
+	return tool
+}
+
+// isLifecycleError reports whether err is a call refused because of the status of the tool.
+func isLifecycleError(err error) bool {
+	return errors.Is(err, errToolDraft) || errors.Is(err, errToolDisabled) || errors.Is(err, errToolSunset)
+}
+
+// checkToolLifecycle fails the calls of tool its status doesn't allow, allowDraft allows calling drafts.
+func checkToolLifecycle(tool Tool, allowDraft bool) error {
+	switch toolStatus(tool) {
+	case ToolStatusDisabled:
+		return fmt.Errorf("%w: %s", errToolDisabled, tool.Name)
+	case ToolStatusDraft:
+		if !allowDraft {
+			return fmt.Errorf("%w: %s, register it again without errors or allow calling drafts", errToolDraft, tool.Name)
+		}
+	case ToolStatusDeprecated:
+		if tool.SunsetAt > 0 && time.Now().UnixMilli() >= tool.SunsetAt {
+			if tool.ReplacedBy != "" {
+				return fmt.Errorf("%w: %s, use %s instead", errToolSunset, tool.Name, tool.ReplacedBy)
+			}
+			return fmt.Errorf("%w: %s", errToolSunset, tool.Name)
+		}
+	}
+	return nil
+}
+
+// deprecationWarning returns the warning given to the callers of tool, empty when it isn't deprecated.
+func deprecationWarning(tool Tool) string {
+	if toolStatus(tool) != ToolStatusDeprecated {
+		return ""
+	}
+	warning := fmt.Sprintf("tool %s is deprecated", tool.Name)
+	if tool.ReplacedBy != "" {
+		warning += ", use " + tool.ReplacedBy + " instead"
+	}
+	if tool.SunsetAt > 0 {
+		warning += ", calls fail from " + time.UnixMilli(tool.SunsetAt).UTC().Format(time.RFC3339)
+	}
+	return warning
+}
+
+// setDeprecationHeaders sets the Deprecation (RFC 9745), Sunset (RFC 8594), Link and Warning headers of the
+// response to a call of a deprecated tool.
+func setDeprecationHeaders(h http.Header, tool Tool) {
+	warning := deprecationWarning(tool)
+	if warning == "" {
+		return
+	}
+	h.Set("Deprecation", "@"+strconv.FormatInt(tool.DeprecatedAt/1000, 10))
+	if tool.SunsetAt > 0 {
+		h.Set("Sunset", time.UnixMilli(tool.SunsetAt).UTC().Format(http.TimeFormat))
+	}
+	if tool.ReplacedBy != "" {
+		h.Set("Link", fmt.Sprintf(`</api/tools/%s>; rel="successor-version"`, url.PathEscape(tool.ReplacedBy)))
+	}
+	h.Set("Warning", fmt.Sprintf("299 - %q", warning))
+}
+
+// setToolLifecycle moves the tool referenced by ref to another status.
+func setToolLifecycle(ctx context.Context, ref string, lifecycle ToolLifecycle) (Tool, error) {
+	tool, err := findTool(ctx, ref, false)
+	if err != nil {
+		return tool, err
+	}
+	if lifecycle.Status == "" || !validToolStatus(lifecycle.Status) {
+		return tool, fmt.Errorf("%w: unknown status %q", errInvalidTool, lifecycle.Status)
+	}
+	deprecatedAt := tool.DeprecatedAt
+	if toolStatus(tool) != ToolStatusDeprecated {
+		deprecatedAt = time.Now().UnixMilli()
+	}
+	tool.Status = lifecycle.Status
+	tool.ReplacedBy, tool.DeprecatedAt, tool.SunsetAt = "", 0, 0
+	if lifecycle.Status == ToolStatusDeprecated {
+		if lifecycle.ReplacedBy != "" {
+			if lifecycle.ReplacedBy == tool.Name {
+				return tool, fmt.Errorf("%w: a tool can't replace itself", errInvalidTool)
+			}
+			if _, err := findTool(ctx, lifecycle.ReplacedBy, false); err != nil {
+				return tool, fmt.Errorf("%w: replacement: %v", errInvalidTool, err)
+			}
+		}
+		if lifecycle.SunsetAt != 0 && lifecycle.SunsetAt <= time.Now().UnixMilli() {
+			return tool, fmt.Errorf("%w: the sunset date should be in the future, disable the tool instead", errInvalidTool)
+		}
+		tool.ReplacedBy, tool.DeprecatedAt, tool.SunsetAt = lifecycle.ReplacedBy, deprecatedAt, lifecycle.SunsetAt
+	}
+	err = db.WithContext(ctx).Model(&tool).Select("status", "replaced_by", "deprecated_at", "sunset_at").Updates(&tool).Error
+	if err != nil {
+		return tool, err
+	}
+	catalogChanged()
+	return gorm.G[Tool](db).Where("id = ?", tool.ID).Take(ctx)
+}
+
+func setToolLifecycleHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	var lifecycle ToolLifecycle
+	if err := json.NewDecoder(r.Body).Decode(&lifecycle); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	tool, err := setToolLifecycle(ctx, r.PathValue("ref"), lifecycle)
+	if err != nil {
+		http.Error(w, err.Error(), toolErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, RespSaveTool{Item: tool})
+}
+
+// #region Lifecycle Bindings
+
+// SetToolLifecycle moves a tool to another lifecycle status.
+func (m *Model) SetToolLifecycle(id int, lifecycle ToolLifecycle) (resp RespSaveTool) {
+	var err error
+	resp.Item, err = setToolLifecycle(m.ctx, strconv.Itoa(id), lifecycle)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to change the status of the tool: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// #endregion
@@ -0,0 +1,130 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestToolLifecycle(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalCache), "false").Error)
+	fakeEvalFrontend(t, func(r EvalToolRequestEvent) {
+		deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Success: true, Tool: json.RawMessage(r.Code)})
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "pong") }))
+	defer srv.Close()
+	code := fmt.Sprintf(`{"extra": {"url": %q}}`, srv.URL)
+	old, err := createTool(ctx, Tool{Name: "ping", Category: "http", Code: code})
+	assert.NoError(t, err)
+	assert.Equal(t, ToolStatusActive, old.Status)
+	_, err = createTool(ctx, Tool{Name: "ping2", Category: "http", Code: code})
+	assert.NoError(t, err)
+
+	// the lifecycle fields of created tools are ignored, only setToolLifecycle changes them
+	created, err := createTool(ctx, Tool{Name: "ping3", Category: "http", Code: code, Status: ToolStatusDisabled,
+		ReplacedBy: "ping", DeprecatedAt: 1, SunsetAt: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, Tool{Status: ToolStatusActive}, Tool{Status: created.Status, ReplacedBy: created.ReplacedBy,
+		DeprecatedAt: created.DeprecatedAt, SunsetAt: created.SunsetAt})
+	saved, err := saveTool(ctx, Tool{Name: "ping4", Category: "http", Code: code, Status: ToolStatusDeprecated, SunsetAt: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, ToolStatusActive, saved.Status)
+	assert.Zero(t, saved.SunsetAt)
+	draft, err := createTool(ctx, Tool{Name: "ping5", Category: "http", Code: code, Status: ToolStatusDraft})
+	assert.NoError(t, err)
+	assert.Equal(t, ToolStatusDraft, draft.Status)
+	assert.NoError(t, db.Unscoped().Where("name IN ?", []string{"ping3", "ping4", "ping5"}).Delete(&Tool{}).Error)
+
+	for _, lifecycle := range []ToolLifecycle{
+		{Status: "retired"},
+		{Status: ToolStatusDeprecated, ReplacedBy: "missing"},
+		{Status: ToolStatusDeprecated, ReplacedBy: "ping"},
+		{Status: ToolStatusDeprecated, SunsetAt: time.Now().Add(-time.Hour).UnixMilli()},
+	} {
+		_, err := setToolLifecycle(ctx, "ping", lifecycle)
+		assert.ErrorIs(t, err, errInvalidTool, lifecycle)
+	}
+
+	token, _, err := createAPIToken(ctx, "caller", []string{ScopeToolsCall}, nil, 0)
+	assert.NoError(t, err)
+	handler := newHubHandler(ctx)
+	call := func(path string, body string) (*httptest.ResponseRecorder, RespCallTool) {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost"+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var resp RespCallTool
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	// deprecated tools are called with warnings
+	sunset := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	tool, err := setToolLifecycle(ctx, "ping", ToolLifecycle{Status: ToolStatusDeprecated, ReplacedBy: "ping2", SunsetAt: sunset.UnixMilli()})
+	assert.NoError(t, err)
+	assert.NotZero(t, tool.DeprecatedAt)
+	rec, resp := call("/api/tools/ping/call", `{}`)
+	assert.Equal(t, http.StatusOK, rec.Code, resp.Error)
+	assert.Equal(t, "pong", resp.Output)
+	assert.Len(t, resp.Warnings, 1)
+	assert.Contains(t, resp.Warnings[0], "use ping2 instead")
+	assert.Equal(t, fmt.Sprintf("@%d", tool.DeprecatedAt/1000), rec.Header().Get("Deprecation"))
+	assert.Equal(t, sunset.UTC().Format(http.TimeFormat), rec.Header().Get("Sunset"))
+	assert.Equal(t, `</api/tools/ping2>; rel="successor-version"`, rec.Header().Get("Link"))
+	rec, _ = call("/api/callTool", `{"name": "ping"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Warning"))
+
+	// registering the tool again keeps its status
+	_, err = saveTool(ctx, Tool{Name: "ping", Category: "http", Code: code})
+	assert.NoError(t, err)
+	tool, _ = findTool(ctx, "ping", false)
+	assert.Equal(t, ToolStatusDeprecated, tool.Status)
+	assert.Equal(t, "ping2", tool.ReplacedBy)
+
+	// calls fail after the sunset
+	assert.NoError(t, db.Model(&Tool{}).Where("id = ?", tool.ID).Update("sunset_at", time.Now().Add(-time.Second).UnixMilli()).Error)
+	rec, resp = call("/api/tools/ping/call", `{}`)
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Contains(t, resp.Error, "use ping2 instead")
+
+	_, err = setToolLifecycle(ctx, "ping", ToolLifecycle{Status: ToolStatusDisabled})
+	assert.NoError(t, err)
+	rec, _ = call("/api/callTool", `{"name": "ping"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("Deprecation"))
+
+	_, err = setToolLifecycle(ctx, "ping", ToolLifecycle{Status: ToolStatusDraft})
+	assert.NoError(t, err)
+	rec, _ = call("/api/tools/ping/call", `{}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec, _ = call("/api/tools/ping/call?draft=true", `{}`)
+	assert.Equal(t, http.StatusOK, rec.Code, "drafts are called when the call allows them")
+	rec, _ = call("/api/callTool", `{"name": "ping", "allowDraft": true}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	list, _, err := listTools(ctx, ToolFilter{Status: ToolStatusActive})
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "ping2", list[0].Name)
+	tools, err := gorm.G[Tool](db).Find(ctx)
+	assert.NoError(t, err)
+	paths := buildOpenAPI(nil, tools)["paths"].(map[string]map[string]any)
+	assert.NotContains(t, paths, "/api/tools/ping/call", "drafts aren't documented")
+
+	tool, err = setToolLifecycle(ctx, "ping", ToolLifecycle{Status: ToolStatusActive})
+	assert.NoError(t, err)
+	assert.Zero(t, tool.DeprecatedAt)
+	rec, _ = call("/api/tools/ping/call", `{}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
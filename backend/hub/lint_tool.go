@@ -0,0 +1,277 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"tool-hub/backend/hub/cmd"
+)
+
+// lintTool checks a tool before registerTool stores it, instead of when it's called: the plugin is evaluated
+// with the default parameters and its output is checked like executing the tool would, the parameters
+// should be a JSON schema the default parameters conform to, and the executables of command line tools
+// should be found. Errors make the tool fail, warnings are worth a look.
+
+const (
+	issueError   = "error"
+	issueWarning = "warning"
+)
+
+// ToolIssue is a problem found in a tool by lintTool.
+type ToolIssue struct {
+	Severity string `json:"severity"` // "error" or "warning"
+	Field    string `json:"field"`    // what the issue is about, e.g. "parameters" or "extra.cmd", empty for the tool
+	Message  string `json:"message"`
+}
+
+type toolIssues []ToolIssue
+
+func (l *toolIssues) errorf(field string, format string, args ...any) {
+	*l = append(*l, ToolIssue{Severity: issueError, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *toolIssues) warnf(field string, format string, args ...any) {
+	*l = append(*l, ToolIssue{Severity: issueWarning, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// hasErrors reports whether issues has errors, not only warnings.
+func hasErrors(issues []ToolIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == issueError {
+			return true
+		}
+	}
+	return false
+}
+
+// lintTool returns the issues of tool, see above.
+func lintTool(ctx context.Context, tool Tool) []ToolIssue {
+	var issues toolIssues
+	if err := validateTool(tool); err != nil {
+		issues.errorf("", "%v", err)
+		return issues
+	}
+	category := CategoryOfTool(tool.Category)
+	switch category {
+	case "", CategoryCommandLine, CategoryHTTP, CategoryPipeline:
+	default:
+		issues.errorf("category", "unknown category %q", tool.Category)
+		return issues
+	}
+	if strings.TrimSpace(tool.Description) == "" {
+		issues.warnf("description", "the description tells clients what the tool does")
+	}
+
+	parameters := tool.DefaultParams
+	if parameters == "" {
+		parameters = "{}"
+	}
+	if tool.Parameters != "" {
+		var schema, defaults any
+		json.Unmarshal([]byte(tool.Parameters), &schema)
+		json.Unmarshal([]byte(parameters), &defaults)
+		if problems := checkJSONSchema(schema, "#"); len(problems) > 0 {
+			for _, problem := range problems {
+				issues.errorf("parameters", "%s", problem)
+			}
+		} else {
+			for _, problem := range validateJSONSchema(schema, defaults, "$") {
+				issues.errorf("defaultParams", "%s", problem)
+			}
+		}
+	}
+
+	if category == CategoryPipeline {
+		def, _ := parsePipeline(tool.Code)
+		for _, step := range def.Steps {
+			if step.Tool == tool.Name {
+				continue
+			}
+			if _, err := findTool(ctx, step.Tool, false); err != nil {
+				issues.warnf("code", "step %q calls %s: %v", step.ID, step.Tool, err)
+			}
+		}
+		return issues
+	}
+
+	toolData, err := EvalTool(ctx, tool.Code, parameters)
+	if err != nil {
+		issues.errorf("code", "%v", err)
+		return issues
+	}
+	if category == CategoryHTTP {
+		lintHTTPTool(ctx, &issues, toolData)
+	} else {
+		lintCommandLineTool(ctx, &issues, toolData)
+	}
+	if _, err := parseRetryPolicy(toolData); err != nil {
+		issues.errorf("retry", "%v", err)
+	}
+	return issues
+}
+
+func lintTimeout(issues *toolIssues, timeout string) {
+	if timeout == "" {
+		return
+	}
+	if d, err := time.ParseDuration(timeout); err != nil || d < 0 {
+		issues.errorf("timeout", "invalid timeout %q", timeout)
+	}
+}
+
+func lintCommandLineTool(ctx context.Context, issues *toolIssues, toolData []byte) {
+	var tool CommandLineTool
+	if err := json.Unmarshal(toolData, &tool); err != nil {
+		issues.errorf("code", "the plugin should return a command line tool: %v", err)
+		return
+	}
+	extra := tool.Extra
+	lintTimeout(issues, tool.Timeout)
+	if extra.Env != "" {
+		var env map[string]string
+		if err := json.Unmarshal([]byte(extra.Env), &env); err != nil {
+			issues.errorf("extra.env", "env should be a JSON object of strings: %v", err)
+		}
+		for _, name := range sortedKeys(env) {
+			if _, err := resolveSecrets(ctx, env[name]); err != nil {
+				issues.errorf("extra.env", "%s: %v", name, err)
+			}
+		}
+	}
+	if _, err := cmd.ParseEnvPolicy(extra.EnvPolicy, extra.EnvAllow); err != nil {
+		issues.errorf("extra.envPolicy", "%v", err)
+	}
+	if err := validateOutputPatterns(extra.Outputs); err != nil {
+		issues.errorf("extra.outputs", "%v", err)
+	} else if len(extra.Outputs) > 0 && !extra.Workspace {
+		issues.warnf("extra.outputs", "outputs are only collected from a workspace")
+	}
+	if extra.WD != "" && !extra.Workspace {
+		if fi, err := os.Stat(extra.WD); err != nil || !fi.IsDir() {
+			issues.warnf("extra.wd", "%s is not a directory", extra.WD)
+		}
+	}
+
+	if strings.TrimSpace(extra.Cmd) == "" {
+		issues.errorf("extra.cmd", "cmd is required")
+		return
+	}
+	if extra.Sh == "" {
+		// without a shell, cmd is the executable itself
+		if _, err := lookExecutable(extra.Cmd, extra.WD); err != nil {
+			issues.errorf("extra.cmd", "%s is not an executable, set extra.sh to run a shell command", extra.Cmd)
+		}
+		return
+	}
+	if _, err := exec.LookPath(extra.Sh); err != nil {
+		issues.errorf("extra.sh", "shell %s is not found on PATH", extra.Sh)
+		return
+	}
+	for _, name := range commandNames(extra.Cmd) {
+		if _, err := lookExecutable(name, extra.WD); err != nil {
+			issues.warnf("extra.cmd", "%s is not found on PATH", name)
+		}
+	}
+}
+
+func lintHTTPTool(ctx context.Context, issues *toolIssues, toolData []byte) {
+	var tool HTTPTool
+	if err := json.Unmarshal(toolData, &tool); err != nil {
+		issues.errorf("code", "the plugin should return a HTTP tool: %v", err)
+		return
+	}
+	extra := tool.Extra
+	lintTimeout(issues, tool.Timeout)
+	if extra.URL == "" {
+		issues.errorf("extra.url", "url is required")
+	} else if rawURL, err := resolveSecrets(ctx, extra.URL); err != nil {
+		issues.errorf("extra.url", "%v", err)
+	} else if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		issues.errorf("extra.url", "invalid url %q", extra.URL)
+	}
+	if _, err := resolveSecrets(ctx, extra.Query); err != nil {
+		issues.errorf("extra.query", "%v", err)
+	}
+	if _, err := resolveSecrets(ctx, extra.Body); err != nil {
+		issues.errorf("extra.body", "%v", err)
+	}
+	switch strings.ToUpper(extra.Method) {
+	case "", http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+	default:
+		issues.warnf("extra.method", "unusual method %q", extra.Method)
+	}
+}
+
+// lookExecutable finds the executable name, relative paths are relative to wd.
+func lookExecutable(name string, wd string) (string, error) {
+	if strings.ContainsRune(name, '/') && !filepath.IsAbs(name) && wd != "" {
+		name = filepath.Join(wd, name)
+	}
+	return exec.LookPath(name)
+}
+
+var (
+	shellRedirection = regexp.MustCompile(`\d*[<>]+&?\d*-?`)
+	// shellBuiltins aren't executables, shellPrefixes are followed by the command they run
+	shellBuiltins = wordSet(`. : [ [[ ]] alias bg break case cd continue done echo esac eval exit export false fg fi
+		for function in jobs local printf pwd read readonly return set shift source test trap true type ulimit
+		umask unalias unset wait`)
+	shellPrefixes = wordSet(`! command do elif else exec if then time until while`)
+)
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// commandNames guesses the executables run by a shell script, the first word of each command which isn't
+// a builtin, a variable assignment or an expansion.
+func commandNames(script string) []string {
+	script = shellRedirection.ReplaceAllString(script, " ")
+	segments := strings.FieldsFunc(script, func(r rune) bool {
+		return strings.ContainsRune("|&;\n()`{}", r)
+	})
+	var names []string
+	seen := map[string]bool{}
+	for _, segment := range segments {
+		for _, word := range strings.Fields(segment) {
+			if (strings.Contains(word, "=") && !strings.HasPrefix(word, "=")) || shellPrefixes[word] {
+				continue // e.g. FOO=bar cmd
+			}
+			if !shellBuiltins[word] && !seen[word] && !strings.ContainsAny(word, "$\"'*?~\\") {
+				seen[word] = true
+				names = append(names, word)
+			}
+			break
+		}
+	}
+	return names
+}
+
+// #region Lint Bindings
+
+type RespLintTool struct {
+	Error  string      `json:"error"`
+	Issues []ToolIssue `json:"issues"`
+}
+
+// LintTool returns the issues registering tool would report.
+func (m *Model) LintTool(tool Tool) (resp RespLintTool) {
+	resp.Issues = lintTool(m.ctx, tool)
+	return
+}
+
+// #endregion
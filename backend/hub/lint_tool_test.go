@@ -0,0 +1,145 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSchema(t *testing.T) {
+	var schema any
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"dir": {"type": "string", "minLength": 1},
+			"depth": {"type": "integer", "minimum": 0},
+			"format": {"enum": ["json", "text"]},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		},
+		"required": ["dir"],
+		"additionalProperties": false
+	}`), &schema))
+	assert.Empty(t, checkJSONSchema(schema, "#"))
+
+	validate := func(value string) []string {
+		var v any
+		assert.NoError(t, json.Unmarshal([]byte(value), &v))
+		return validateJSONSchema(schema, v, "$")
+	}
+	assert.Empty(t, validate(`{"dir": "/tmp", "depth": 2, "format": "json", "tags": ["a"]}`))
+	assert.Equal(t, []string{"$: dir is required"}, validate(`{}`))
+	assert.Equal(t, []string{
+		"$.depth: should be integer",
+		"$.dir: should be at least 1 characters long",
+		"$.format: should be one of [\"json\",\"text\"]",
+		"$: unknown property other",
+		"$.tags[1]: should be string",
+	}, validate(`{"dir": "", "depth": 1.5, "format": "xml", "other": 1, "tags": ["a", 1]}`))
+	assert.Equal(t, []string{"$: should be object"}, validate(`[]`))
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"type": "map", "properties": {"a": 1}, "pattern": "("}`), &schema))
+	assert.Len(t, checkJSONSchema(schema, "#"), 3)
+}
+
+func TestCommandNames(t *testing.T) {
+	assert.Equal(t, []string{"sqlite3", "pg_format"},
+		commandNames(`sqlite3 ./hub.db "SELECT sql FROM sqlite_master" 2>&1 | pg_format > hub.sql`))
+	assert.Equal(t, []string{"make", "./run.sh"}, commandNames("cd build && LANG=C make; if ./run.sh; then echo $HOME; fi"))
+	assert.Empty(t, commandNames(`$EDITOR file`))
+}
+
+func TestLintTool(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalCache), "false").Error)
+	// the plugin of these tests is the JSON of the evaluated tool
+	fakeEvalFrontend(t, func(r EvalToolRequestEvent) {
+		deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Success: r.Code != "", Tool: json.RawMessage(r.Code), Error: "ToolPlugin is not defined"})
+	})
+	fields := func(issues []ToolIssue, severity string) []string {
+		var fields []string
+		for _, issue := range issues {
+			if issue.Severity == severity {
+				fields = append(fields, issue.Field)
+			}
+		}
+		return fields
+	}
+
+	issues := lintTool(ctx, Tool{
+		Name:          "list",
+		Description:   "list a directory",
+		Category:      "commandLine",
+		Parameters:    `{"type": "object", "properties": {"dir": {"type": "string"}}, "required": ["dir"]}`,
+		DefaultParams: `{"dir": "."}`,
+		Code:          `{"extra": {"sh": "sh", "cmd": "ls | tool-hub-missing-command"}}`,
+	})
+	assert.Empty(t, fields(issues, issueError))
+	assert.Equal(t, []string{"extra.cmd"}, fields(issues, issueWarning), issues)
+
+	issues = lintTool(ctx, Tool{
+		Name:       "list",
+		Category:   "commandLine",
+		Parameters: `{"type": "object", "required": ["dir"]}`,
+		Code:       `{"timeout": "soon", "extra": {"cmd": "ls -l", "env": "[]"}, "retry": {"maxAttempts": 3, "backoff": "later"}}`,
+	})
+	assert.Equal(t, []string{"defaultParams", "timeout", "extra.env", "extra.cmd", "retry"}, fields(issues, issueError), issues)
+	assert.Equal(t, []string{"description"}, fields(issues, issueWarning))
+
+	issues = lintTool(ctx, Tool{Name: "fetch", Description: "fetch", Category: "http", Code: `{"extra": {"url": "ftp://example.com"}}`})
+	assert.Equal(t, []string{"extra.url"}, fields(issues, issueError))
+	issues = lintTool(ctx, Tool{Name: "broken", Description: "broken", Category: "http"})
+	assert.Equal(t, []ToolIssue{{Severity: issueError, Field: "code", Message: "tool evaluation failed: ToolPlugin is not defined"}}, issues)
+	issues = lintTool(ctx, Tool{Name: "odd", Category: "ftp"})
+	assert.Equal(t, []string{"category"}, fields(issues, issueError))
+	issues = lintTool(ctx, Tool{Name: "flow", Description: "flow", Category: "pipeline", Code: `{"steps": [{"id": "a", "tool": "missing"}]}`})
+	assert.Empty(t, fields(issues, issueError))
+	assert.Equal(t, []string{"code"}, fields(issues, issueWarning))
+}
+
+func TestRegisterToolLint(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalCache), "false").Error)
+	fakeEvalFrontend(t, func(r EvalToolRequestEvent) {
+		deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Success: true, Tool: json.RawMessage(r.Code)})
+	})
+	token, _, err := createAPIToken(ctx, "admin", []string{ScopeToolsRegister, ScopeToolsCall}, nil, 0)
+	assert.NoError(t, err)
+	handler := newHubHandler(ctx)
+	do := func(method string, path string, body string) (*httptest.ResponseRecorder, RespRegisterTool) {
+		req := httptest.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var resp RespRegisterTool
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	broken := `{"name": "fetch", "description": "fetch", "category": "http", "code": "{\"extra\": {}}"}`
+	rec, resp := do(http.MethodPost, "/api/registerTool", `{"tool": `+broken+`}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, []ToolIssue{{Severity: issueError, Field: "extra.url", Message: "url is required"}}, resp.Issues)
+	_, err = findTool(ctx, "fetch", true)
+	assert.ErrorIs(t, err, errToolNotFound, "a tool with errors shouldn't be registered")
+
+	rec, resp = do(http.MethodPost, "/api/registerTool", `{"draft": true, "tool": `+broken+`}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, ToolStatusDraft, resp.Item.Status)
+	rec, _ = do(http.MethodPost, "/api/tools/fetch/call", `{}`)
+	assert.Equal(t, http.StatusConflict, rec.Code, "drafts can't be called")
+
+	fixed := `{"name": "fetch", "description": "fetch", "category": "http", "code": "{\"extra\": {\"url\": \"http://example.com\"}}"}`
+	rec, resp = do(http.MethodPost, "/api/registerTool", `{"tool": `+fixed+`}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, resp.Issues)
+	tool, err := findTool(ctx, "fetch", false)
+	assert.NoError(t, err)
+	assert.Equal(t, ToolStatusActive, tool.Status, "registering a tool without errors should activate it")
+}
@@ -0,0 +1,344 @@
+package hub
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ListenerConfig describes an address the hub serves its HTTP API on.
+type ListenerConfig struct {
+	Network string `json:"network"` // "tcp" or "unix"
+	Address string `json:"address"` // host:port for tcp, socket path for unix
+	Mode    string `json:"mode"`    // permissions of the unix socket file in octal, default "0600"
+	TLS     bool   `json:"tls"`     // serve https with a locally generated self-signed certificate
+}
+
+// ListenerStatus represents the state of a configured listener.
+type ListenerStatus struct {
+	ListenerConfig
+	Listening   bool   `json:"listening"`
+	Error       string `json:"error"`
+	Fingerprint string `json:"fingerprint"` // sha256 of the certificate when TLS is on
+}
+
+// listenerNetworkContextKey keys the network of the listener which accepted a request in its context.
+type listenerNetworkContextKey struct{}
+
+var defaultListeners = []ListenerConfig{{Network: "tcp", Address: "127.0.0.1:9573"}}
+
+var (
+	// listenOverrides are listeners given by command line flags, they take precedence over settings.
+	listenOverrides []ListenerConfig
+
+	listenersMu      sync.Mutex
+	listenerServers  []*http.Server
+	listenerStatuses []ListenerStatus
+)
+
+// ParseListenAddress parses a listen address given on the command line:
+//
+//	tcp://127.0.0.1:9573
+//	https://127.0.0.1:9574              (tcp with TLS)
+//	unix:///home/me/.tool-hub/hub.sock?mode=0660
+//	127.0.0.1:9573                      (same as tcp://)
+func ParseListenAddress(s string) (ListenerConfig, error) {
+	if !strings.Contains(s, "://") {
+		return ListenerConfig{Network: "tcp", Address: s}, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return ListenerConfig{}, fmt.Errorf("invalid listen address %q: %w", s, err)
+	}
+	switch u.Scheme {
+	case "tcp", "http":
+		return ListenerConfig{Network: "tcp", Address: u.Host}, nil
+	case "https", "tls":
+		return ListenerConfig{Network: "tcp", Address: u.Host, TLS: true}, nil
+	case "unix":
+		path := u.Path
+		if u.Host != "" {
+			// relative path such as unix://hub.sock
+			path = u.Host + u.Path
+		}
+		return ListenerConfig{Network: "unix", Address: path, Mode: u.Query().Get("mode")}, nil
+	default:
+		return ListenerConfig{}, fmt.Errorf("invalid listen address %q: unknown scheme %q", s, u.Scheme)
+	}
+}
+
+// SetListenOverrides makes the hub listen on the given addresses instead of the ones saved in settings.
+// It should be called before StartHub.
+func SetListenOverrides(addresses []string) error {
+	listenOverrides = nil
+	for _, a := range addresses {
+		cfg, err := ParseListenAddress(a)
+		if err != nil {
+			return err
+		}
+		listenOverrides = append(listenOverrides, cfg)
+	}
+	return nil
+}
+
+// listenerConfigs returns the listeners from flags, or settings, or the default loopback listener.
+func listenerConfigs(ctx context.Context) ([]ListenerConfig, error) {
+	if len(listenOverrides) > 0 {
+		return listenOverrides, nil
+	}
+	value := getSetting(ctx, SettingKeyListeners, "")
+	if value == "" {
+		return defaultListeners, nil
+	}
+	var list []ListenerConfig
+	if err := json.Unmarshal([]byte(value), &list); err != nil {
+		return defaultListeners, fmt.Errorf("invalid %s setting: %w", SettingKeyListeners, err)
+	}
+	if len(list) == 0 {
+		return defaultListeners, nil
+	}
+	return list, nil
+}
+
+// listen opens the listener described by cfg, tlsDir holds the self-signed certificate.
+func listen(cfg ListenerConfig, tlsDir string) (net.Listener, string, error) {
+	var (
+		l   net.Listener
+		err error
+	)
+	switch cfg.Network {
+	case "tcp", "":
+		l, err = net.Listen("tcp", cfg.Address)
+		if err != nil {
+			return nil, "", err
+		}
+	case "unix":
+		l, err = listenUnix(cfg)
+		if err != nil {
+			return nil, "", err
+		}
+	default:
+		return nil, "", fmt.Errorf("unknown network %q", cfg.Network)
+	}
+	if !cfg.TLS {
+		return l, "", nil
+	}
+	cert, err := loadOrCreateCertificate(tlsDir)
+	if err != nil {
+		l.Close()
+		return nil, "", fmt.Errorf("failed to prepare certificate: %w", err)
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	return l, hex.EncodeToString(sum[:]), nil
+}
+
+func listenUnix(cfg ListenerConfig) (net.Listener, error) {
+	mode := os.FileMode(0o600)
+	if cfg.Mode != "" {
+		m, err := strconv.ParseUint(cfg.Mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid socket mode %q", cfg.Mode)
+		}
+		mode = os.FileMode(m)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Address), 0o700); err != nil {
+		return nil, err
+	}
+	// remove the socket left behind by a previous run which didn't exit cleanly
+	if fi, err := os.Lstat(cfg.Address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", cfg.Address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use", cfg.Address)
+		}
+		os.Remove(cfg.Address)
+	}
+	l, err := net.Listen("unix", cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(cfg.Address, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// loadOrCreateCertificate loads the self-signed certificate in dir, a new one is generated when it's
+// missing or about to expire.
+func loadOrCreateCertificate(dir string) (tls.Certificate, error) {
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && time.Until(leaf.NotAfter) > 7*24*time.Hour {
+			return cert, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"tool-hub"}, CommonName: "localhost"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// startListeners serves handler on every configured listener.
+// Failures are reported to the UI with the "hub-listener-error" event instead of stopping the app.
+func startListeners(ctx context.Context, handler http.Handler) {
+	configs, err := listenerConfigs(ctx)
+	if err != nil {
+		runtime.LogError(ctx, err.Error())
+	}
+	tlsDir := filepath.Join(hubDataDir(), "tls")
+
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	listenerStatuses = make([]ListenerStatus, len(configs))
+	for i, cfg := range configs {
+		status := ListenerStatus{ListenerConfig: cfg}
+		l, fingerprint, err := listen(cfg, tlsDir)
+		if err != nil {
+			status.Error = err.Error()
+			listenerStatuses[i] = status
+			reportListenerError(ctx, status)
+			continue
+		}
+		status.Listening = true
+		status.Fingerprint = fingerprint
+		listenerStatuses[i] = status
+		runtime.LogInfof(ctx, "hub listening on %s %s", cfg.Network, cfg.Address)
+
+		network := cfg.Network
+		server := &http.Server{
+			Handler: handler,
+			ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+				return context.WithValue(ctx, listenerNetworkContextKey{}, network)
+			},
+		}
+		listenerServers = append(listenerServers, server)
+		go func(i int, server *http.Server, l net.Listener) {
+			err := server.Serve(l)
+			if err == nil || errors.Is(err, http.ErrServerClosed) {
+				return
+			}
+			listenersMu.Lock()
+			if i < len(listenerStatuses) {
+				listenerStatuses[i].Listening = false
+				listenerStatuses[i].Error = err.Error()
+				reportListenerError(ctx, listenerStatuses[i])
+			}
+			listenersMu.Unlock()
+		}(i, server, l)
+	}
+}
+
+// stopListeners shuts down all servers started by startListeners.
+func stopListeners() {
+	listenersMu.Lock()
+	servers := listenerServers
+	listenerServers = nil
+	listenerStatuses = nil
+	listenersMu.Unlock()
+	for _, server := range servers {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		server.Shutdown(shutdownCtx)
+		cancel()
+	}
+}
+
+func reportListenerError(ctx context.Context, status ListenerStatus) {
+	runtime.LogErrorf(ctx, "hub failed to listen on %s %s: %s", status.Network, status.Address, status.Error)
+	runtime.EventsEmit(ctx, "hub-listener-error", status)
+}
+
+// #region Listener Bindings
+
+type RespGetListenerStatus struct {
+	Error string           `json:"error"`
+	List  []ListenerStatus `json:"list"`
+}
+
+// GetListenerStatus returns the state of every listener, including why it failed to start.
+func (m *Model) GetListenerStatus() (resp RespGetListenerStatus) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	resp.List = append(resp.List, listenerStatuses...)
+	return
+}
+
+type RespRestartListeners struct {
+	Error string `json:"error"`
+}
+
+// RestartListeners stops all listeners and starts the ones currently configured.
+func (m *Model) RestartListeners() (resp RespRestartListeners) {
+	if m.ctx == nil || hubHandler == nil {
+		resp.Error = "hub is not started"
+		return
+	}
+	stopListeners()
+	startListeners(m.ctx, hubHandler)
+	return
+}
+
+// #endregion
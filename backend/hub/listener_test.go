@@ -0,0 +1,81 @@
+package hub
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	cases := map[string]ListenerConfig{
+		"127.0.0.1:9573":                 {Network: "tcp", Address: "127.0.0.1:9573"},
+		"tcp://127.0.0.1:9573":           {Network: "tcp", Address: "127.0.0.1:9573"},
+		"https://localhost:9574":         {Network: "tcp", Address: "localhost:9574", TLS: true},
+		"unix:///tmp/hub.sock?mode=0660": {Network: "unix", Address: "/tmp/hub.sock", Mode: "0660"},
+		"unix://run/hub.sock":            {Network: "unix", Address: "run/hub.sock"},
+	}
+	for in, want := range cases {
+		got, err := ParseListenAddress(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := ParseListenAddress("udp://127.0.0.1:9573")
+	assert.Error(t, err)
+}
+
+func TestListen_unix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hub.sock")
+	l, _, err := listen(ListenerConfig{Network: "unix", Address: path, Mode: "0660"}, dir)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), fi.Mode().Perm())
+
+	// a socket in use must not be taken over
+	_, _, err = listen(ListenerConfig{Network: "unix", Address: path}, dir)
+	assert.ErrorContains(t, err, "in use")
+
+	go http.Serve(l, http.HandlerFunc(pingHandler))
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+	resp, err := client.Get("http://hub/api/ping")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "pong", string(body))
+}
+
+func TestListen_tls(t *testing.T) {
+	dir := t.TempDir()
+	l, fingerprint, err := listen(ListenerConfig{Network: "tcp", Address: "127.0.0.1:0", TLS: true}, dir)
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.Len(t, fingerprint, 64)
+
+	// the certificate is reused by the next listener
+	l2, fingerprint2, err := listen(ListenerConfig{Network: "tcp", Address: "127.0.0.1:0", TLS: true}, dir)
+	assert.NoError(t, err)
+	l2.Close()
+	assert.Equal(t, fingerprint, fingerprint2)
+
+	go http.Serve(l, http.HandlerFunc(pingHandler))
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + l.Addr().String() + "/api/ping")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "pong", string(body))
+}
@@ -2,6 +2,8 @@ package hub
 
 import (
 	"encoding/json"
+
+	"gorm.io/gorm"
 )
 
 type IUpdate interface {
@@ -25,21 +27,40 @@ type BaseModel struct {
 // db schema
 type Tool struct {
 	BaseModel
-	Name          string `json:"name" gorm:"uniqueIndex"`
-	Description   string `json:"description"`
-	Parameters    string `json:"parameters"` // json schema of parameters
-	Category      string `json:"category"`
-	Schema        string `json:"schema"`        // serialized zod schema of parameters for validation
-	Definition    string `json:"definition"`    // typescript definition of parameters
-	Code          string `json:"code"`          // plugin code
-	DefaultParams string `json:"defaultParams"` // default parameters in json format
+	Name          string         `json:"name" gorm:"uniqueIndex"`
+	Description   string         `json:"description"`
+	Parameters    string         `json:"parameters"` // json schema of parameters
+	Category      string         `json:"category"`
+	Schema        string         `json:"schema"`                 // serialized zod schema of parameters for validation
+	Definition    string         `json:"definition"`             // typescript definition of parameters
+	Code          string         `json:"code"`                   // plugin code
+	DefaultParams string         `json:"defaultParams"`          // default parameters in json format
+	DeletedAt     gorm.DeletedAt `json:"deletedAt" gorm:"index"` // soft deleted tools can be restored
+	SourcePath    string         `json:"sourcePath"`             // manifest the tool is synced from, see toolsdir.go
+	SourceMissing bool           `json:"sourceMissing"`          // the manifest was removed from the tools directory
+	Cache         string         `json:"cache"`                  // CachePolicy in JSON format, empty disables caching
+	Status        string         `json:"status"`                 // lifecycle status, see ToolStatusActive, empty means active
+	ReplacedBy    string         `json:"replacedBy"`             // name of the tool replacing a deprecated one
+	DeprecatedAt  int64          `json:"deprecatedAt"`           // unix milli
+	SunsetAt      int64          `json:"sunsetAt"`               // unix milli, calls of a deprecated tool fail from then on, 0 for never
+	Tags          string         `json:"tags"`                   // comma separated tags
+	Requires      string         `json:"requires"`               // ToolRequirements in JSON format, checked by preflightTool
 }
 
+// Lifecycle statuses of tools, see lifecycle.go.
+const (
+	ToolStatusActive     = "active"
+	ToolStatusDraft      = "draft" // registered despite the errors found by lintTool, only called when asked explicitly
+	ToolStatusDeprecated = "deprecated"
+	ToolStatusDisabled   = "disabled"
+)
+
 type CategoryOfTool string
 
 const (
 	CategoryCommandLine CategoryOfTool = "commandLine"
 	CategoryHTTP        CategoryOfTool = "http"
+	CategoryPipeline    CategoryOfTool = "pipeline" // Code is a PipelineDefinition, see pipeline.go
 )
 
 // ToolCategory represents a category of tools.
@@ -58,6 +79,12 @@ type CommandLineToolExtra struct {
 	Cmd   string `json:"cmd"` // "sqlite3 ./hub.db \"SELECT sql FROM sqlite_master WHERE type='table' AND name='dependencies'\"| pg_format > hub.sql"
 	Env   string `json:"env"` // environment variables in JSON format
 	Stdin string `json:"stdin"`
+	// EnvPolicy is "all", "allowlist" or "clean", see cmd.EnvPolicy. Empty uses the EnvPolicy setting.
+	EnvPolicy string `json:"envPolicy"`
+	EnvAllow  string `json:"envAllow"` // comma separated variables inherited in allowlist mode, "LC_*" matches a prefix
+	// Workspace runs the command in a fresh temporary directory seeded with the files of the call, see workspace.go.
+	Workspace bool     `json:"workspace"`
+	Outputs   []string `json:"outputs"` // patterns of the workspace files collected as artifacts, e.g. "out/*.png"
 }
 
 // CommandLineTool represents full info of a command line tool.
@@ -70,6 +97,7 @@ type CommandLineTool struct {
 	Timeout              string               `json:"timeout"`
 	IsStream             bool                 `json:"isStream"`
 	Extra                CommandLineToolExtra `json:"extra"` // extra settings
+	Retry                *RetryPolicy         `json:"retry"` // retries of failed attempts, see retry.go
 }
 
 // matches with tool-hub-cli/utils
@@ -91,6 +119,45 @@ type HTTPTool struct {
 	Timeout              string        `json:"timeout"`
 	IsStream             bool          `json:"isStream"`
 	Extra                HTTPToolExtra `json:"extra"` // extra settings
+	Retry                *RetryPolicy  `json:"retry"` // retries of failed attempts, see retry.go
+}
+
+// CachePolicy opts a tool whose results only depend on its parameters into caching them, see cache.go.
+// not db schema
+type CachePolicy struct {
+	TTL    string   `json:"ttl"`    // how long results are kept, e.g. "10m", an hour when empty
+	Inputs []string `json:"inputs"` // glob patterns of the files results depend on as well, e.g. "/data/*.csv"
+	Hash   bool     `json:"hash"`   // tells input files apart by content instead of size and modification time
+}
+
+// ToolRequirements are what a tool needs from the machine it runs on, see preflight.go.
+// not db schema
+type ToolRequirements struct {
+	Executables []ExecutableRequirement `json:"executables"`
+	Dirs        []string                `json:"dirs"` // directories which should exist
+	Env         []string                `json:"env"`  // environment variables which should be set
+	OS          []string                `json:"os"`   // operating systems the tool runs on, e.g. "darwin", "linux"
+}
+
+// ExecutableRequirement is an executable found on PATH, or at its path when it contains a "/".
+// not db schema
+type ExecutableRequirement struct {
+	Name       string `json:"name"`
+	MinVersion string `json:"minVersion"` // e.g. "1.6", the version is printed by the probe
+	Probe      string `json:"probe"`      // arguments printing the version, "--version" when empty
+}
+
+// RetryPolicy runs the failed attempts of a call again.
+// matches with tool-hub-cli/utils
+// not db schema
+type RetryPolicy struct {
+	MaxAttempts int     `json:"maxAttempts"` // attempts including the first one
+	Backoff     string  `json:"backoff"`     // delay before the second attempt, doubled for each next one, e.g. "200ms"
+	MaxBackoff  string  `json:"maxBackoff"`  // upper bound of the delay
+	Jitter      float64 `json:"jitter"`      // fraction of the delay randomized, between 0 and 1
+	// RetryOn lists the retryable outcomes: "timeout", "crash", "network", "exit:<code>", "http:<status>" or
+	// "http:5xx" for a class of statuses. Empty retries timeouts, crashes, network errors and 5xx statuses.
+	RetryOn []string `json:"retryOn"`
 }
 
 // #endregion
@@ -112,6 +179,244 @@ type ToolTestcase struct {
 	OK       bool   `json:"ok"`
 }
 
+// #region Prompt
+
+// Prompt represents a prompt template stored in db.
+// db schema
+type Prompt struct {
+	BaseModel
+	Name        string `json:"name" gorm:"uniqueIndex"`
+	Description string `json:"description"`
+	Tags        string `json:"tags"`      // comma separated tags
+	Body        string `json:"body"`      // text/template body, e.g. "Review {{.branch}}: {{tool \"git-diff\" `{}`}}"
+	Variables   string `json:"variables"` // declared variables in JSON format, see PromptVariable
+	Version     int    `json:"version"`   // increased whenever body or variables change
+}
+
+// PromptVariable declares a variable which can be filled when rendering a prompt.
+// not db schema
+type PromptVariable struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // "string" (default), "number", "boolean" or "json"
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Default     any    `json:"default"`
+}
+
+// PromptVersion represents a snapshot of a prompt's body and variables.
+// db schema
+type PromptVersion struct {
+	BaseModel
+	PromptID  int    `json:"promptId" gorm:"index"`
+	Version   int    `json:"version"`
+	Body      string `json:"body"`
+	Variables string `json:"variables"`
+}
+
+// #endregion
+
+// #region Clipboard
+
+// ClipboardEntry represents an entry of the clipboard history.
+// db schema
+type ClipboardEntry struct {
+	BaseModel
+	Content     string `json:"content"`
+	ContentType string `json:"contentType"` // MIME type, e.g. "text/plain", "application/json"
+	Source      string `json:"source"`      // "clipboard", "http" or "tool:<name>"
+	Hash        string `json:"hash" gorm:"index"`
+	Pinned      bool   `json:"pinned" gorm:"index"`
+}
+
+// #endregion
+
+// #region Auth
+
+// APIToken represents a token used to authenticate requests to the hub's HTTP API.
+// Only the hash of the token is stored.
+// db schema
+type APIToken struct {
+	BaseModel
+	Name       string `json:"name"`
+	Prefix     string `json:"prefix"`               // leading characters of the token, to tell tokens apart
+	Hash       string `json:"-" gorm:"uniqueIndex"` // sha256 of the token in hex
+	Scopes     string `json:"scopes"`               // comma separated scopes, e.g. "tools:call,tools:register"
+	Tools      string `json:"tools"`                // comma separated names of the tools allowed to call, empty allows all
+	ExpiresAt  int64  `json:"expiresAt"`            // 0 means never
+	LastUsedAt int64  `json:"lastUsedAt"`
+	RevokedAt  int64  `json:"revokedAt"`
+}
+
+// #endregion
+
+// #region Profile
+
+// Profile represents a named environment applied to command line tool calls, see profile.go.
+// db schema
+type Profile struct {
+	BaseModel
+	Name        string `json:"name" gorm:"uniqueIndex"`
+	Description string `json:"description"`
+	Variables   string `json:"variables"` // environment variables as a JSON object of strings
+	Cwd         string `json:"cwd"`       // working directory when the tool doesn't set one
+	Shell       string `json:"shell"`     // shell when the tool doesn't set one
+	Path        string `json:"path"`      // directories prepended to PATH, separated like PATH
+}
+
+// #endregion
+
+// #region Secret
+
+// Secret represents a named secret referenced by tools as ${secret:NAME}, see secret.go.
+// db schema
+type Secret struct {
+	BaseModel
+	Name        string `json:"name" gorm:"uniqueIndex"`
+	Description string `json:"description"`
+	Value       string `json:"-"` // base64 of the AES-GCM nonce and ciphertext
+}
+
+// #endregion
+
+// #region Artifact
+
+// Artifact represents a file produced by a tool call in its workspace, see workspace.go.
+// db schema
+type Artifact struct {
+	BaseModel
+	CallID      string `json:"callId" gorm:"index"`
+	ToolName    string `json:"toolName"`
+	Name        string `json:"name"` // slash separated path relative to the workspace
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	ContentType string `json:"contentType"`
+	Path        string `json:"-"` // where the file is stored
+}
+
+// #endregion
+
+// #region CachedResult
+
+// CachedResult is the output of a call of a tool with a CachePolicy.
+// db schema
+type CachedResult struct {
+	BaseModel
+	Key        string `json:"key" gorm:"uniqueIndex"` // see cacheKey
+	ToolName   string `json:"toolName" gorm:"index"`
+	Output     []byte `json:"-"`
+	Size       int64  `json:"size"`
+	Hits       int    `json:"hits"`
+	ExpiresAt  int64  `json:"expiresAt"`
+	LastUsedAt int64  `json:"lastUsedAt" gorm:"index"`
+}
+
+// #endregion
+
+// #region CallAttempt
+
+// CallAttempt records an attempt of a call made with a retry policy.
+// db schema
+type CallAttempt struct {
+	BaseModel
+	CallID   string `json:"callId" gorm:"index"`
+	ToolName string `json:"toolName"`
+	Attempt  int    `json:"attempt"` // starts at 1
+	Status   string `json:"status"`  // "succeeded" or "failed"
+	Error    string `json:"error"`
+	Outcome  string `json:"outcome"`  // kind of failure, e.g. "timeout", "exit:1", "http:503"
+	Duration int64  `json:"duration"` // in milliseconds
+}
+
+// #endregion
+
+// #region Schedule
+
+// Schedule runs a tool periodically, see schedule.go.
+// db schema
+type Schedule struct {
+	BaseModel
+	Name       string `json:"name" gorm:"uniqueIndex"`
+	ToolName   string `json:"toolName"`
+	Parameters string `json:"parameters"` // parameters of the tool in JSON format
+	Cron       string `json:"cron"`       // cron expression with 5 fields, or a descriptor such as "@daily"
+	Interval   string `json:"interval"`   // duration between runs, e.g. "15m", when Cron is empty
+	Timezone   string `json:"timezone"`   // IANA time zone of Cron, local time when empty
+	Overlap    string `json:"overlap"`    // when the previous run isn't done: "skip" (default), "queue" or "allow"
+	CatchUp    string `json:"catchUp"`    // a run missed while the hub was closed: "once" (default) runs it at start, "skip"
+	Enabled    bool   `json:"enabled"`
+	NextRunAt  int64  `json:"nextRunAt"` // 0 when disabled
+	LastRunAt  int64  `json:"lastRunAt"`
+	LastStatus string `json:"lastStatus"` // "succeeded", "failed" or "skipped"
+	LastError  string `json:"lastError"`
+	LastCallID string `json:"lastCallId"`
+}
+
+// #endregion
+
+// #region Trigger
+
+// Trigger runs a tool when files change, see trigger.go.
+// db schema
+type Trigger struct {
+	BaseModel
+	Name        string `json:"name" gorm:"uniqueIndex"`
+	ToolName    string `json:"toolName"`
+	Paths       string `json:"paths"`       // watched files and directories, one per line, directories are watched recursively
+	Include     string `json:"include"`     // comma separated glob patterns of the changed files, e.g. "*.go", empty matches all
+	Exclude     string `json:"exclude"`     // comma separated glob patterns of ignored files, e.g. "*_test.go"
+	Events      string `json:"events"`      // comma separated kinds among "create", "write", "remove" and "rename", empty means all
+	Debounce    string `json:"debounce"`    // quiet period after the last change before running, e.g. "500ms"
+	Parameters  string `json:"parameters"`  // template of the JSON parameters, e.g. {"files": {{json .paths}}}
+	Concurrency int    `json:"concurrency"` // max concurrent runs, changes made meanwhile are coalesced into the next run, 1 when 0
+	Enabled     bool   `json:"enabled"`
+	LastRunAt   int64  `json:"lastRunAt"`
+	LastStatus  string `json:"lastStatus"` // "succeeded" or "failed"
+	LastError   string `json:"lastError"`
+	LastCallID  string `json:"lastCallId"`
+}
+
+// #endregion
+
+// #region Pipeline
+
+// PipelineDefinition is the code of a pipeline tool, see pipeline.go.
+// not db schema
+type PipelineDefinition struct {
+	Steps  []PipelineStep `json:"steps"`
+	Output string         `json:"output"` // JSON path of the output of the pipeline, the outputs of all steps by id when empty
+}
+
+// PipelineStep calls a tool with parameters mapped from the input of the pipeline and the outputs of previous steps.
+// not db schema
+type PipelineStep struct {
+	ID          string         `json:"id"`
+	Tool        string         `json:"tool"`
+	Params      map[string]any `json:"params"`      // string values starting with "$" are JSON paths
+	When        string         `json:"when"`        // JSON path, the step is skipped unless the value is truthy
+	ForEach     string         `json:"forEach"`     // JSON path of an array, the step is called for every item
+	Concurrency int            `json:"concurrency"` // max concurrent calls of a forEach step, 1 when 0
+	OnError     string         `json:"onError"`     // "fail" (default), "continue" or "retry"
+	Retries     int            `json:"retries"`     // attempts after the first one with "retry", 2 when 0
+}
+
+// PipelineStepResult records a call made by a step of a pipeline.
+// db schema
+type PipelineStepResult struct {
+	BaseModel
+	CallID     string `json:"callId" gorm:"index"`
+	StepCallID string `json:"stepCallId"` // of the call made by the step, its artifacts and attempts are recorded under it
+	Pipeline   string `json:"pipeline"`   // name of the pipeline tool
+	StepID     string `json:"stepId"`
+	Item       int    `json:"item"`   // index of the item of forEach steps, -1 otherwise
+	Status     string `json:"status"` // "succeeded", "failed" or "skipped"
+	Attempts   int    `json:"attempts"`
+	Output     string `json:"output"`
+	Error      string `json:"error"`
+	Duration   int64  `json:"duration"` // milliseconds
+}
+
+// #endregion
+
 func fromMap[T any](m map[string]any) (T, error) {
 	var result T
 	bs, err := json.Marshal(m)
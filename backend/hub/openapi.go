@@ -0,0 +1,297 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// routeDoc documents a route of hubRoutes in the OpenAPI document.
+type routeDoc struct {
+	OperationID string
+	Summary     string
+	Query       []string // names of the string query parameters
+	Request     any      // zero value of the JSON request body or a rawBody, nil when there is no body
+	Response    any      // zero value of the JSON response body or a rawBody, nil for a plain text response
+}
+
+// rawBody documents a non JSON body by its content type.
+type rawBody string
+
+// routeDocs documents hubRoutes, keyed by "METHOD path". Routes missing here are left out of the document.
+var routeDocs = map[string]routeDoc{
+	"GET /api/openapi.json":           {"getOpenAPI", "OpenAPI document of the hub and its tools", nil, nil, map[string]any{}},
+	"POST /api/registerTool":          {"registerTool", "Lint, then create or replace a tool by name", nil, BodyRegisterTool{}, RespRegisterTool{}},
+	"POST /api/callTool":              {"callTool", "Call a tool, the response is the raw output of the tool. Multipart requests may carry files", nil, BodyCallTool{}, nil},
+	"GET /api/tools":                  {"listTools", "Search and list tools", []string{"q", "namespace", "category", "tag", "status", "deleted", "offset", "limit"}, nil, RespQueryTools{}},
+	"POST /api/tools":                 {"createTool", "Lint, then create a tool", []string{"draft"}, Tool{}, RespSaveTool{}},
+	"GET /api/tools/{ref}":            {"getTool", "Get a tool by name or id", []string{"deleted"}, nil, RespSaveTool{}},
+	"PATCH /api/tools/{ref}":          {"updateTool", "Update some fields of a tool, it's linted again when its definition changes", []string{"draft"}, ToolPatch{}, RespSaveTool{}},
+	"DELETE /api/tools/{ref}":         {"deleteTool", "Soft delete a tool", nil, nil, RespSaveTool{}},
+	"POST /api/tools/{ref}/restore":   {"restoreTool", "Restore a soft deleted tool", nil, nil, RespSaveTool{}},
+	"POST /api/tools/{ref}/evaluate":  {"evaluateTool", "Evaluate the plugin of a tool with parameters", nil, BodyEvaluateTool{}, RespEvaluateTool{}},
+	"POST /api/tools/{ref}/call":      {"callToolByRef", "Call a tool with its parameters as the request body", []string{"profile", "draft"}, map[string]any{}, RespCallTool{}},
+	"DELETE /api/tools/{ref}/cache":   {"purgeToolCache", "Remove the cached results of a tool", nil, nil, RespPurgeToolCache{}},
+	"POST /api/tools/{ref}/lifecycle": {"setToolLifecycle", "Activate, deprecate or disable a tool", nil, ToolLifecycle{}, RespSaveTool{}},
+	"POST /api/tools/{ref}/preflight": {"preflightTool", "Check the requirements of a tool on this machine", nil, nil, RespPreflightTool{}},
+	"POST /api/preflight":             {"preflightTools", "Check the requirements of every tool the token may call on this machine", nil, nil, RespPreflightTools{}},
+	"GET /api/clipboard":              {"listClipboard", "Search the clipboard history", []string{"q", "pinned", "offset", "limit"}, nil, RespGetClipboardList{}},
+	"POST /api/clipboard":             {"pushClipboard", "Add an entry to the clipboard history", nil, BodyPushClipboard{}, RespClipboardEntry{}},
+	"POST /api/clipboard/pipe":        {"pipeClipboard", "Pipe a clipboard entry into a tool", nil, BodyPipeClipboard{}, RespClipboardEntry{}},
+	"GET /api/calls/{callId}/steps":   {"listPipelineSteps", "List the results of the steps of a pipeline call", nil, nil, RespGetPipelineStepResults{}},
+	"GET /api/artifacts":              {"listArtifacts", "List the artifacts of a call, or the latest ones", []string{"callId"}, nil, RespGetArtifactList{}},
+	"GET /api/artifacts/{id}":         {"downloadArtifact", "Download the content of an artifact", nil, nil, rawBody("application/octet-stream")},
+	"GET /api/bundle":                 {"exportBundle", "Export tools and their testcases to a bundle", []string{"tools"}, nil, rawBody(bundleContentType)},
+	"POST /api/bundle":                {"importBundle", "Import a bundle of tools", []string{"policy", "dryRun"}, rawBody(bundleContentType), RespImportToolBundle{}},
+	"GET /api/ping":                   {"ping", "Check the hub is up", nil, nil, nil},
+}
+
+// The route serving the document is added in init since the document is built from hubRoutes.
+func init() {
+	hubRoutes = append(hubRoutes, route{http.MethodGet, "/api/openapi.json", ScopeToolsRead, openAPIHandler})
+}
+
+var (
+	openAPIMu       sync.Mutex
+	openAPIDocument []byte // cached until the tool catalog changes
+)
+
+// catalogChanged is called whenever tools are created, updated or deleted.
+func catalogChanged() {
+	hubEvalCache.clear()
+	openAPIMu.Lock()
+	openAPIDocument = nil
+	openAPIMu.Unlock()
+}
+
+// getOpenAPIDocument returns the OpenAPI document, it is generated again after the tool catalog changed.
+func getOpenAPIDocument(ctx context.Context) ([]byte, error) {
+	openAPIMu.Lock()
+	defer openAPIMu.Unlock()
+	if openAPIDocument != nil {
+		return openAPIDocument, nil
+	}
+	tools, err := gorm.G[Tool](db).Order("name").Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := json.Marshal(buildOpenAPI(hubRoutes, tools))
+	if err != nil {
+		return nil, err
+	}
+	openAPIDocument = doc
+	return doc, nil
+}
+
+// buildOpenAPI describes routes and one synthetic call operation per tool.
+func buildOpenAPI(routes []route, tools []Tool) map[string]any {
+	sg := schemaGenerator{schemas: map[string]any{}}
+	paths := map[string]map[string]any{}
+	addOperation := func(path string, method string, op map[string]any) {
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(method)] = op
+	}
+
+	for _, rt := range routes {
+		method := rt.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		doc, ok := routeDocs[method+" "+rt.Path]
+		if !ok {
+			continue
+		}
+		op := map[string]any{
+			"operationId": doc.OperationID,
+			"summary":     doc.Summary,
+		}
+		var params []any
+		for _, name := range pathParameters(rt.Path) {
+			params = append(params, map[string]any{"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+		}
+		for _, name := range doc.Query {
+			params = append(params, map[string]any{"name": name, "in": "query", "schema": map[string]any{"type": "string"}})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if contentType, ok := doc.Request.(rawBody); ok {
+			op["requestBody"] = rawContent(string(contentType), true)
+		} else if doc.Request != nil {
+			op["requestBody"] = jsonContent(sg.schemaOf(reflect.TypeOf(doc.Request)), true)
+		}
+		if contentType, ok := doc.Response.(rawBody); ok {
+			op["responses"] = map[string]any{"200": rawContent(string(contentType), false)}
+		} else if doc.Response != nil {
+			op["responses"] = map[string]any{"200": jsonContent(sg.schemaOf(reflect.TypeOf(doc.Response)), false)}
+		} else {
+			op["responses"] = map[string]any{"200": map[string]any{
+				"description": "OK",
+				"content":     map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}},
+			}}
+		}
+		if rt.Scope != "" {
+			op["security"] = []any{map[string]any{"bearerAuth": []string{rt.Scope}}}
+		}
+		addOperation(rt.Path, method, op)
+	}
+
+	envelope := sg.schemaOf(reflect.TypeOf(RespCallTool{}))
+	for _, tool := range tools {
+		if status := toolStatus(tool); status == ToolStatusDraft || status == ToolStatusDisabled {
+			continue
+		}
+		var parameters any = map[string]any{"type": "object"}
+		if tool.Parameters != "" {
+			var schema map[string]any
+			if err := json.Unmarshal([]byte(tool.Parameters), &schema); err == nil {
+				delete(schema, "$schema")
+				parameters = schema
+			}
+		}
+		op := map[string]any{
+			"operationId": "call_" + tool.Name,
+			"summary":     tool.Description,
+			"tags":        []string{"tools"},
+			"requestBody": jsonContent(parameters, true),
+			"responses":   map[string]any{"200": jsonContent(envelope, false)},
+			"security":    []any{map[string]any{"bearerAuth": []string{ScopeToolsCall}}},
+		}
+		if warning := deprecationWarning(tool); warning != "" {
+			op["deprecated"] = true
+			op["description"] = warning
+		}
+		addOperation("/api/tools/"+url.PathEscape(tool.Name)+"/call", http.MethodPost, op)
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info":    map[string]any{"title": "tool-hub", "version": "1"},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": sg.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+func jsonContent(schema any, isRequest bool) map[string]any {
+	return bodyContent("application/json", schema, isRequest)
+}
+
+func bodyContent(contentType string, schema any, isRequest bool) map[string]any {
+	content := map[string]any{"content": map[string]any{contentType: map[string]any{"schema": schema}}}
+	if isRequest {
+		content["required"] = true
+	} else {
+		content["description"] = "OK"
+	}
+	return content
+}
+
+func rawContent(contentType string, isRequest bool) map[string]any {
+	return bodyContent(contentType, map[string]any{"type": "string", "format": "binary"}, isRequest)
+}
+
+// pathParameters returns the names of the wildcards of a ServeMux pattern.
+func pathParameters(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.TrimSuffix(strings.Trim(segment, "{}"), "..."))
+		}
+	}
+	return names
+}
+
+// schemaGenerator derives JSON schemas from Go types the way encoding/json serializes them,
+// named structs are added to schemas and referenced.
+type schemaGenerator struct {
+	schemas map[string]any
+}
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+func (sg *schemaGenerator) schemaOf(t reflect.Type) any {
+	if t == deletedAtType {
+		return map[string]any{"type": []string{"string", "null"}, "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return sg.schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": sg.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": sg.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sg.structSchema(t)
+		}
+		if _, ok := sg.schemas[t.Name()]; !ok {
+			sg.schemas[t.Name()] = nil // placeholder for recursive types
+			sg.schemas[t.Name()] = sg.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (sg *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	sg.addProperties(t, properties)
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func (sg *schemaGenerator) addProperties(t reflect.Type, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			sg.addProperties(f.Type, properties)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = sg.schemaOf(f.Type)
+	}
+}
+
+func openAPIHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	doc, err := getOpenAPIDocument(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to generate OpenAPI document: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc)
+}
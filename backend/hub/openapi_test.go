@@ -0,0 +1,51 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	setupTestDB(t)
+	catalogChanged()
+	t.Cleanup(catalogChanged)
+	ctx := context.Background()
+
+	_, err := saveTool(ctx, Tool{
+		Name:        "echo",
+		Description: "print text",
+		Parameters:  `{"$schema": "http://json-schema.org/draft-07/schema#", "type": "object", "properties": {"text": {"type": "string"}}}`,
+	})
+	assert.NoError(t, err)
+
+	var doc struct {
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	data, err := getOpenAPIDocument(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &doc))
+	assert.Contains(t, doc.Paths, "/api/tools/{ref}")
+	assert.Contains(t, doc.Paths["/api/tools/{ref}"], "patch")
+	assert.Contains(t, doc.Components.Schemas, "Tool")
+	assert.Contains(t, doc.Components.Schemas, "RespCallTool")
+
+	call := doc.Paths["/api/tools/echo/call"]["post"]
+	assert.Equal(t, "call_echo", call["operationId"])
+	schema := call["requestBody"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"].(map[string]any)
+	assert.Contains(t, schema["properties"], "text")
+	assert.NotContains(t, schema, "$schema")
+
+	// the document follows the catalog
+	_, err = saveTool(ctx, Tool{Name: "fetch"})
+	assert.NoError(t, err)
+	data, err = getOpenAPIDocument(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &doc))
+	assert.Contains(t, doc.Paths, "/api/tools/fetch/call")
+}
@@ -0,0 +1,437 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+
+	"tool-hub/backend/hub/jsonpath"
+)
+
+// A tool of the "pipeline" category composes other tools. Its code is a PipelineDefinition in JSON instead of
+// plugin code, and it's executed by the hub step by step, each step calling its tool like executeToolCall does:
+//
+//	{
+//	  "steps": [
+//	    {"id": "list", "tool": "list-pdfs", "params": {"dir": "$.input.dir"}},
+//	    {"id": "convert", "tool": "pdf2text", "forEach": "$.steps.list.output", "concurrency": 4,
+//	     "params": {"document": "$.item"}, "onError": "continue"},
+//	    {"id": "notify", "tool": "notify", "when": "$.input.notify", "params": {"text": "converted"},
+//	     "onError": "retry", "retries": 3}
+//	  ],
+//	  "output": "$.steps.convert.output"
+//	}
+//
+// String values of params starting with "$" are JSON paths, see package jsonpath, evaluated against
+//
+//	{"input": <parameters of the pipeline>, "steps": {"<id>": {"output": ..., "error": ...}}, "item": ..., "index": ...}
+//
+// where item and index are set in forEach steps, "$$" escapes a leading "$". Outputs of steps are parsed as
+// JSON when they are, they are strings otherwise. Every call made by a step is recorded as PipelineStepResult,
+// under a call id of its own so that the artifacts and attempts of concurrent calls are kept apart.
+//
+// Steps run with the authority of the hub, like the tools called by prompts, so the tools a token may call
+// should include the tools called by the pipelines it may call.
+
+const (
+	stepErrorFail     = "fail"
+	stepErrorContinue = "continue"
+	stepErrorRetry    = "retry"
+
+	defaultStepRetries   = 2
+	maxStepConcurrency   = 16
+	maxPipelineDepth     = 8        // pipelines calling pipelines
+	maxStepResultLength  = 64 << 10 // of the output recorded in PipelineStepResult
+	stepStatusSucceeded  = "succeeded"
+	stepStatusFailed     = "failed"
+	stepStatusSkipped    = "skipped"
+	pipelineItemNotInUse = -1
+)
+
+// pipelineRetryDelay is the delay before the first retry of a step, doubled at every retry. It's 0 in tests.
+var pipelineRetryDelay = time.Second
+
+type pipelineDepthContextKey struct{}
+
+// stepRunner calls the tool of a step, it is executeToolCall outside of tests.
+type stepRunner func(ctx context.Context, call toolCall) ([]byte, error)
+
+// parsePipeline parses and validates the definition of a pipeline.
+func parsePipeline(code string) (PipelineDefinition, error) {
+	var def PipelineDefinition
+	if err := json.Unmarshal([]byte(code), &def); err != nil {
+		return def, fmt.Errorf("invalid pipeline definition: %w", err)
+	}
+	if len(def.Steps) == 0 {
+		return def, fmt.Errorf("pipeline has no steps")
+	}
+	seen := map[string]bool{}
+	for i, step := range def.Steps {
+		if step.ID == "" {
+			return def, fmt.Errorf("step %d has no id", i)
+		}
+		if seen[step.ID] {
+			return def, fmt.Errorf("duplicated step %q", step.ID)
+		}
+		seen[step.ID] = true
+		if step.Tool == "" {
+			return def, fmt.Errorf("step %q has no tool", step.ID)
+		}
+		switch step.OnError {
+		case "", stepErrorFail, stepErrorContinue, stepErrorRetry:
+		default:
+			return def, fmt.Errorf("step %q has unknown onError %q", step.ID, step.OnError)
+		}
+		if step.Concurrency < 0 || step.Concurrency > maxStepConcurrency {
+			return def, fmt.Errorf("step %q: concurrency should be between 1 and %d", step.ID, maxStepConcurrency)
+		}
+		for _, expr := range []string{step.When, step.ForEach} {
+			if expr != "" {
+				if _, err := jsonpath.Compile(expr); err != nil {
+					return def, fmt.Errorf("step %q: %w", step.ID, err)
+				}
+			}
+		}
+		if err := validateStepParams(step.Params); err != nil {
+			return def, fmt.Errorf("step %q: %w", step.ID, err)
+		}
+	}
+	if def.Output != "" {
+		if _, err := jsonpath.Compile(def.Output); err != nil {
+			return def, fmt.Errorf("output: %w", err)
+		}
+	}
+	return def, nil
+}
+
+func validateStepParams(v any) error {
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(v, "$") && !strings.HasPrefix(v, "$$") {
+			_, err := jsonpath.Compile(v)
+			return err
+		}
+	case map[string]any:
+		for _, item := range v {
+			if err := validateStepParams(item); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := validateStepParams(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveStepParams replaces the JSON paths in v by their value in scope.
+func resolveStepParams(v any, scope map[string]any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(v, "$$") {
+			return v[1:], nil
+		}
+		if strings.HasPrefix(v, "$") {
+			return jsonpath.Get(scope, v)
+		}
+		return v, nil
+	case map[string]any:
+		resolved := make(map[string]any, len(v))
+		for k, item := range v {
+			value, err := resolveStepParams(item, scope)
+			if err != nil {
+				return nil, err
+			}
+			resolved[k] = value
+		}
+		return resolved, nil
+	case []any:
+		resolved := make([]any, len(v))
+		for i, item := range v {
+			value, err := resolveStepParams(item, scope)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = value
+		}
+		return resolved, nil
+	}
+	return v, nil
+}
+
+// truthy tells whether the value of a "when" expression lets its step run.
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return true
+}
+
+// parseStepOutput returns the output of a tool as JSON when it is, as a string otherwise.
+func parseStepOutput(out []byte) any {
+	var v any
+	if json.Unmarshal(out, &v) == nil {
+		return v
+	}
+	return string(out)
+}
+
+// runPipeline executes the pipeline tool with the parameters of call and returns its output in JSON.
+func runPipeline(ctx context.Context, tool Tool, call toolCall, run stepRunner) ([]byte, error) {
+	depth, _ := ctx.Value(pipelineDepthContextKey{}).(int)
+	if depth >= maxPipelineDepth {
+		return nil, fmt.Errorf("pipelines are nested more than %d levels", maxPipelineDepth)
+	}
+	ctx = context.WithValue(ctx, pipelineDepthContextKey{}, depth+1)
+
+	def, err := parsePipeline(tool.Code)
+	if err != nil {
+		return nil, err
+	}
+	var input any = map[string]any{}
+	if strings.TrimSpace(call.Parameters) != "" {
+		if err := json.Unmarshal([]byte(call.Parameters), &input); err != nil {
+			return nil, fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
+	p := pipelineRun{tool: tool, call: call, run: run}
+	steps := map[string]any{}
+	scope := map[string]any{"input": input, "steps": steps}
+	for _, step := range def.Steps {
+		result, err := p.runStep(ctx, step, scope)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", step.ID, err)
+		}
+		steps[step.ID] = result
+	}
+
+	var output any
+	if def.Output != "" {
+		if output, err = jsonpath.Get(scope, def.Output); err != nil {
+			return nil, fmt.Errorf("output: %w", err)
+		}
+	} else {
+		outputs := make(map[string]any, len(steps))
+		for id, result := range steps {
+			outputs[id] = result.(map[string]any)["output"]
+		}
+		output = outputs
+	}
+	return json.Marshal(output)
+}
+
+// pipelineRun holds what the steps of a pipeline call share.
+type pipelineRun struct {
+	tool Tool
+	call toolCall
+	run  stepRunner
+}
+
+// runStep runs a step and returns its result in the scope of the next steps, an error fails the pipeline.
+func (p *pipelineRun) runStep(ctx context.Context, step PipelineStep, scope map[string]any) (map[string]any, error) {
+	if step.When != "" {
+		v, err := jsonpath.Get(scope, step.When)
+		if err != nil && !errors.Is(err, jsonpath.ErrNotFound) {
+			return nil, err
+		}
+		if !truthy(v) {
+			err := p.record(ctx, PipelineStepResult{StepID: step.ID, Item: pipelineItemNotInUse, Status: stepStatusSkipped})
+			return map[string]any{"output": nil, "skipped": true}, err
+		}
+	}
+
+	if step.ForEach == "" {
+		output, err := p.callStep(ctx, step, scope, pipelineItemNotInUse)
+		if err != nil {
+			if step.OnError != stepErrorContinue {
+				return nil, err
+			}
+			return map[string]any{"output": nil, "error": err.Error()}, nil
+		}
+		return map[string]any{"output": output}, nil
+	}
+
+	v, err := jsonpath.Get(scope, step.ForEach)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("forEach %s is not an array", step.ForEach)
+	}
+	concurrency := max(step.Concurrency, 1)
+	outputs := make([]any, len(items))
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		itemScope := forEachScope(scope, item, i)
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			outputs[i], errs[i] = p.callStep(ctx, step, itemScope, i)
+		}()
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("item %d: %v", i, err))
+		}
+	}
+	if len(failed) == 0 {
+		return map[string]any{"output": outputs}, nil
+	}
+	err = fmt.Errorf("%d of %d items failed: %s", len(failed), len(items), strings.Join(failed, "; "))
+	if step.OnError != stepErrorContinue {
+		return nil, err
+	}
+	return map[string]any{"output": outputs, "error": err.Error()}, nil
+}
+
+// forEachScope returns scope with the item of a forEach step and its index, a float64 like the numbers of
+// decoded JSON so that truthy and the JSON paths see the same values as in outputs.
+func forEachScope(scope map[string]any, item any, index int) map[string]any {
+	itemScope := make(map[string]any, len(scope)+2)
+	for k, v := range scope {
+		itemScope[k] = v
+	}
+	itemScope["item"] = item
+	itemScope["index"] = float64(index)
+	return itemScope
+}
+
+// callStep calls the tool of a step once, or until it succeeds with the "retry" policy, and records the result.
+func (p *pipelineRun) callStep(ctx context.Context, step PipelineStep, scope map[string]any, item int) (any, error) {
+	result := PipelineStepResult{StepID: step.ID, Item: item, StepCallID: newCallID()}
+	start := time.Now()
+	output, err := p.attemptStep(ctx, step, scope, &result)
+	result.Duration = time.Since(start).Milliseconds()
+	result.Status = stepStatusSucceeded
+	if err != nil {
+		result.Status = stepStatusFailed
+		result.Error = err.Error()
+	}
+	if recordErr := p.record(ctx, result); recordErr != nil && err == nil {
+		err = recordErr
+	}
+	return output, err
+}
+
+func (p *pipelineRun) attemptStep(ctx context.Context, step PipelineStep, scope map[string]any, result *PipelineStepResult) (any, error) {
+	params, err := resolveStepParams(step.Params, scope)
+	if err != nil {
+		return nil, err
+	}
+	if params == nil {
+		params = map[string]any{}
+	}
+	parameters, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	attempts := 1
+	if step.OnError == stepErrorRetry {
+		attempts += defaultStepRetries
+		if step.Retries > 0 {
+			attempts = 1 + step.Retries
+		}
+	}
+	delay := pipelineRetryDelay
+	for {
+		result.Attempts++
+		out, err := p.run(ctx, toolCall{Name: step.Tool, Parameters: string(parameters), Profile: p.call.Profile, CallID: result.StepCallID})
+		result.Output = truncateStepOutput(out)
+		if err == nil {
+			return parseStepOutput(out), nil
+		}
+		if result.Attempts >= attempts || errors.Is(err, errToolNotFound) || errors.Is(err, errToolNotReady) || isLifecycleError(err) {
+			return nil, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func truncateStepOutput(out []byte) string {
+	if len(out) > maxStepResultLength {
+		return string(out[:maxStepResultLength])
+	}
+	return string(out)
+}
+
+func (p *pipelineRun) record(ctx context.Context, result PipelineStepResult) error {
+	result.CallID = p.call.CallID
+	result.Pipeline = p.tool.Name
+	return gorm.G[PipelineStepResult](db).Create(ctx, &result)
+}
+
+func listPipelineStepResults(ctx context.Context, callID string) ([]PipelineStepResult, error) {
+	return gorm.G[PipelineStepResult](db).Where("call_id = ?", callID).Order("id").Find(ctx)
+}
+
+// RespGetPipelineStepResults is the result of GET /api/calls/{callId}/steps and GetPipelineStepResults.
+type RespGetPipelineStepResults struct {
+	Error string               `json:"error"`
+	List  []PipelineStepResult `json:"list"`
+}
+
+// listPipelineStepsHandler lists the results of the steps of a pipeline call whose pipeline the token may call.
+func listPipelineStepsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	list, err := listPipelineStepResults(ctx, r.PathValue("callId"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, RespGetPipelineStepResults{Error: err.Error()})
+		return
+	}
+	resp := RespGetPipelineStepResults{List: []PipelineStepResult{}}
+	for _, result := range list {
+		if requestAllowsTool(r, result.Pipeline) {
+			resp.List = append(resp.List, result)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// #region Pipeline Bindings
+
+// GetPipelineStepResults returns the results of the steps of a pipeline call.
+func (m *Model) GetPipelineStepResults(callID string) (resp RespGetPipelineStepResults) {
+	var err error
+	resp.List, err = listPipelineStepResults(m.ctx, callID)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to list pipeline steps: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// #endregion
@@ -0,0 +1,148 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tool-hub/backend/hub/jsonpath"
+)
+
+func TestParsePipeline(t *testing.T) {
+	_, err := parsePipeline(`{"steps": [{"id": "a", "tool": "echo", "params": {"x": "$.input.x"}}]}`)
+	assert.NoError(t, err)
+
+	for _, code := range []string{
+		`not json`,
+		`{"steps": []}`,
+		`{"steps": [{"tool": "echo"}]}`,
+		`{"steps": [{"id": "a", "tool": "echo"}, {"id": "a", "tool": "echo"}]}`,
+		`{"steps": [{"id": "a"}]}`,
+		`{"steps": [{"id": "a", "tool": "echo", "onError": "ignore"}]}`,
+		`{"steps": [{"id": "a", "tool": "echo", "when": "input.x"}]}`,
+		`{"steps": [{"id": "a", "tool": "echo", "params": {"x": ["$["]}}]}`,
+	} {
+		_, err := parsePipeline(code)
+		assert.Error(t, err, code)
+	}
+
+	setupTestDB(t)
+	_, err = createTool(context.Background(), Tool{Name: "broken", Category: string(CategoryPipeline), Code: `{"steps": []}`})
+	assert.ErrorIs(t, err, errInvalidTool)
+}
+
+func TestRunPipeline(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	old := pipelineRetryDelay
+	pipelineRetryDelay = 0
+	defer func() { pipelineRetryDelay = old }()
+
+	var (
+		mu          sync.Mutex
+		flakyCalls  int
+		running     int32
+		maxRunning  int32
+		notifyCalls []string
+		callIDs     = map[string]int{} // calls made under each call id
+	)
+	run := func(ctx context.Context, call toolCall) ([]byte, error) {
+		var params map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(call.Parameters), &params))
+		mu.Lock()
+		callIDs[call.CallID]++
+		mu.Unlock()
+		switch call.Name {
+		case "list":
+			return []byte(`{"files": ["a.pdf", "b.pdf", "bad.pdf", "c.pdf"]}`), nil
+		case "convert":
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			mu.Lock()
+			maxRunning = max(maxRunning, n)
+			mu.Unlock()
+			if params["document"] == "bad.pdf" {
+				return nil, errors.New("corrupted")
+			}
+			return []byte(fmt.Sprintf("text of %s", params["document"])), nil
+		case "flaky":
+			mu.Lock()
+			defer mu.Unlock()
+			if flakyCalls++; flakyCalls < 3 {
+				return nil, errors.New("unavailable")
+			}
+			return []byte(`"ok"`), nil
+		case "notify":
+			notifyCalls = append(notifyCalls, params["text"].(string))
+			return []byte(`{}`), nil
+		}
+		return nil, errToolNotFound
+	}
+
+	pipeline := Tool{Name: "convert-all", Category: string(CategoryPipeline), Code: `{
+		"steps": [
+			{"id": "list", "tool": "list", "params": {"dir": "$.input.dir"}},
+			{"id": "convert", "tool": "convert", "forEach": "$.steps.list.output.files", "concurrency": 2,
+			 "params": {"document": "$.item", "index": "$.index"}, "onError": "continue"},
+			{"id": "flaky", "tool": "flaky", "onError": "retry", "retries": 3},
+			{"id": "skipped", "tool": "notify", "when": "$.input.quiet", "params": {"text": "never"}},
+			{"id": "notify", "tool": "notify", "when": "$.steps.flaky.output", "params": {"text": "$$ done"}}
+		],
+		"output": "$.steps.convert.output"
+	}`}
+	out, err := runPipeline(ctx, pipeline, toolCall{Name: "convert-all", Parameters: `{"dir": "/docs"}`, CallID: "call1"}, run)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `["text of a.pdf", "text of b.pdf", null, "text of c.pdf"]`, string(out))
+	assert.LessOrEqual(t, maxRunning, int32(2), "forEach should respect the concurrency")
+	assert.Equal(t, 3, flakyCalls)
+	assert.Equal(t, []string{"$ done"}, notifyCalls)
+
+	results, err := listPipelineStepResults(ctx, "call1")
+	assert.NoError(t, err)
+	statuses := map[string]int{}
+	for _, r := range results {
+		assert.Equal(t, "convert-all", r.Pipeline)
+		statuses[r.StepID+":"+r.Status]++
+		if r.StepID == "flaky" {
+			assert.Equal(t, 3, r.Attempts)
+		}
+		if r.Status != stepStatusSkipped {
+			assert.Equal(t, r.Attempts, callIDs[r.StepCallID], "every step call should have a call id of its own")
+		}
+	}
+	assert.Len(t, callIDs, 7)
+	assert.NotContains(t, callIDs, "call1")
+	assert.Equal(t, map[string]int{
+		"list:succeeded":    1,
+		"convert:succeeded": 3,
+		"convert:failed":    1,
+		"flaky:succeeded":   1,
+		"skipped:skipped":   1,
+		"notify:succeeded":  1,
+	}, statuses)
+
+	// the default policy fails the pipeline
+	pipeline.Code = `{"steps": [{"id": "convert", "tool": "convert", "params": {"document": "bad.pdf"}}]}`
+	_, err = runPipeline(ctx, pipeline, toolCall{CallID: "call1"}, run)
+	assert.ErrorContains(t, err, "step convert: corrupted")
+
+	pipeline.Code = `{"steps": [{"id": "convert", "tool": "convert", "params": {"document": "$.input.missing"}}]}`
+	_, err = runPipeline(ctx, pipeline, toolCall{CallID: "call1"}, run)
+	assert.Error(t, err)
+
+	_, err = runPipeline(context.WithValue(ctx, pipelineDepthContextKey{}, maxPipelineDepth), pipeline, toolCall{CallID: "call1"}, run)
+	assert.ErrorContains(t, err, "nested")
+
+	// the index of the first item is falsy like a decoded 0
+	for i, want := range []bool{false, true} {
+		index, err := jsonpath.Get(forEachScope(map[string]any{}, "a.pdf", i), "$.index")
+		assert.NoError(t, err)
+		assert.Equal(t, want, truthy(index), i)
+	}
+}
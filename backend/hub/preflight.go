@@ -0,0 +1,460 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	goruntime "runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+
+	"tool-hub/backend/hub/cmd"
+)
+
+// Tool catalogs are shared between machines, where the shell, the executable or the working directory of
+// a command line tool may not exist. Tools also declare what else they need in Requires, see ToolRequirements.
+// preflightTool checks all of these requirements:
+//
+//   - when a tool is registered, see registerTool
+//   - for every tool once the frontend is ready at startup, see FrontendReady
+//   - on demand, through POST /api/tools/{ref}/preflight, POST /api/preflight and the bindings
+//
+// Results are kept in memory for the version of the tool they were checked for and listed with the tools.
+// Calls of a tool whose latest result reports missing requirements check them again and fail with
+// errToolNotReady while they are still missing, instead of failing in the middle of the command.
+
+var errToolNotReady = errors.New("tool requirements are missing")
+
+const (
+	preflightConcurrency  = 4
+	preflightProbeTimeout = 5 * time.Second
+)
+
+// PreflightResult reports the requirements of a tool missing on this machine.
+type PreflightResult struct {
+	Ready     bool     `json:"ready"`
+	Status    string   `json:"status"`    // "ready", "missing ..." or "error: ..."
+	Missing   []string `json:"missing"`   // e.g. "executable jq", "jq >= 1.6, found 1.5"
+	Error     string   `json:"error"`     // the requirements couldn't be checked, e.g. the plugin failed
+	CheckedAt int64    `json:"checkedAt"` // unix milli
+}
+
+func newPreflightResult(missing []string, err error) PreflightResult {
+	result := PreflightResult{Missing: missing, CheckedAt: time.Now().UnixMilli()}
+	switch {
+	case err != nil:
+		result.Error = err.Error()
+		result.Status = "error: " + result.Error
+	case len(missing) > 0:
+		result.Status = "missing " + strings.Join(missing, ", ")
+	default:
+		result.Ready = true
+		result.Status = "ready"
+	}
+	return result
+}
+
+// parseRequirements parses the requirements of a tool, empty when it declares none.
+func parseRequirements(s string) (ToolRequirements, error) {
+	var req ToolRequirements
+	if s == "" || s == "null" {
+		return req, nil
+	}
+	if err := json.Unmarshal([]byte(s), &req); err != nil {
+		return req, fmt.Errorf("invalid requirements: %w", err)
+	}
+	for _, exe := range req.Executables {
+		if strings.TrimSpace(exe.Name) == "" {
+			return req, fmt.Errorf("invalid requirements: executable name is required")
+		}
+		if exe.MinVersion != "" && parseVersion(exe.MinVersion) == nil {
+			return req, fmt.Errorf("invalid requirements: invalid minimum version %q of %s", exe.MinVersion, exe.Name)
+		}
+	}
+	return req, nil
+}
+
+type preflightEntry struct {
+	updatedAt int64
+	result    PreflightResult
+}
+
+// preflightCache keeps the latest preflight result of each tool.
+type preflightCache struct {
+	mu      sync.Mutex
+	entries map[int]preflightEntry
+}
+
+var hubPreflight = &preflightCache{entries: map[int]preflightEntry{}}
+
+// get returns the result of the tool id, as long as the tool wasn't updated since it was checked.
+func (c *preflightCache) get(id int, updatedAt int64) (PreflightResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	if !ok || e.updatedAt != updatedAt {
+		return PreflightResult{}, false
+	}
+	return e.result, true
+}
+
+func (c *preflightCache) put(tool Tool, result PreflightResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[tool.ID] = preflightEntry{updatedAt: tool.UpdatedAt, result: result}
+}
+
+// preflightTool checks the requirements of tool with its default parameters and the active profile,
+// and keeps the result for listing tools.
+func preflightTool(ctx context.Context, tool Tool) PreflightResult {
+	var toolData json.RawMessage
+	var err error
+	if CategoryOfTool(tool.Category) == CategoryCommandLine {
+		parameters := tool.DefaultParams
+		if parameters == "" {
+			parameters = "{}"
+		}
+		toolData, err = EvalTool(ctx, tool.Code, parameters)
+		if err != nil {
+			err = fmt.Errorf("tool evaluation failed: %w", err)
+		}
+	}
+	var missing []string
+	if err == nil {
+		missing, err = missingRequirements(ctx, tool, toolData, "")
+	}
+	result := newPreflightResult(missing, err)
+	hubPreflight.put(tool, result)
+	return result
+}
+
+// preflightStoredTool checks the requirements of a tool which was just stored, so that it's listed as ready or
+// not without waiting for the next start. Drafts aren't checked, nil is returned for them.
+func preflightStoredTool(ctx context.Context, tool Tool) *PreflightResult {
+	if tool.Status == ToolStatusDraft {
+		return nil
+	}
+	result := preflightTool(ctx, tool)
+	return &result
+}
+
+// checkToolReady fails a call of tool with errToolNotReady when its latest preflight result reports missing
+// requirements which are still missing for the evaluated tool and the profile of the call.
+// Tools which weren't checked or were ready are called without checking anything.
+func checkToolReady(ctx context.Context, tool Tool, toolData json.RawMessage, profile string) error {
+	result, ok := hubPreflight.get(tool.ID, tool.UpdatedAt)
+	if !ok || result.Ready {
+		return nil
+	}
+	missing, err := missingRequirements(ctx, tool, toolData, profile)
+	if err != nil || len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s: %s", errToolNotReady, tool.Name, strings.Join(missing, ", "))
+}
+
+// missingRequirements returns the requirements of tool missing on this machine: the declared ones,
+// and for command line tools the ones implied by the evaluated tool once the profile is applied.
+func missingRequirements(ctx context.Context, tool Tool, toolData json.RawMessage, profile string) ([]string, error) {
+	req, err := parseRequirements(tool.Requires)
+	if err != nil {
+		return nil, err
+	}
+	var options cmd.StreamOptions
+	if CategoryOfTool(tool.Category) == CategoryCommandLine && toolData != nil {
+		var commandLineTool CommandLineTool
+		if err := json.Unmarshal(toolData, &commandLineTool); err != nil {
+			return nil, fmt.Errorf("failed to parse tool response: %w", err)
+		}
+		extra := commandLineTool.Extra
+		options = cmd.StreamOptions{Cwd: extra.WD, Shell: extra.Sh}
+		if extra.Env != "" {
+			json.Unmarshal([]byte(extra.Env), &options.Env)
+		}
+		p, err := resolveProfile(ctx, profile)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			if err := applyProfile(*p, &options); err != nil {
+				return nil, err
+			}
+		}
+		var implied []ExecutableRequirement
+		if options.Shell != "" {
+			implied = append(implied, ExecutableRequirement{Name: options.Shell})
+		} else if name := strings.TrimSpace(extra.Cmd); name != "" {
+			implied = append(implied, ExecutableRequirement{Name: name})
+		}
+		req.Executables = append(implied, req.Executables...)
+		if options.Cwd != "" && !extra.Workspace {
+			req.Dirs = append([]string{options.Cwd}, req.Dirs...)
+		}
+	}
+	return checkRequirements(ctx, req, options.Cwd, options.Env), nil
+}
+
+// checkRequirements returns the requirements of req missing on this machine. Relative executables are
+// looked up in wd, env overrides the environment of the hub, PATH included.
+func checkRequirements(ctx context.Context, req ToolRequirements, wd string, env map[string]string) []string {
+	var missing []string
+	if len(req.OS) > 0 && !containsFold(req.OS, goruntime.GOOS) {
+		missing = append(missing, fmt.Sprintf("os %s, running on %s", strings.Join(req.OS, " or "), goruntime.GOOS))
+	}
+	path, ok := env["PATH"]
+	if !ok {
+		path = os.Getenv("PATH")
+	}
+	seen := map[string]bool{}
+	for _, exe := range req.Executables {
+		if seen[exe.Name+"\x00"+exe.MinVersion] {
+			continue
+		}
+		seen[exe.Name+"\x00"+exe.MinVersion] = true
+		file, err := findExecutable(exe.Name, wd, path)
+		if err != nil {
+			missing = append(missing, "executable "+exe.Name)
+			continue
+		}
+		if exe.MinVersion == "" {
+			continue
+		}
+		version, err := probeVersion(ctx, file, exe.Probe)
+		if err != nil {
+			missing = append(missing, fmt.Sprintf("%s >= %s, version unknown: %v", exe.Name, exe.MinVersion, err))
+		} else if compareVersions(parseVersion(version), parseVersion(exe.MinVersion)) < 0 {
+			missing = append(missing, fmt.Sprintf("%s >= %s, found %s", exe.Name, exe.MinVersion, version))
+		}
+	}
+	for _, dir := range req.Dirs {
+		if fi, err := os.Stat(expandHome(dir)); err != nil || !fi.IsDir() {
+			missing = append(missing, "directory "+dir)
+		}
+	}
+	for _, name := range req.Env {
+		if _, ok := env[name]; ok {
+			continue
+		}
+		if _, ok := os.LookupEnv(name); !ok {
+			missing = append(missing, "environment variable "+name)
+		}
+	}
+	return missing
+}
+
+// findExecutable is lookExecutable searching the directories of path instead of the PATH of the hub.
+func findExecutable(name string, wd string, path string) (string, error) {
+	if strings.ContainsRune(name, '/') || path == os.Getenv("PATH") {
+		return lookExecutable(expandHome(name), wd)
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		if file, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", name, exec.ErrNotFound)
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + path[1:]
+		}
+	}
+	return path
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), s) {
+			return true
+		}
+	}
+	return false
+}
+
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)*`)
+
+// probeVersion runs the executable file with the probe arguments, "--version" when empty,
+// and returns the first version its output mentions.
+func probeVersion(ctx context.Context, file string, probe string) (string, error) {
+	if probe == "" {
+		probe = "--version"
+	}
+	ctx, cancel := context.WithTimeout(ctx, preflightProbeTimeout)
+	defer cancel()
+	// many tools exit with an error status after printing their version, so only the output matters
+	out, _ := exec.CommandContext(ctx, file, strings.Fields(probe)...).CombinedOutput()
+	version := versionPattern.FindString(string(out))
+	if version == "" {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%s %s timed out", filepath.Base(file), probe)
+		}
+		return "", fmt.Errorf("%s %s printed no version", filepath.Base(file), probe)
+	}
+	return version, nil
+}
+
+// parseVersion returns the numbers of the first version in s, nil when there is none.
+func parseVersion(s string) []int {
+	var numbers []int
+	for _, part := range strings.Split(versionPattern.FindString(s), ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+// compareVersions compares versions number by number, missing numbers are 0, e.g. 1.6 == 1.6.0 < 1.10.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// ToolPreflight is the preflight result of a tool.
+type ToolPreflight struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	PreflightResult
+}
+
+// preflightTools checks the requirements of every tool allows accepts, or of every tool when allows is nil, a
+// few tools at a time.
+func preflightTools(ctx context.Context, allows func(name string) bool) ([]ToolPreflight, error) {
+	tools, err := gorm.G[Tool](db).Order("name").Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if allows != nil {
+		tools = slices.DeleteFunc(tools, func(tool Tool) bool { return !allows(tool.Name) })
+	}
+	results := make([]ToolPreflight, len(tools))
+	sem := make(chan struct{}, preflightConcurrency)
+	var wg sync.WaitGroup
+	for i, tool := range tools {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			results[i] = ToolPreflight{ID: tool.ID, Name: tool.Name, PreflightResult: preflightTool(ctx, tool)}
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// startPreflight checks the requirements of every tool in the background.
+func startPreflight(ctx context.Context) {
+	go func() {
+		results, err := preflightTools(ctx, nil)
+		if err != nil {
+			runtime.LogErrorf(ctx, "failed to check the requirements of tools: %v", err)
+			return
+		}
+		for _, result := range results {
+			if !result.Ready {
+				runtime.LogWarningf(ctx, "tool %s: %s", result.Name, result.Status)
+			}
+		}
+	}()
+}
+
+// RespPreflightTool is the response of POST /api/tools/{ref}/preflight.
+type RespPreflightTool struct {
+	Error  string          `json:"error"`
+	Result PreflightResult `json:"result"`
+}
+
+// RespPreflightTools is the response of POST /api/preflight.
+type RespPreflightTools struct {
+	Error string          `json:"error"`
+	List  []ToolPreflight `json:"list"`
+}
+
+func preflightToolHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	tool, err := findTool(ctx, r.PathValue("ref"), false)
+	if err != nil {
+		writeJSON(w, toolErrorStatus(err), RespPreflightTool{Error: err.Error()})
+		return
+	}
+	if !requestAllowsTool(r, tool.Name) {
+		writeJSON(w, http.StatusForbidden, RespPreflightTool{Error: fmt.Sprintf("token may not call tool %s", tool.Name)})
+		return
+	}
+	writeJSON(w, http.StatusOK, RespPreflightTool{Result: preflightTool(ctx, tool)})
+}
+
+func preflightToolsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	list, err := preflightTools(ctx, func(name string) bool { return requestAllowsTool(r, name) })
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, RespPreflightTools{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, RespPreflightTools{List: list})
+}
+
+// #region Preflight Bindings
+
+// PreflightTool checks the requirements of a tool on this machine.
+func (m *Model) PreflightTool(id int) (resp RespPreflightTool) {
+	tool, err := findTool(m.ctx, strconv.Itoa(id), false)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to check the requirements of the tool: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	resp.Result = preflightTool(m.ctx, tool)
+	return
+}
+
+// PreflightTools checks the requirements of every tool on this machine.
+func (m *Model) PreflightTools() (resp RespPreflightTools) {
+	var err error
+	resp.List, err = preflightTools(m.ctx, nil)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to check the requirements of tools: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// #endregion
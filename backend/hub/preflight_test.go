@@ -0,0 +1,122 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, []int{1, 6}, parseVersion("jq-1.6"))
+	assert.Equal(t, []int{3, 45, 1}, parseVersion("3.45.1 2024-01-30 sqlite"))
+	assert.Nil(t, parseVersion("unknown"))
+	assert.Equal(t, 0, compareVersions([]int{1, 6}, []int{1, 6, 0}))
+	assert.Equal(t, -1, compareVersions([]int{1, 6}, []int{1, 10}))
+	assert.Equal(t, 1, compareVersions([]int{2}, []int{1, 99}))
+}
+
+func TestPreflightTool(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalCache), "false").Error)
+	fakeEvalFrontend(t, func(r EvalToolRequestEvent) {
+		deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Success: true, Tool: json.RawMessage(r.Code)})
+	})
+	dir := t.TempDir()
+	probe := filepath.Join(dir, "fake-jq")
+	assert.NoError(t, os.WriteFile(probe, []byte("#!/bin/sh\necho jq-1.5.2\n"), 0o755))
+	t.Setenv("TOOL_HUB_PREFLIGHT_TOKEN", "x")
+
+	_, err := createTool(ctx, Tool{Name: "bad", Category: "commandLine", Requires: `{"executables": [{"name": ""}]}`})
+	assert.ErrorIs(t, err, errInvalidTool)
+
+	requires := `{
+		"executables": [{"name": "` + probe + `", "minVersion": "1.5"}, {"name": "tool-hub-missing-command"}],
+		"dirs": ["` + dir + `"],
+		"env": ["TOOL_HUB_PREFLIGHT_TOKEN", "TOOL_HUB_PREFLIGHT_MISSING"],
+		"os": ["` + goruntime.GOOS + `"]
+	}`
+	tool, err := createTool(ctx, Tool{Name: "fetch", Category: "http", Code: `{"extra": {"url": "http://example.com"}}`, Requires: requires})
+	assert.NoError(t, err)
+	result := preflightTool(ctx, tool)
+	assert.False(t, result.Ready)
+	assert.Equal(t, []string{"executable tool-hub-missing-command", "environment variable TOOL_HUB_PREFLIGHT_MISSING"}, result.Missing)
+
+	requires = `{"executables": [{"name": "` + probe + `", "minVersion": "1.6"}], "os": ["plan9"]}`
+	tool, _, err = updateTool(ctx, "fetch", ToolPatch{Requires: &requires}, false)
+	assert.NoError(t, err)
+	result = preflightTool(ctx, tool)
+	assert.Equal(t, []string{"os plan9, running on " + goruntime.GOOS, probe + " >= 1.6, found 1.5.2"}, result.Missing)
+
+	// the shell, the executable and the working directory of command line tools are required as well
+	list, err := createTool(ctx, Tool{Name: "list", Category: "commandLine", Code: `{"extra": {"cmd": "tool-hub-missing-command", "wd": "/tool-hub-missing-dir"}}`})
+	assert.NoError(t, err)
+	result = preflightTool(ctx, list)
+	assert.Equal(t, "missing executable tool-hub-missing-command, directory /tool-hub-missing-dir", result.Status)
+	_, err = executeToolCall(ctx, toolCall{Name: "list", Parameters: "{}"})
+	assert.ErrorIs(t, err, errToolNotReady, "calls of tools missing requirements should fail early")
+
+	echo, err := createTool(ctx, Tool{Name: "echo", Category: "commandLine", Code: `{"extra": {"sh": "sh", "cmd": "echo ok", "wd": "` + dir + `"}}`})
+	assert.NoError(t, err)
+	assert.True(t, preflightTool(ctx, echo).Ready)
+
+	briefs := model.GetToolList().List
+	assert.Len(t, briefs, 3)
+	for _, brief := range briefs {
+		assert.NotNil(t, brief.Preflight, brief.Name)
+	}
+	assert.NoError(t, db.Model(&Tool{}).Where("id = ?", echo.ID).UpdateColumn("updated_at", echo.UpdatedAt+1).Error)
+	briefs, _, err = listTools(ctx, ToolFilter{Query: "echo"})
+	assert.NoError(t, err)
+	assert.Nil(t, briefs[0].Preflight, "results are dropped when the tool is updated")
+
+	token, _, err := createAPIToken(ctx, "caller", []string{ScopeToolsCall}, nil, 0)
+	assert.NoError(t, err)
+	handler := newHubHandler(ctx)
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/api/preflight", strings.NewReader(""))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp RespPreflightTools
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Len(t, resp.List, 3)
+	assert.Equal(t, "echo", resp.List[0].Name)
+	assert.True(t, resp.List[0].Ready)
+	assert.False(t, resp.List[2].Ready)
+
+	// tokens only check the requirements of the tools they may call
+	limited, _, err := createAPIToken(ctx, "echo caller", []string{ScopeToolsCall}, []string{"echo"}, 0)
+	assert.NoError(t, err)
+	req = httptest.NewRequest(http.MethodPost, "http://localhost/api/preflight", strings.NewReader(""))
+	req.Header.Set("Authorization", "Bearer "+limited)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	resp = RespPreflightTools{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Len(t, resp.List, 1)
+	assert.Equal(t, "echo", resp.List[0].Name)
+	for name, code := range map[string]int{"echo": http.StatusOK, "list": http.StatusForbidden} {
+		req = httptest.NewRequest(http.MethodPost, "http://localhost/api/tools/"+name+"/preflight", strings.NewReader(""))
+		req.Header.Set("Authorization", "Bearer "+limited)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, code, rec.Code, name)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "http://localhost/api/callTool", strings.NewReader(`{"name": "list"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusFailedDependency, rec.Code)
+	assert.Contains(t, rec.Body.String(), "executable tool-hub-missing-command")
+}
@@ -0,0 +1,216 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+
+	"tool-hub/backend/hub/cmd"
+)
+
+var errProfileNotFound = errors.New("profile not found")
+
+// profileVariables parses the variables of a profile.
+func (p Profile) profileVariables() (map[string]string, error) {
+	vars := map[string]string{}
+	if strings.TrimSpace(p.Variables) == "" {
+		return vars, nil
+	}
+	if err := json.Unmarshal([]byte(p.Variables), &vars); err != nil {
+		return nil, fmt.Errorf("variables of profile %s should be a JSON object of strings: %w", p.Name, err)
+	}
+	return vars, nil
+}
+
+// resolveProfile returns the profile named name, or the active profile when name is empty.
+// It returns nil when no profile applies.
+func resolveProfile(ctx context.Context, name string) (*Profile, error) {
+	if name == "" {
+		name = getSetting(ctx, SettingKeyActiveProfile, "")
+	}
+	if name == "" {
+		return nil, nil
+	}
+	p, err := gorm.G[Profile](db).Where("name = ?", name).Take(ctx)
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("%w: %s", errProfileNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// applyProfile merges a profile into the options computed by the plugin of a command line tool,
+// from lowest to highest precedence:
+//
+//   - env: environment of the hub, then env of the plugin, then variables of the profile
+//   - PATH: directories of the profile are prepended to the resulting PATH
+//   - cwd and shell: the ones of the plugin, the ones of the profile when the plugin leaves them empty
+//
+// Secret references are resolved afterwards, so profile variables may reference secrets too.
+func applyProfile(p Profile, opts *cmd.StreamOptions) error {
+	vars, err := p.profileVariables()
+	if err != nil {
+		return err
+	}
+	if len(vars) > 0 || p.Path != "" {
+		env := make(map[string]string, len(opts.Env)+len(vars)+1)
+		for k, v := range opts.Env {
+			env[k] = v
+		}
+		for k, v := range vars {
+			env[k] = v
+		}
+		if p.Path != "" {
+			path, ok := env["PATH"]
+			if !ok {
+				path = os.Getenv("PATH")
+			}
+			if path == "" {
+				env["PATH"] = p.Path
+			} else {
+				env["PATH"] = p.Path + string(os.PathListSeparator) + path
+			}
+		}
+		opts.Env = env
+	}
+	if opts.Cwd == "" {
+		opts.Cwd = p.Cwd
+	}
+	if opts.Shell == "" {
+		opts.Shell = p.Shell
+	}
+	return nil
+}
+
+// saveProfile creates the profile or updates the one with the same id.
+// Renaming the active profile keeps it active under its new name.
+func saveProfile(ctx context.Context, p Profile) (Profile, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return p, fmt.Errorf("profile name is required")
+	}
+	if _, err := p.profileVariables(); err != nil {
+		return p, err
+	}
+	if p.ID == 0 {
+		err := gorm.G[Profile](db).Create(ctx, &p)
+		return p, err
+	}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		old, err := gorm.G[Profile](tx).Where("id = ?", p.ID).Take(ctx)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&p).Select("name", "description", "variables", "cwd", "shell", "path").Updates(&p).Error; err != nil {
+			return err
+		}
+		if old.Name == p.Name {
+			return nil
+		}
+		return tx.Model(&Setting{}).Where("key = ? AND value = ?", string(SettingKeyActiveProfile), old.Name).
+			Update("value", p.Name).Error
+	})
+	return p, err
+}
+
+// deleteProfile deletes a profile, deleting the active profile leaves no profile active.
+func deleteProfile(ctx context.Context, id int) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		p, err := gorm.G[Profile](tx).Where("id = ?", id).Take(ctx)
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := gorm.G[Profile](tx).Where("id = ?", id).Delete(ctx); err != nil {
+			return err
+		}
+		return tx.Model(&Setting{}).Where("key = ? AND value = ?", string(SettingKeyActiveProfile), p.Name).
+			Update("value", "").Error
+	})
+}
+
+// #region Profile Bindings
+
+type RespGetProfileList struct {
+	Error  string    `json:"error"`
+	List   []Profile `json:"list"`
+	Active string    `json:"active"` // name of the active profile, empty when none
+}
+
+func (m *Model) GetProfileList() (resp RespGetProfileList) {
+	list, err := gorm.G[Profile](db).Order("name").Find(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to list profiles: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	resp.List = list
+	resp.Active = getSetting(m.ctx, SettingKeyActiveProfile, "")
+	return
+}
+
+type RespSaveProfile struct {
+	Error string  `json:"error"`
+	Item  Profile `json:"item"`
+}
+
+func (m *Model) SaveProfile(p Profile) (resp RespSaveProfile) {
+	var err error
+	resp.Item, err = saveProfile(m.ctx, p)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to save profile: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespDeleteProfile struct {
+	Error string `json:"error"`
+}
+
+func (m *Model) DeleteProfile(id int) (resp RespDeleteProfile) {
+	if err := deleteProfile(m.ctx, id); err != nil {
+		resp.Error = fmt.Sprintf("failed to delete profile: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespSetActiveProfile struct {
+	Error string `json:"error"`
+}
+
+// SetActiveProfile makes the named profile apply to calls which don't choose one, empty name clears it.
+func (m *Model) SetActiveProfile(name string) (resp RespSetActiveProfile) {
+	if name != "" {
+		if _, err := resolveProfile(m.ctx, name); err != nil {
+			resp.Error = fmt.Sprintf("failed to set active profile: %v", err)
+			if m.ctx != nil {
+				runtime.LogError(m.ctx, resp.Error)
+			}
+			return
+		}
+	}
+	resp.Error = m.SaveSetting(string(SettingKeyActiveProfile), name).Error
+	return
+}
+
+// #endregion
@@ -0,0 +1,78 @@
+package hub
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tool-hub/backend/hub/cmd"
+)
+
+func TestApplyProfile(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	profile := Profile{
+		Name:      "staging",
+		Variables: `{"TARGET": "staging", "REGION": "eu"}`,
+		Cwd:       "/srv/staging",
+		Shell:     "bash",
+		Path:      "/opt/staging/bin",
+	}
+
+	opts := cmd.StreamOptions{Env: map[string]string{"TARGET": "local", "DEBUG": "1", "PATH": "/usr/bin"}, Cwd: "/tmp"}
+	assert.NoError(t, applyProfile(profile, &opts))
+	assert.Equal(t, map[string]string{
+		"TARGET": "staging",
+		"REGION": "eu",
+		"DEBUG":  "1",
+		"PATH":   "/opt/staging/bin" + sep + "/usr/bin",
+	}, opts.Env, "profile variables should override the plugin env")
+	assert.Equal(t, "/tmp", opts.Cwd, "cwd of the plugin should win")
+	assert.Equal(t, "bash", opts.Shell)
+
+	opts = cmd.StreamOptions{}
+	assert.NoError(t, applyProfile(Profile{Path: "/opt/bin"}, &opts))
+	assert.Equal(t, "/opt/bin"+sep+os.Getenv("PATH"), opts.Env["PATH"])
+
+	assert.Error(t, applyProfile(Profile{Variables: `["not", "an", "object"]`}, &cmd.StreamOptions{}))
+}
+
+func TestResolveProfile(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+
+	p, err := resolveProfile(ctx, "")
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+
+	assert.Empty(t, model.SaveProfile(Profile{Name: "local"}).Error)
+	assert.Empty(t, model.SaveProfile(Profile{Name: "staging", Variables: `{"TARGET": "staging"}`}).Error)
+	assert.NotEmpty(t, model.SaveProfile(Profile{Name: "broken", Variables: `{`}).Error)
+
+	assert.NotEmpty(t, model.SetActiveProfile("missing").Error)
+	assert.Empty(t, model.SetActiveProfile("staging").Error)
+	p, err = resolveProfile(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "staging", p.Name)
+	p, err = resolveProfile(ctx, "local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local", p.Name, "the profile of the call should win over the active one")
+	_, err = resolveProfile(ctx, "missing")
+	assert.ErrorIs(t, err, errProfileNotFound)
+
+	// renaming or deleting the active profile doesn't break the calls which don't choose a profile
+	p, err = resolveProfile(ctx, "")
+	assert.NoError(t, err)
+	p.Name = "stage"
+	assert.Empty(t, model.SaveProfile(*p).Error)
+	assert.Equal(t, "stage", model.GetProfileList().Active)
+	p, err = resolveProfile(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "stage", p.Name)
+	assert.Empty(t, model.DeleteProfile(p.ID).Error)
+	assert.Empty(t, model.GetProfileList().Active)
+	p, err = resolveProfile(ctx, "")
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+}
@@ -0,0 +1,434 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// toolRunner executes a registered tool and returns its output, it is invokeTool outside of tests.
+type toolRunner func(ctx context.Context, name string, parameters string) ([]byte, error)
+
+var promptVariableNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parsePromptVariables parses and validates the declared variables of a prompt.
+func parsePromptVariables(variables string) ([]PromptVariable, error) {
+	if strings.TrimSpace(variables) == "" {
+		return nil, nil
+	}
+	var list []PromptVariable
+	if err := json.Unmarshal([]byte(variables), &list); err != nil {
+		return nil, fmt.Errorf("invalid variables: %w", err)
+	}
+	seen := make(map[string]bool, len(list))
+	for i, v := range list {
+		if !promptVariableNameRe.MatchString(v.Name) {
+			return nil, fmt.Errorf("invalid variable name %q", v.Name)
+		}
+		if seen[v.Name] {
+			return nil, fmt.Errorf("duplicated variable %q", v.Name)
+		}
+		seen[v.Name] = true
+		switch v.Type {
+		case "":
+			list[i].Type = "string"
+		case "string", "number", "boolean", "json":
+		default:
+			return nil, fmt.Errorf("variable %q has unknown type %q", v.Name, v.Type)
+		}
+	}
+	return list, nil
+}
+
+// bindPromptVariables checks values against the declared variables and fills in defaults.
+func bindPromptVariables(variables []PromptVariable, values map[string]any) (map[string]any, error) {
+	declared := make(map[string]bool, len(variables))
+	for _, v := range variables {
+		declared[v.Name] = true
+	}
+	var errs []error
+	for name := range values {
+		if !declared[name] {
+			errs = append(errs, fmt.Errorf("undeclared variable %q", name))
+		}
+	}
+
+	data := make(map[string]any, len(variables))
+	for _, v := range variables {
+		value, ok := values[v.Name]
+		if !ok || value == nil {
+			switch {
+			case v.Default != nil:
+				value = v.Default
+			case v.Required:
+				errs = append(errs, fmt.Errorf("missing required variable %q", v.Name))
+				continue
+			default:
+				data[v.Name] = zeroOfPromptType(v.Type)
+				continue
+			}
+		}
+		if !matchPromptType(v.Type, value) {
+			errs = append(errs, fmt.Errorf("variable %q should be a %s, got %T", v.Name, v.Type, value))
+			continue
+		}
+		data[v.Name] = value
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return data, nil
+}
+
+func zeroOfPromptType(typ string) any {
+	switch typ {
+	case "number":
+		return float64(0)
+	case "boolean":
+		return false
+	case "json":
+		return nil
+	default:
+		return ""
+	}
+}
+
+func matchPromptType(typ string, value any) bool {
+	switch typ {
+	case "number":
+		switch value.(type) {
+		case float64, float32, int, int64, json.Number:
+			return true
+		}
+		return false
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "json":
+		return true
+	default:
+		_, ok := value.(string)
+		return ok
+	}
+}
+
+// newPromptTemplate creates the template used to parse and render prompt bodies.
+// Besides variables referenced as {{.name}}, a body may embed the output of hub tools:
+//
+//	{{tool "git-diff" `{"staged": true}`}}
+//	{{tool "git-diff" (json (dict "staged" .staged))}}
+func newPromptTemplate(ctx context.Context, run toolRunner) *template.Template {
+	return template.New("prompt").Option("missingkey=error").Funcs(template.FuncMap{
+		"tool": func(name string, parameters ...string) (string, error) {
+			if run == nil {
+				return "", fmt.Errorf("tools are not available")
+			}
+			if len(parameters) > 1 {
+				return "", fmt.Errorf("tool %q: expects at most one parameters argument", name)
+			}
+			params := "{}"
+			if len(parameters) == 1 {
+				params = parameters[0]
+			}
+			out, err := run(ctx, name, params)
+			if err != nil {
+				return "", fmt.Errorf("tool %q: %w", name, err)
+			}
+			return string(out), nil
+		},
+		"json": func(v any) (string, error) {
+			bs, err := json.Marshal(v)
+			return string(bs), err
+		},
+		"dict": func(kv ...any) (map[string]any, error) {
+			if len(kv)%2 != 0 {
+				return nil, fmt.Errorf("dict expects key/value pairs")
+			}
+			m := make(map[string]any, len(kv)/2)
+			for i := 0; i < len(kv); i += 2 {
+				k, ok := kv[i].(string)
+				if !ok {
+					return nil, fmt.Errorf("dict key should be a string, got %T", kv[i])
+				}
+				m[k] = kv[i+1]
+			}
+			return m, nil
+		},
+	})
+}
+
+// renderPrompt fills the variables of a prompt body and runs the tools it embeds.
+func renderPrompt(ctx context.Context, body string, variables []PromptVariable, values map[string]any, run toolRunner) (string, error) {
+	data, err := bindPromptVariables(variables, values)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := newPromptTemplate(ctx, run).Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt body: %w", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func normalizeTags(tags string) string {
+	seen := make(map[string]bool)
+	list := make([]string, 0)
+	for _, t := range strings.Split(tags, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		list = append(list, t)
+	}
+	return strings.Join(list, ",")
+}
+
+// savePrompt creates or updates a prompt, a new version is recorded when body or variables change.
+func savePrompt(ctx context.Context, prompt Prompt) (Prompt, error) {
+	prompt.Name = strings.TrimSpace(prompt.Name)
+	if prompt.Name == "" {
+		return prompt, fmt.Errorf("prompt name is required")
+	}
+	if _, err := parsePromptVariables(prompt.Variables); err != nil {
+		return prompt, err
+	}
+	if _, err := newPromptTemplate(ctx, nil).Parse(prompt.Body); err != nil {
+		return prompt, fmt.Errorf("invalid prompt body: %w", err)
+	}
+	prompt.Tags = normalizeTags(prompt.Tags)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		changed := true
+		if prompt.ID == 0 {
+			prompt.Version = 1
+			if err := gorm.G[Prompt](tx).Create(ctx, &prompt); err != nil {
+				return err
+			}
+		} else {
+			old, err := gorm.G[Prompt](tx).Where("id = ?", prompt.ID).Take(ctx)
+			if err != nil {
+				return err
+			}
+			changed = old.Body != prompt.Body || old.Variables != prompt.Variables
+			prompt.Version = old.Version
+			if changed {
+				prompt.Version++
+			}
+			prompt.CreatedAt = old.CreatedAt
+			if err := tx.WithContext(ctx).Save(&prompt).Error; err != nil {
+				return err
+			}
+		}
+		if !changed {
+			return nil
+		}
+		return gorm.G[PromptVersion](tx).Create(ctx, &PromptVersion{
+			PromptID:  prompt.ID,
+			Version:   prompt.Version,
+			Body:      prompt.Body,
+			Variables: prompt.Variables,
+		})
+	})
+	return prompt, err
+}
+
+// #region Prompt Bindings
+
+type RespGetPromptList struct {
+	Error string   `json:"error"`
+	List  []Prompt `json:"list"`
+}
+
+// GetPromptList lists prompts whose name, description or tags contain query, optionally filtered by tag.
+func (m *Model) GetPromptList(query string, tag string) (resp RespGetPromptList) {
+	q := gorm.G[Prompt](db).Order("name")
+	if query = strings.TrimSpace(query); query != "" {
+		like := "%" + query + "%"
+		q = q.Where("name LIKE ? OR description LIKE ? OR tags LIKE ?", like, like, like)
+	}
+	if tag = strings.TrimSpace(tag); tag != "" {
+		q = q.Where("(',' || tags || ',') LIKE ?", "%,"+tag+",%")
+	}
+	list, err := q.Find(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to list prompts: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	resp.List = list
+	return
+}
+
+type RespGetPrompt struct {
+	Error string `json:"error"`
+	Item  Prompt `json:"item"`
+}
+
+func (m *Model) GetPrompt(id int) (resp RespGetPrompt) {
+	var err error
+	resp.Item, err = gorm.G[Prompt](db).Where("id = ?", id).Take(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to get prompt: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespSavePrompt struct {
+	Error string `json:"error"`
+	Item  Prompt `json:"item"`
+}
+
+// SavePrompt creates a prompt when its id is 0, otherwise updates it.
+func (m *Model) SavePrompt(prompt Prompt) (resp RespSavePrompt) {
+	var err error
+	resp.Item, err = savePrompt(m.ctx, prompt)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to save prompt: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespDeletePrompt struct {
+	Error string `json:"error"`
+}
+
+// DeletePrompt deletes a prompt together with its version history.
+func (m *Model) DeletePrompt(id int) (resp RespDeletePrompt) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := gorm.G[PromptVersion](tx).Where("prompt_id = ?", id).Delete(m.ctx); err != nil {
+			return err
+		}
+		_, err := gorm.G[Prompt](tx).Where("id = ?", id).Delete(m.ctx)
+		return err
+	})
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to delete prompt: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespGetPromptVersionList struct {
+	Error string          `json:"error"`
+	List  []PromptVersion `json:"list"`
+}
+
+func (m *Model) GetPromptVersionList(promptID int) (resp RespGetPromptVersionList) {
+	list, err := gorm.G[PromptVersion](db).Where("prompt_id = ?", promptID).Order("version DESC").Find(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to list prompt versions: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	resp.List = list
+	return
+}
+
+// RestorePromptVersion makes an old version the latest one by saving it as a new version.
+func (m *Model) RestorePromptVersion(promptID int, version int) (resp RespSavePrompt) {
+	snapshot, err := gorm.G[PromptVersion](db).Where("prompt_id = ? AND version = ?", promptID, version).Take(m.ctx)
+	if err == nil {
+		var prompt Prompt
+		prompt, err = gorm.G[Prompt](db).Where("id = ?", promptID).Take(m.ctx)
+		if err == nil {
+			prompt.Body = snapshot.Body
+			prompt.Variables = snapshot.Variables
+			resp.Item, err = savePrompt(m.ctx, prompt)
+		}
+	}
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to restore prompt version: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespRenderPrompt struct {
+	Error string `json:"error"`
+	Text  string `json:"text"`
+}
+
+// RenderPrompt renders a prompt by name with values given as a JSON object.
+// version 0 renders the latest version.
+func (m *Model) RenderPrompt(name string, version int, values string) (resp RespRenderPrompt) {
+	prompt, err := gorm.G[Prompt](db).Where("name = ?", name).Take(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to get prompt: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	if version != 0 && version != prompt.Version {
+		snapshot, err := gorm.G[PromptVersion](db).Where("prompt_id = ? AND version = ?", prompt.ID, version).Take(m.ctx)
+		if err != nil {
+			resp.Error = fmt.Sprintf("failed to get prompt version %d: %v", version, err)
+			if m.ctx != nil {
+				runtime.LogError(m.ctx, resp.Error)
+			}
+			return
+		}
+		prompt.Body = snapshot.Body
+		prompt.Variables = snapshot.Variables
+	}
+
+	variables, err := parsePromptVariables(prompt.Variables)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to render prompt: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	var valueMap map[string]any
+	if strings.TrimSpace(values) != "" {
+		if err := json.Unmarshal([]byte(values), &valueMap); err != nil {
+			resp.Error = fmt.Sprintf("invalid values: %v", err)
+			if m.ctx != nil {
+				runtime.LogError(m.ctx, resp.Error)
+			}
+			return
+		}
+	}
+	resp.Text, err = renderPrompt(m.ctx, prompt.Body, variables, valueMap, invokeTool)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to render prompt: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// #endregion
@@ -0,0 +1,102 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPrompt_variables(t *testing.T) {
+	variables, err := parsePromptVariables(`[
+		{"name": "lang", "required": true},
+		{"name": "count", "type": "number", "default": 3},
+		{"name": "strict", "type": "boolean"}
+	]`)
+	assert.NoError(t, err)
+
+	text, err := renderPrompt(context.Background(), "{{.lang}} x{{.count}} {{.strict}}", variables, map[string]any{"lang": "go"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "go x3 false", text)
+
+	_, err = renderPrompt(context.Background(), "{{.lang}}", variables, map[string]any{}, nil)
+	assert.ErrorContains(t, err, `missing required variable "lang"`)
+
+	_, err = renderPrompt(context.Background(), "{{.lang}}", variables, map[string]any{"lang": "go", "other": 1}, nil)
+	assert.ErrorContains(t, err, `undeclared variable "other"`)
+
+	_, err = renderPrompt(context.Background(), "{{.lang}}", variables, map[string]any{"lang": 1.0}, nil)
+	assert.ErrorContains(t, err, `variable "lang" should be a string`)
+
+	_, err = renderPrompt(context.Background(), "{{.unknown}}", variables, map[string]any{"lang": "go"}, nil)
+	assert.Error(t, err)
+}
+
+func TestRenderPrompt_tool(t *testing.T) {
+	variables, err := parsePromptVariables(`[{"name": "staged", "type": "boolean", "default": true}]`)
+	assert.NoError(t, err)
+
+	var calls []string
+	run := func(ctx context.Context, name string, parameters string) ([]byte, error) {
+		calls = append(calls, name+" "+parameters)
+		if name == "broken" {
+			return nil, fmt.Errorf("boom")
+		}
+		return []byte("diff --git"), nil
+	}
+
+	text, err := renderPrompt(context.Background(), "Review:\n{{tool \"git-diff\" (json (dict \"staged\" .staged))}}", variables, nil, run)
+	assert.NoError(t, err)
+	assert.Equal(t, "Review:\ndiff --git", text)
+
+	_, err = renderPrompt(context.Background(), "{{tool \"git-diff\"}}", variables, nil, run)
+	assert.NoError(t, err)
+
+	_, err = renderPrompt(context.Background(), "{{tool \"broken\" `{\"a\": 1}`}}", variables, nil, run)
+	assert.ErrorContains(t, err, "boom")
+
+	assert.Equal(t, []string{`git-diff {"staged":true}`, "git-diff {}", `broken {"a": 1}`}, calls)
+}
+
+func TestParsePromptVariables_invalid(t *testing.T) {
+	_, err := parsePromptVariables(`[{"name": "a b"}]`)
+	assert.Error(t, err)
+	_, err = parsePromptVariables(`[{"name": "a"}, {"name": "a"}]`)
+	assert.Error(t, err)
+	_, err = parsePromptVariables(`[{"name": "a", "type": "date"}]`)
+	assert.Error(t, err)
+}
+
+func TestSavePrompt_versions(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+
+	prompt, err := savePrompt(ctx, Prompt{Name: "review", Tags: " go, review ,go", Body: "v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, prompt.Version)
+	assert.Equal(t, "go,review", prompt.Tags)
+
+	prompt.Description = "only description changed"
+	prompt, err = savePrompt(ctx, prompt)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, prompt.Version)
+
+	prompt.Body = "v2 {{.x}}"
+	prompt.Variables = `[{"name": "x"}]`
+	prompt, err = savePrompt(ctx, prompt)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, prompt.Version)
+
+	resp := model.GetPromptVersionList(prompt.ID)
+	assert.Empty(t, resp.Error)
+	assert.Len(t, resp.List, 2)
+	assert.Equal(t, "v2 {{.x}}", resp.List[0].Body)
+
+	list := model.GetPromptList("", "review")
+	assert.Empty(t, list.Error)
+	assert.Len(t, list.List, 1)
+
+	_, err = savePrompt(ctx, Prompt{Name: "broken", Body: "{{.x"})
+	assert.Error(t, err)
+}
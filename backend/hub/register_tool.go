@@ -3,15 +3,48 @@ package hub
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-
-	"gorm.io/gorm"
 )
 
+// errToolHasErrors refuses to store a tool lintTool found errors in, unless it is stored as a draft.
+var errToolHasErrors = errors.New("the tool has errors")
+
 type BodyRegisterTool struct {
 	Tool Tool `json:"tool"`
+	// Draft registers a tool with errors anyway, with the ToolStatusDraft status, instead of failing.
+	Draft bool `json:"draft"`
+}
+
+// RespRegisterTool is the response of POST /api/registerTool.
+type RespRegisterTool struct {
+	Message string      `json:"message"`
+	Error   string      `json:"error"`
+	Item    Tool        `json:"item"`
+	Issues  []ToolIssue `json:"issues"` // errors and warnings found by lintTool
+	// Preflight reports the requirements of the registered tool missing on this machine, see preflightTool.
+	Preflight *PreflightResult `json:"preflight"`
 }
 
+// lintToolStatus lints tool before it is stored and returns it with the status to store it with.
+// A tool with errors fails with errToolHasErrors unless draft is true, then it is stored as a draft.
+// A draft without errors is activated, the lifecycle status of other tools is kept.
+func lintToolStatus(ctx context.Context, tool Tool, draft bool) (Tool, []ToolIssue, error) {
+	tool.Status = ""
+	issues := lintTool(ctx, tool)
+	if hasErrors(issues) {
+		if !draft {
+			return tool, issues, errToolHasErrors
+		}
+		tool.Status = ToolStatusDraft
+	} else if old, err := findTool(ctx, tool.Name, true); err == nil && old.Status == ToolStatusDraft {
+		tool.Status = ToolStatusActive
+	}
+	return tool, issues, nil
+}
+
+// registerTool creates the tool or replaces the one with the same name, see saveTool.
+// The tool is linted first, it isn't registered when it has errors unless the body asks for a draft.
 func registerTool(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	ctx = context.WithoutCancel(ctx)
 	var body BodyRegisterTool
@@ -20,30 +53,20 @@ func registerTool(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tool := body.Tool
-	oTool, err := gorm.G[Tool](db).Where("name = ?", tool.Name).Take(ctx)
+	tool, issues, err := lintToolStatus(ctx, body.Tool, body.Draft)
 	if err != nil {
-		if err != gorm.ErrRecordNotFound {
-			http.Error(w, "Database error", http.StatusInternalServerError)
-			return
-		}
-		// new tool
-		err = gorm.G[Tool](db).Create(ctx, &tool)
-		if err != nil {
-			http.Error(w, "Failed to create tool", http.StatusInternalServerError)
-			return
-		}
+		writeJSON(w, toolErrorStatus(err), RespRegisterTool{Error: "Failed to register tool: " + err.Error(), Issues: issues})
 		return
 	}
-	tool.ID = oTool.ID
-	tool.CreatedAt = oTool.CreatedAt
-	tool.UpdatedAt = oTool.UpdatedAt
-	_, err = gorm.G[Tool](db).Updates(ctx, tool)
+	tool, err = saveTool(ctx, tool)
 	if err != nil {
-		http.Error(w, "Failed to update tool", http.StatusInternalServerError)
+		writeJSON(w, toolErrorStatus(err), RespRegisterTool{Error: "Failed to register tool: " + err.Error(), Issues: issues})
 		return
 	}
-	w.Write([]byte(`{"message": "register tool done"}`))
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	message := "register tool done"
+	if tool.Status == ToolStatusDraft {
+		message = "registered a draft, the tool has errors"
+	}
+	preflight := preflightStoredTool(ctx, tool)
+	writeJSON(w, http.StatusOK, RespRegisterTool{Message: message, Item: tool, Issues: issues, Preflight: preflight})
 }
@@ -0,0 +1,201 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+
+	"tool-hub/backend/hub/cmd"
+)
+
+// Tools declare a retry policy next to their timeout, e.g.
+//
+//	{"timeout": "10s", "retry": {"maxAttempts": 3, "backoff": "200ms", "retryOn": ["crash", "exit:75", "http:5xx"]}}
+//
+// executeToolCall runs a failed attempt again after an exponential backoff with jitter when its outcome is
+// retryable, the plugin is evaluated once. Every attempt of such calls is recorded as a CallAttempt.
+
+const (
+	maxRetryAttempts       = 10
+	defaultRetryBackoff    = 200 * time.Millisecond
+	defaultRetryMaxBackoff = 30 * time.Second
+	defaultRetryJitter     = 0.2
+)
+
+var defaultRetryOn = []string{"timeout", "crash", "network", "http:5xx"}
+
+var retryOutcomePattern = regexp.MustCompile(`^(timeout|crash|network|exit:\d+|http:\d{3}|http:[1-5]xx)$`)
+
+// retryPlan is a validated RetryPolicy.
+type retryPlan struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	jitter      float64
+	retryOn     []string
+}
+
+// parseRetryPolicy validates the retry policy of an evaluated tool, it returns nil when failed calls
+// aren't retried.
+func parseRetryPolicy(toolData []byte) (*retryPlan, error) {
+	var tool struct {
+		Retry *RetryPolicy `json:"retry"`
+	}
+	if err := json.Unmarshal(toolData, &tool); err != nil {
+		return nil, fmt.Errorf("failed to parse tool response: %w", err)
+	}
+	p := tool.Retry
+	if p == nil || p.MaxAttempts <= 1 {
+		return nil, nil
+	}
+	plan := &retryPlan{
+		maxAttempts: min(p.MaxAttempts, maxRetryAttempts),
+		backoff:     defaultRetryBackoff,
+		maxBackoff:  defaultRetryMaxBackoff,
+		jitter:      p.Jitter,
+		retryOn:     p.RetryOn,
+	}
+	var err error
+	if p.Backoff != "" {
+		if plan.backoff, err = time.ParseDuration(p.Backoff); err != nil || plan.backoff < 0 {
+			return nil, fmt.Errorf("invalid retry backoff %q", p.Backoff)
+		}
+	}
+	if p.MaxBackoff != "" {
+		if plan.maxBackoff, err = time.ParseDuration(p.MaxBackoff); err != nil || plan.maxBackoff < 0 {
+			return nil, fmt.Errorf("invalid retry max backoff %q", p.MaxBackoff)
+		}
+	}
+	if plan.jitter < 0 || plan.jitter > 1 {
+		return nil, fmt.Errorf("retry jitter should be between 0 and 1")
+	}
+	if plan.jitter == 0 {
+		plan.jitter = defaultRetryJitter
+	}
+	if len(plan.retryOn) == 0 {
+		plan.retryOn = defaultRetryOn
+	}
+	for _, outcome := range plan.retryOn {
+		if !retryOutcomePattern.MatchString(outcome) {
+			return nil, fmt.Errorf("unknown retryable outcome %q", outcome)
+		}
+	}
+	return plan, nil
+}
+
+// delay returns how long to wait after the failed attempt, starting at 1.
+func (p *retryPlan) delay(attempt int) time.Duration {
+	d := p.backoff << min(attempt-1, 30)
+	if d > p.maxBackoff || d < 0 {
+		d = p.maxBackoff
+	}
+	return time.Duration(float64(d) * (1 + p.jitter*(2*rand.Float64()-1)))
+}
+
+// retryable reports whether an attempt which failed with these outcomes should run again.
+func (p *retryPlan) retryable(outcomes []string) bool {
+	for _, outcome := range outcomes {
+		if slices.Contains(p.retryOn, outcome) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpStatusError reports a response of an HTTP tool with an error status.
+type httpStatusError struct {
+	code   int
+	status string
+}
+
+func (e *httpStatusError) Error() string { return "request failed: " + e.status }
+
+// failureOutcomes classifies the error of an attempt, the most specific outcome first.
+// Errors of other kinds, e.g. invalid parameters, have no outcome and are never retried.
+func failureOutcomes(err error) []string {
+	if err == nil {
+		return nil
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return []string{"http:" + strconv.Itoa(statusErr.code), fmt.Sprintf("http:%dxx", statusErr.code/100)}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return []string{"timeout"}
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if urlErr.Timeout() {
+			return []string{"timeout"}
+		}
+		return []string{"network"}
+	}
+	if errors.Is(err, cmd.ErrWorkerExited) {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+			return []string{"exit:" + strconv.Itoa(exitErr.ExitCode()), "crash"}
+		}
+		return []string{"crash"}
+	}
+	return nil
+}
+
+// runAttempts runs attempt until it succeeds or the plan gives up, and records each attempt of the call.
+// The stdin of the call is read again from the start, calls with a stdin which can't be rewound aren't retried.
+func runAttempts(ctx context.Context, plan *retryPlan, call toolCall, redactor *secretRedactor, attempt func() ([]byte, error)) ([]byte, error) {
+	for n := 1; ; n++ {
+		start := time.Now()
+		out, err := attempt()
+		outcomes := failureOutcomes(err)
+		record := CallAttempt{CallID: call.CallID, ToolName: call.Name, Attempt: n, Status: "succeeded", Duration: time.Since(start).Milliseconds()}
+		if err != nil {
+			record.Status = "failed"
+			record.Error = redactor.redactString(err.Error())
+			if len(outcomes) > 0 {
+				record.Outcome = outcomes[0]
+			}
+		}
+		if err := gorm.G[CallAttempt](db).Create(ctx, &record); err != nil {
+			runtime.LogWarningf(ctx, "failed to record attempt of call %s: %v", call.CallID, err)
+		}
+		if err == nil || n >= plan.maxAttempts || !plan.retryable(outcomes) || !rewindStdin(call) {
+			return out, err
+		}
+		timer := time.NewTimer(plan.delay(n))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return out, err
+		case <-timer.C:
+		}
+	}
+}
+
+func rewindStdin(call toolCall) bool {
+	if call.StdinReader == nil {
+		return true
+	}
+	seeker, ok := call.StdinReader.(io.Seeker)
+	if !ok {
+		return false
+	}
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err == nil
+}
+
+// listCallAttempts returns the recorded attempts of a call.
+func listCallAttempts(ctx context.Context, callID string) ([]CallAttempt, error) {
+	return gorm.G[CallAttempt](db).Where("call_id = ?", callID).Order("id").Find(ctx)
+}
@@ -0,0 +1,139 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"tool-hub/backend/hub/cmd"
+)
+
+func TestParseRetryPolicy(t *testing.T) {
+	parse := func(p *RetryPolicy) (*retryPlan, error) {
+		toolData, _ := json.Marshal(CommandLineTool{Retry: p})
+		return parseRetryPolicy(toolData)
+	}
+	plan, err := parse(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, plan)
+	plan, err = parse(&RetryPolicy{MaxAttempts: 1})
+	assert.NoError(t, err)
+	assert.Nil(t, plan, "a single attempt isn't retried")
+
+	plan, err = parse(&RetryPolicy{MaxAttempts: 50, Backoff: "100ms", MaxBackoff: "1s"})
+	assert.NoError(t, err)
+	assert.Equal(t, maxRetryAttempts, plan.maxAttempts)
+	assert.Equal(t, defaultRetryOn, plan.retryOn)
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 8: time.Second, 100: time.Second} {
+		d := plan.delay(attempt)
+		assert.InDelta(t, float64(want), float64(d), float64(want)*plan.jitter, "attempt %d", attempt)
+	}
+
+	for _, p := range []RetryPolicy{
+		{MaxAttempts: 3, Backoff: "soon"},
+		{MaxAttempts: 3, MaxBackoff: "-1s"},
+		{MaxAttempts: 3, Jitter: 2},
+		{MaxAttempts: 3, RetryOn: []string{"http:5XX"}},
+		{MaxAttempts: 3, RetryOn: []string{"exit:"}},
+	} {
+		_, err := parse(&p)
+		assert.Error(t, err, p)
+	}
+}
+
+func TestFailureOutcomes(t *testing.T) {
+	for err, want := range map[error][]string{
+		&httpStatusError{code: 503, status: "503 Service Unavailable"}:          {"http:503", "http:5xx"},
+		fmt.Errorf("x: %w", context.DeadlineExceeded):                           {"timeout"},
+		fmt.Errorf("x: %w", &redactedError{msg: "x", err: cmd.ErrWorkerExited}): {"crash"},
+		fmt.Errorf("invalid parameters"):                                        nil,
+	} {
+		assert.Equal(t, want, failureOutcomes(err), err.Error())
+	}
+	_, err := http.Get("http://127.0.0.1:1")
+	assert.Equal(t, []string{"network"}, failureOutcomes(err))
+}
+
+func TestRunAttempts(t *testing.T) {
+	setupTestDB(t)
+	setupTestSecrets(t)
+	ctx := context.Background()
+	redactor, err := newSecretRedactor(ctx)
+	assert.NoError(t, err)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/flaky":
+			if requests < 3 {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		default:
+			http.Error(w, "missing", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	call := func(path string, policy RetryPolicy, callID string) ([]byte, error) {
+		toolData, _ := json.Marshal(HTTPTool{Extra: HTTPToolExtra{URL: server.URL + path}, Retry: &policy})
+		plan, err := parseRetryPolicy(toolData)
+		assert.NoError(t, err)
+		return runAttempts(ctx, plan, toolCall{Name: "api", CallID: callID}, redactor, func() ([]byte, error) {
+			return executeHTTPTool(ctx, toolData)
+		})
+	}
+
+	out, err := call("/flaky", RetryPolicy{MaxAttempts: 5, Backoff: "1ms"}, "call1")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(out))
+	attempts, err := listCallAttempts(ctx, "call1")
+	assert.NoError(t, err)
+	if assert.Len(t, attempts, 3) {
+		assert.Equal(t, "failed", attempts[0].Status)
+		assert.Equal(t, "http:503", attempts[0].Outcome)
+		assert.Equal(t, 2, attempts[1].Attempt)
+		assert.Equal(t, "succeeded", attempts[2].Status)
+	}
+
+	// 404 isn't retryable by default
+	requests = 0
+	_, err = call("/missing", RetryPolicy{MaxAttempts: 5, Backoff: "1ms"}, "call2")
+	assert.ErrorContains(t, err, "404")
+	assert.Equal(t, 1, requests)
+
+	requests = 0
+	_, err = call("/missing", RetryPolicy{MaxAttempts: 2, Backoff: "1ms", RetryOn: []string{"http:404"}}, "call3")
+	assert.Error(t, err)
+	assert.Equal(t, 2, requests, "attempts should stop at the maximum")
+
+	// the stdin is read again from the start
+	attempt := 0
+	toolData, _ := json.Marshal(HTTPTool{Retry: &RetryPolicy{MaxAttempts: 3, Backoff: "1ms"}})
+	plan, err := parseRetryPolicy(toolData)
+	assert.NoError(t, err)
+	_, err = runAttempts(ctx, plan, toolCall{Name: "api", CallID: "call4", StdinReader: strings.NewReader("x")}, redactor, func() ([]byte, error) {
+		attempt++
+		return nil, cmd.ErrWorkerExited
+	})
+	assert.ErrorIs(t, err, cmd.ErrWorkerExited)
+	assert.Equal(t, 3, attempt, "strings.Reader can be rewound")
+	// a stdin which can't be read again isn't retried
+	attempt = 0
+	_, err = runAttempts(ctx, plan, toolCall{Name: "api", CallID: "call5", StdinReader: io.MultiReader(strings.NewReader("x"))}, redactor, func() ([]byte, error) {
+		attempt++
+		return nil, cmd.ErrWorkerExited
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempt)
+}
@@ -0,0 +1,378 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// Schedules call tools periodically, like system cron with curl but through executeToolCall. The scheduler
+// started by FrontendReady sleeps until the next run of the enabled schedules, and wakes up early whenever
+// schedules change.
+//
+// Runs are never replayed one by one: when the hub was closed, or the computer asleep, at the time of a run,
+// the schedule runs once when the hub is back unless its CatchUp is "skip", and the next run is computed
+// from then on.
+
+const (
+	scheduleOverlapSkip  = "skip"
+	scheduleOverlapQueue = "queue"
+	scheduleOverlapAllow = "allow"
+
+	scheduleCatchUpOnce = "once"
+	scheduleCatchUpSkip = "skip"
+
+	minScheduleInterval = 10 * time.Second
+	// scheduleCatchUpGrace is how late a run may be before it counts as missed.
+	scheduleCatchUpGrace = time.Minute
+)
+
+// scheduleNext returns the time of the run following after.
+func scheduleNext(s Schedule, after time.Time) (time.Time, error) {
+	if s.Cron == "" {
+		d, err := time.ParseDuration(s.Interval)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid interval %q: %w", s.Interval, err)
+		}
+		if d < minScheduleInterval {
+			return time.Time{}, fmt.Errorf("interval should be at least %s", minScheduleInterval)
+		}
+		return after.Add(d), nil
+	}
+	spec, err := cron.ParseStandard(s.Cron)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression %q: %w", s.Cron, err)
+	}
+	loc := time.Local
+	if s.Timezone != "" {
+		if loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return time.Time{}, fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+		}
+	}
+	next := spec.Next(after.In(loc))
+	if next.IsZero() {
+		return next, fmt.Errorf("cron expression %q never runs", s.Cron)
+	}
+	return next, nil
+}
+
+func validateSchedule(ctx context.Context, s Schedule) error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("schedule name is required")
+	}
+	if (s.Cron == "") == (s.Interval == "") {
+		return fmt.Errorf("either a cron expression or an interval is required")
+	}
+	if expr := strings.TrimSpace(s.Cron); strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+		return fmt.Errorf("use the timezone of the schedule instead of a time zone in the cron expression")
+	}
+	if _, err := scheduleNext(s, time.Now()); err != nil {
+		return err
+	}
+	switch s.Overlap {
+	case "", scheduleOverlapSkip, scheduleOverlapQueue, scheduleOverlapAllow:
+	default:
+		return fmt.Errorf("unknown overlap policy %q", s.Overlap)
+	}
+	switch s.CatchUp {
+	case "", scheduleCatchUpOnce, scheduleCatchUpSkip:
+	default:
+		return fmt.Errorf("unknown catch-up policy %q", s.CatchUp)
+	}
+	_, err := findTool(ctx, s.ToolName, false)
+	return err
+}
+
+// saveSchedule creates the schedule or updates the one with the same id, its next run is computed from now.
+func saveSchedule(ctx context.Context, s Schedule) (Schedule, error) {
+	s.Name = strings.TrimSpace(s.Name)
+	if err := validateSchedule(ctx, s); err != nil {
+		return s, err
+	}
+	s.NextRunAt = 0
+	if s.Enabled {
+		next, _ := scheduleNext(s, time.Now())
+		s.NextRunAt = next.UnixMilli()
+	}
+	var err error
+	if s.ID == 0 {
+		err = gorm.G[Schedule](db).Create(ctx, &s)
+	} else {
+		err = db.WithContext(ctx).Model(&s).
+			Select("name", "tool_name", "parameters", "cron", "interval", "timezone", "overlap", "catch_up", "enabled", "next_run_at").
+			Updates(&s).Error
+	}
+	if err != nil {
+		return s, err
+	}
+	hubScheduler.wakeUp()
+	return s, nil
+}
+
+// setScheduleEnabled enables or disables a schedule. Enabling validates it like saveSchedule, disabling doesn't
+// so that a schedule whose tool is gone can be stopped.
+func setScheduleEnabled(ctx context.Context, id int, enabled bool) (Schedule, error) {
+	s, err := gorm.G[Schedule](db).Where("id = ?", id).Take(ctx)
+	if err != nil {
+		return s, err
+	}
+	s.Enabled = enabled
+	if enabled {
+		return saveSchedule(ctx, s)
+	}
+	s.NextRunAt = 0
+	if err := db.WithContext(ctx).Model(&s).Select("enabled", "next_run_at").Updates(&s).Error; err != nil {
+		return s, err
+	}
+	hubScheduler.wakeUp()
+	return s, nil
+}
+
+// scheduler fires the due schedules, see tick.
+type scheduler struct {
+	run  stepRunner
+	wake chan struct{}
+
+	mu      sync.Mutex
+	running map[int]int  // number of running calls by schedule id
+	queued  map[int]bool // schedules to run again once their running call is done
+	wg      sync.WaitGroup
+}
+
+var hubScheduler = newScheduler(executeToolCall)
+
+func newScheduler(run stepRunner) *scheduler {
+	return &scheduler{
+		run:     run,
+		wake:    make(chan struct{}, 1),
+		running: map[int]int{},
+		queued:  map[int]bool{},
+	}
+}
+
+// wakeUp makes the scheduler look at schedules again, after they changed.
+func (s *scheduler) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop fires the due schedules until ctx is done.
+func (s *scheduler) loop(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.wake:
+		}
+		next, err := s.tick(ctx, time.Now())
+		if err != nil {
+			runtime.LogErrorf(ctx, "scheduler: %v", err)
+			next = time.Now().Add(time.Minute)
+		}
+		timer.Stop()
+		select {
+		case <-timer.C:
+		default:
+		}
+		timer.Reset(max(time.Until(next), 0))
+	}
+}
+
+// tick fires the schedules due at now and returns when it should be called again.
+func (s *scheduler) tick(ctx context.Context, now time.Time) (time.Time, error) {
+	wakeAt := now.Add(time.Hour)
+	list, err := gorm.G[Schedule](db).Where("enabled = ?", true).Find(ctx)
+	if err != nil {
+		return wakeAt, err
+	}
+	for _, sched := range list {
+		due := time.UnixMilli(sched.NextRunAt)
+		if sched.NextRunAt != 0 && due.After(now) {
+			wakeAt = minTime(wakeAt, due)
+			continue
+		}
+		next, err := scheduleNext(sched, now)
+		if err != nil {
+			// the schedule was valid when saved, e.g. its time zone is gone
+			s.finish(ctx, sched, "", "failed", err)
+			continue
+		}
+		if _, err := gorm.G[Schedule](db).Where("id = ?", sched.ID).Update(ctx, "next_run_at", next.UnixMilli()); err != nil {
+			return wakeAt, err
+		}
+		wakeAt = minTime(wakeAt, next)
+		if sched.NextRunAt == 0 {
+			continue // enabled without a next run, e.g. by an older version
+		}
+		if now.Sub(due) > scheduleCatchUpGrace && sched.CatchUp == scheduleCatchUpSkip {
+			s.finish(ctx, sched, "", "skipped", fmt.Errorf("missed the run of %s", due.Format(time.RFC3339)))
+			continue
+		}
+		s.dispatch(ctx, sched)
+	}
+	return wakeAt, nil
+}
+
+// dispatch runs a schedule in the background according to its overlap policy.
+func (s *scheduler) dispatch(ctx context.Context, sched Schedule) {
+	s.mu.Lock()
+	if s.running[sched.ID] > 0 {
+		switch sched.Overlap {
+		case scheduleOverlapAllow:
+		case scheduleOverlapQueue:
+			s.queued[sched.ID] = true
+			s.mu.Unlock()
+			return
+		default:
+			s.mu.Unlock()
+			s.finish(ctx, sched, "", "skipped", fmt.Errorf("the previous run is not done"))
+			return
+		}
+	}
+	s.running[sched.ID]++
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			callID := newCallID()
+			_, err := s.run(ctx, toolCall{Name: sched.ToolName, Parameters: sched.Parameters, CallID: callID})
+			status := "succeeded"
+			if err != nil {
+				status = "failed"
+			}
+			s.finish(ctx, sched, callID, status, err)
+
+			s.mu.Lock()
+			if s.queued[sched.ID] {
+				delete(s.queued, sched.ID)
+				s.mu.Unlock()
+				continue
+			}
+			s.running[sched.ID]--
+			s.mu.Unlock()
+			return
+		}
+	}()
+}
+
+// finish records the outcome of a run of sched.
+func (s *scheduler) finish(ctx context.Context, sched Schedule, callID string, status string, err error) {
+	update := Schedule{LastRunAt: time.Now().UnixMilli(), LastStatus: status, LastCallID: callID}
+	if err != nil {
+		update.LastError = err.Error()
+	}
+	columns := []string{"last_status", "last_error"}
+	if status != "skipped" {
+		columns = append(columns, "last_run_at", "last_call_id")
+	}
+	db.WithContext(ctx).Model(&Schedule{BaseModel: BaseModel{ID: sched.ID}}).Select(columns).Updates(&update)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// #region Schedule Bindings
+
+type RespGetScheduleList struct {
+	Error string     `json:"error"`
+	List  []Schedule `json:"list"`
+}
+
+func (m *Model) GetScheduleList() (resp RespGetScheduleList) {
+	list, err := gorm.G[Schedule](db).Order("name").Find(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to list schedules: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	resp.List = list
+	return
+}
+
+type RespSaveSchedule struct {
+	Error string   `json:"error"`
+	Item  Schedule `json:"item"`
+}
+
+func (m *Model) SaveSchedule(s Schedule) (resp RespSaveSchedule) {
+	var err error
+	resp.Item, err = saveSchedule(m.ctx, s)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to save schedule: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// SetScheduleEnabled enables or disables a schedule, its next run is computed from now.
+func (m *Model) SetScheduleEnabled(id int, enabled bool) (resp RespSaveSchedule) {
+	var err error
+	resp.Item, err = setScheduleEnabled(m.ctx, id, enabled)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to update schedule: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespDeleteSchedule struct {
+	Error string `json:"error"`
+}
+
+func (m *Model) DeleteSchedule(id int) (resp RespDeleteSchedule) {
+	_, err := gorm.G[Schedule](db).Where("id = ?", id).Delete(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to delete schedule: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	hubScheduler.wakeUp()
+	return
+}
+
+type RespRunScheduleNow struct {
+	Error string `json:"error"`
+}
+
+// RunScheduleNow runs a schedule in the background without changing its next run.
+func (m *Model) RunScheduleNow(id int) (resp RespRunScheduleNow) {
+	s, err := gorm.G[Schedule](db).Where("id = ?", id).Take(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to run schedule: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	hubScheduler.dispatch(m.ctx, s)
+	return
+}
+
+// #endregion
@@ -0,0 +1,179 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestScheduleNext(t *testing.T) {
+	after := time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	next, err := scheduleNext(Schedule{Cron: "0 2 * * *", Timezone: "Asia/Tokyo"}, after)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 1, 17, 0, 0, 0, time.UTC), next.UTC(), "2:00 in Tokyo is 17:00 UTC")
+
+	next, err = scheduleNext(Schedule{Cron: "@hourly"}, after)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 1, 11, 0, 0, 0, time.UTC), next.UTC())
+
+	next, err = scheduleNext(Schedule{Interval: "15m"}, after)
+	assert.NoError(t, err)
+	assert.Equal(t, after.Add(15*time.Minute), next)
+
+	for _, s := range []Schedule{{Cron: "61 * * * *"}, {Cron: "@daily", Timezone: "Mars/Olympus"}, {Interval: "1s"}, {Interval: "soon"}} {
+		_, err := scheduleNext(s, after)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestSaveSchedule(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	_, err := createTool(ctx, Tool{Name: "cleanup", Category: "commandLine"})
+	assert.NoError(t, err)
+
+	_, err = saveSchedule(ctx, Schedule{Name: "nightly", ToolName: "cleanup", Cron: "0 3 * * *", Interval: "1h"})
+	assert.Error(t, err, "cron and interval are exclusive")
+	_, err = saveSchedule(ctx, Schedule{Name: "nightly", ToolName: "missing", Cron: "0 3 * * *"})
+	assert.ErrorIs(t, err, errToolNotFound)
+	_, err = saveSchedule(ctx, Schedule{Name: "nightly", ToolName: "cleanup", Cron: "CRON_TZ=UTC 0 3 * * *"})
+	assert.Error(t, err)
+	_, err = saveSchedule(ctx, Schedule{Name: "nightly", ToolName: "cleanup", Cron: "0 3 * * *", Overlap: "kill"})
+	assert.Error(t, err)
+
+	s, err := saveSchedule(ctx, Schedule{Name: "nightly", ToolName: "cleanup", Cron: "0 3 * * *", Enabled: true})
+	assert.NoError(t, err)
+	assert.Greater(t, s.NextRunAt, time.Now().UnixMilli())
+
+	resp := model.SetScheduleEnabled(s.ID, false)
+	assert.Empty(t, resp.Error)
+	assert.Zero(t, resp.Item.NextRunAt)
+	assert.Len(t, model.GetScheduleList().List, 1)
+
+	// a schedule whose tool is gone can still be disabled
+	assert.Empty(t, model.SetScheduleEnabled(s.ID, true).Error)
+	_, err = deleteTool(ctx, "cleanup")
+	assert.NoError(t, err)
+	resp = model.SetScheduleEnabled(s.ID, false)
+	assert.Empty(t, resp.Error)
+	assert.False(t, resp.Item.Enabled)
+	assert.Zero(t, resp.Item.NextRunAt)
+	assert.False(t, model.GetScheduleList().List[0].Enabled)
+	assert.NotEmpty(t, model.SetScheduleEnabled(s.ID, true).Error, "enabling should validate the schedule")
+}
+
+func TestSchedulerTick(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	_, err := createTool(ctx, Tool{Name: "report", Category: "commandLine"})
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	release := make(chan struct{})
+	s := newScheduler(func(ctx context.Context, call toolCall) ([]byte, error) {
+		mu.Lock()
+		calls[call.Parameters]++
+		mu.Unlock()
+		if call.Parameters == `"slow"` {
+			<-release
+		}
+		if call.Parameters == `"broken"` {
+			return nil, errors.New("boom")
+		}
+		return []byte("ok"), nil
+	})
+
+	now := time.Now()
+	insert := func(name string, params string, nextRunAt time.Time, catchUp string, overlap string) Schedule {
+		sched := Schedule{Name: name, ToolName: "report", Parameters: params, Interval: "1h", Enabled: true,
+			NextRunAt: nextRunAt.UnixMilli(), CatchUp: catchUp, Overlap: overlap}
+		assert.NoError(t, gorm.G[Schedule](db).Create(ctx, &sched))
+		return sched
+	}
+	due := insert("due", `"due"`, now.Add(-time.Second), "", "")
+	missed := insert("missed", `"missed"`, now.Add(-6*time.Hour), "", "")
+	skipped := insert("skipped", `"skipped"`, now.Add(-6*time.Hour), scheduleCatchUpSkip, "")
+	broken := insert("broken", `"broken"`, now.Add(-time.Second), "", "")
+	later := insert("later", `"later"`, now.Add(10*time.Minute), "", "")
+	slow := insert("slow", `"slow"`, now.Add(-time.Second), "", scheduleOverlapSkip)
+
+	wakeAt, err := s.tick(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.UnixMilli(later.NextRunAt), wakeAt, "the scheduler should wake up for the next run")
+
+	// the slow run is still going on
+	_, err = gorm.G[Schedule](db).Where("id = ?", slow.ID).Update(ctx, "next_run_at", now.Add(-time.Second).UnixMilli())
+	assert.NoError(t, err)
+	_, err = s.tick(ctx, now)
+	assert.NoError(t, err)
+	close(release)
+	s.wg.Wait()
+
+	assert.Equal(t, map[string]int{`"due"`: 1, `"missed"`: 1, `"broken"`: 1, `"slow"`: 1}, calls,
+		"missed runs should run once unless skipped, overlapping runs should be skipped")
+
+	get := func(id int) Schedule {
+		sched, err := gorm.G[Schedule](db).Where("id = ?", id).Take(ctx)
+		assert.NoError(t, err)
+		return sched
+	}
+	assert.Equal(t, "succeeded", get(due.ID).LastStatus)
+	assert.NotEmpty(t, get(due.ID).LastCallID)
+	assert.Equal(t, now.Add(time.Hour).UnixMilli(), get(due.ID).NextRunAt)
+	assert.Equal(t, "succeeded", get(missed.ID).LastStatus)
+	assert.Equal(t, "skipped", get(skipped.ID).LastStatus)
+	assert.Equal(t, "failed", get(broken.ID).LastStatus)
+	assert.Equal(t, "boom", get(broken.ID).LastError)
+	assert.Empty(t, get(later.ID).LastStatus)
+}
+
+// TestFrontendReady goes through the startup of the app: runs missed while the hub was closed are caught up
+// once the frontend evaluating plugins is loaded, not before.
+func TestFrontendReady(t *testing.T) {
+	setupTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		hubScheduler.wg.Wait()
+	}()
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalCache), "false").Error)
+	tool, err := createTool(ctx, Tool{Name: "report", Category: "commandLine", Code: `{"extra": {"sh": "sh", "cmd": "cat", "stdin": "caught up"}}`})
+	assert.NoError(t, err)
+	missed := Schedule{Name: "nightly", ToolName: "report", Parameters: "{}", Interval: "24h", Enabled: true,
+		NextRunAt: time.Now().Add(-6 * time.Hour).UnixMilli()}
+	assert.NoError(t, gorm.G[Schedule](db).Create(ctx, &missed))
+
+	var mu sync.Mutex
+	var evaluated int
+	fakeEvalFrontend(t, func(r EvalToolRequestEvent) {
+		mu.Lock()
+		evaluated++
+		mu.Unlock()
+		deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Success: true, Tool: json.RawMessage(r.Code)})
+	})
+	FrontendReady(ctx)
+	FrontendReady(ctx)
+
+	assert.Eventually(t, func() bool {
+		sched, err := gorm.G[Schedule](db).Where("id = ?", missed.ID).Take(ctx)
+		return err == nil && sched.LastStatus != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	sched, err := gorm.G[Schedule](db).Where("id = ?", missed.ID).Take(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "succeeded", sched.LastStatus, sched.LastError)
+	assert.Eventually(t, func() bool {
+		_, ok := hubPreflight.get(tool.ID, tool.UpdatedAt)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond, "tools should be checked once the frontend is ready")
+	mu.Lock()
+	assert.Equal(t, 2, evaluated, "the catch-up run and the preflight evaluate the plugin once each")
+	mu.Unlock()
+}
@@ -0,0 +1,303 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// Secrets are values such as API tokens which tools reference as ${secret:NAME} in the environment of
+// command line tools and in the URL, headers and body of HTTP tools. References are resolved right before
+// execution so plaintext never reaches the tools table, and secret values are redacted from tool outputs.
+//
+// Values are encrypted with AES-256-GCM by a key kept in secret.key next to the database, so a copy of the
+// database alone doesn't disclose them.
+
+const secretRedaction = "[REDACTED]"
+
+// minRedactedSecretLength is the length below which values aren't redacted, it would mangle every output.
+const minRedactedSecretLength = 4
+
+var (
+	errSecretNotFound = errors.New("secret not found")
+
+	secretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	secretRefPattern  = regexp.MustCompile(`\$\{secret:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+	// secretKeyPath is the file holding the encryption key, it's replaced in tests.
+	secretKeyPath = func() string { return filepath.Join(hubDataDir(), "secret.key") }
+
+	secretMu     sync.Mutex
+	secretKey    []byte
+	secretValues map[string]string // decrypted secrets by name, nil until loaded
+)
+
+// loadSecretKey reads the encryption key, a new one is generated on first use.
+func loadSecretKey() ([]byte, error) {
+	if secretKey != nil {
+		return secretKey, nil
+	}
+	path := secretKeyPath()
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid secret key in %s", path)
+		}
+		secretKey = key
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	// O_EXCL so that a key can't be replaced while secrets encrypted with it exist
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Write(key); err != nil {
+		return nil, err
+	}
+	secretKey = key
+	return key, nil
+}
+
+func secretCipher() (cipher.AEAD, error) {
+	key, err := loadSecretKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load secret key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret returns base64 of nonce and ciphertext, the name is authenticated so values can't be swapped.
+func encryptSecret(aead cipher.AEAD, name string, value string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecret(aead cipher.AEAD, name string, encrypted string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid ciphertext of secret %s", name)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s: %w", name, err)
+	}
+	return string(plain), nil
+}
+
+// saveSecret creates or replaces the named secret.
+func saveSecret(ctx context.Context, name string, value string, description string) (Secret, error) {
+	if !secretNamePattern.MatchString(name) {
+		return Secret{}, fmt.Errorf("invalid secret name %q, use letters, digits and underscores", name)
+	}
+	if value == "" {
+		return Secret{}, fmt.Errorf("secret value is required")
+	}
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	aead, err := secretCipher()
+	if err != nil {
+		return Secret{}, err
+	}
+	encrypted, err := encryptSecret(aead, name, value)
+	if err != nil {
+		return Secret{}, err
+	}
+	item, err := gorm.G[Secret](db).Where("name = ?", name).Take(ctx)
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		item = Secret{Name: name, Value: encrypted, Description: description}
+		err = gorm.G[Secret](db).Create(ctx, &item)
+	case err == nil:
+		item.Value = encrypted
+		item.Description = description
+		_, err = gorm.G[Secret](db).Where("id = ?", item.ID).Select("value", "description").Updates(ctx, item)
+	}
+	if err != nil {
+		return Secret{}, err
+	}
+	secretValues = nil
+	// results computed with the previous value mustn't be served anymore
+	return item, purgeResultCache(ctx)
+}
+
+func deleteSecret(ctx context.Context, id int) error {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	_, err := gorm.G[Secret](db).Where("id = ?", id).Delete(ctx)
+	secretValues = nil
+	if err != nil {
+		return err
+	}
+	return purgeResultCache(ctx)
+}
+
+// loadSecretValues returns all secrets decrypted, they are cached until secrets change.
+func loadSecretValues(ctx context.Context) (map[string]string, error) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	if secretValues != nil {
+		return secretValues, nil
+	}
+	list, err := gorm.G[Secret](db).Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(list))
+	if len(list) > 0 {
+		aead, err := secretCipher()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range list {
+			if values[s.Name], err = decryptSecret(aead, s.Name, s.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	secretValues = values
+	return values, nil
+}
+
+// resolveSecrets replaces the ${secret:NAME} references in s with the values of the secrets.
+func resolveSecrets(ctx context.Context, s string) (string, error) {
+	if !strings.Contains(s, "${secret:") {
+		return s, nil
+	}
+	values, err := loadSecretValues(ctx)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	resolved := secretRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := secretRefPattern.FindStringSubmatch(ref)[1]
+		value, ok := values[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: %s", errSecretNotFound, strings.Join(missing, ", "))
+	}
+	return resolved, nil
+}
+
+// secretRedactor replaces secret values in outputs, longer values first so that overlapping ones are hidden.
+type secretRedactor struct {
+	values [][]byte
+}
+
+func newSecretRedactor(ctx context.Context) (*secretRedactor, error) {
+	values, err := loadSecretValues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := &secretRedactor{}
+	for _, v := range values {
+		if len(v) >= minRedactedSecretLength {
+			r.values = append(r.values, []byte(v))
+		}
+	}
+	sort.Slice(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+	return r, nil
+}
+
+func (r *secretRedactor) redact(data []byte) []byte {
+	for _, v := range r.values {
+		data = bytes.ReplaceAll(data, v, []byte(secretRedaction))
+	}
+	return data
+}
+
+func (r *secretRedactor) redactString(s string) string {
+	return string(r.redact([]byte(s)))
+}
+
+// #region Secret Bindings
+
+type RespSaveSecret struct {
+	Error string `json:"error"`
+	Item  Secret `json:"item"`
+}
+
+// SaveSecret creates or replaces a secret, its value can't be read back.
+func (m *Model) SaveSecret(name string, value string, description string) (resp RespSaveSecret) {
+	var err error
+	resp.Item, err = saveSecret(m.ctx, name, value, description)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to save secret: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespGetSecretList struct {
+	Error string   `json:"error"`
+	List  []Secret `json:"list"`
+}
+
+func (m *Model) GetSecretList() (resp RespGetSecretList) {
+	list, err := gorm.G[Secret](db).Order("name").Find(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to list secrets: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	resp.List = list
+	return
+}
+
+type RespDeleteSecret struct {
+	Error string `json:"error"`
+}
+
+func (m *Model) DeleteSecret(id int) (resp RespDeleteSecret) {
+	if err := deleteSecret(m.ctx, id); err != nil {
+		resp.Error = fmt.Sprintf("failed to delete secret: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// #endregion
@@ -0,0 +1,102 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// setupTestSecrets uses a fresh secret key for the duration of a test.
+func setupTestSecrets(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	oldPath := secretKeyPath
+	secretKeyPath = func() string { return filepath.Join(dir, "secret.key") }
+	secretKey, secretValues = nil, nil
+	t.Cleanup(func() {
+		secretKeyPath = oldPath
+		secretKey, secretValues = nil, nil
+	})
+}
+
+func TestSecrets(t *testing.T) {
+	setupTestDB(t)
+	setupTestSecrets(t)
+	ctx := context.Background()
+
+	_, err := saveSecret(ctx, "bad-name", "x", "")
+	assert.Error(t, err)
+	item, err := saveSecret(ctx, "GITHUB_TOKEN", "ghp_first", "")
+	assert.NoError(t, err)
+	assert.NoError(t, storeCachedResult(ctx, "repos", "k1", []byte("computed with ghp_first"), time.Hour))
+	_, err = saveSecret(ctx, "GITHUB_TOKEN", "ghp_second", "rotated")
+	assert.NoError(t, err)
+	_, ok := lookupCachedResult(ctx, "k1")
+	assert.False(t, ok, "cached results should be purged when a secret changes")
+
+	stored, err := gorm.G[Secret](db).Where("id = ?", item.ID).Take(ctx)
+	assert.NoError(t, err)
+	assert.NotContains(t, stored.Value, "ghp_second", "value should be encrypted at rest")
+	data, err := json.Marshal(model.GetSecretList())
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), stored.Value)
+	assert.Contains(t, string(data), "rotated")
+
+	resolved, err := resolveSecrets(ctx, "token ${secret:GITHUB_TOKEN}")
+	assert.NoError(t, err)
+	assert.Equal(t, "token ghp_second", resolved)
+	_, err = resolveSecrets(ctx, "${secret:MISSING}")
+	assert.ErrorIs(t, err, errSecretNotFound)
+
+	// values are read back with the key file after a restart
+	secretKey, secretValues = nil, nil
+	redactor, err := newSecretRedactor(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "auth: [REDACTED]", redactor.redactString("auth: ghp_second"))
+
+	assert.NoError(t, storeCachedResult(ctx, "repos", "k2", []byte("computed with ghp_second"), time.Hour))
+	assert.NoError(t, deleteSecret(ctx, item.ID))
+	_, ok = lookupCachedResult(ctx, "k2")
+	assert.False(t, ok)
+	_, err = resolveSecrets(ctx, "${secret:GITHUB_TOKEN}")
+	assert.ErrorIs(t, err, errSecretNotFound)
+}
+
+func TestExecuteHTTPTool_secrets(t *testing.T) {
+	setupTestDB(t)
+	setupTestSecrets(t)
+	ctx := context.Background()
+	_, err := saveSecret(ctx, "API_KEY", "s3cret-key", "")
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "Bearer s3cret-key", r.Header.Get("Authorization"))
+		assert.Equal(t, "1", r.URL.Query().Get("page"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		w.Write([]byte("echo s3cret-key"))
+	}))
+	defer server.Close()
+
+	toolData, _ := json.Marshal(HTTPTool{Extra: HTTPToolExtra{
+		URL:     server.URL + "/items",
+		Method:  "post",
+		Query:   `{"page": "1"}`,
+		Headers: map[string]string{"Authorization": "Bearer ${secret:API_KEY}"},
+		Body:    `{"a": 1}`,
+	}})
+	out, err := executeHTTPTool(ctx, toolData)
+	assert.NoError(t, err)
+	assert.Equal(t, "echo s3cret-key", string(out), "redaction is done by executeToolCall")
+
+	toolData, _ = json.Marshal(HTTPTool{Extra: HTTPToolExtra{URL: server.URL, Headers: map[string]string{"X": "${secret:NOPE}"}}})
+	_, err = executeHTTPTool(ctx, toolData)
+	assert.ErrorIs(t, err, errSecretNotFound)
+}
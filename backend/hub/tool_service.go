@@ -0,0 +1,687 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The tool service holds the operations on the tool catalog shared by the Model bindings and the HTTP API.
+
+var (
+	errToolExists  = errors.New("tool already exists")
+	errToolDeleted = errors.New("tool is deleted")
+	errInvalidTool = errors.New("invalid tool")
+	errToolDraft   = errors.New("tool is a draft")
+)
+
+// ToolFilter filters and paginates the tool list.
+type ToolFilter struct {
+	// Query is a full-text search of name, description, parameter names and tags, every term is a prefix.
+	// Tools are ranked by relevance when it's set, they are ordered by name otherwise.
+	Query     string `json:"query"`
+	Namespace string `json:"namespace"` // tools named "<namespace>.<name>", nested namespaces included
+	Category  string `json:"category"`
+	Tag       string `json:"tag"`
+	Status    string `json:"status"`  // lifecycle status, see ToolStatusActive
+	Deleted   bool   `json:"deleted"` // list soft deleted tools instead of the others
+	Offset    int    `json:"offset"`
+	Limit     int    `json:"limit"` // 0 means no limit
+}
+
+// toolBriefColumns are the columns of ToolBrief.
+const toolBriefColumns = "id, name, description, category, tags, status, source_missing, updated_at"
+
+// toolNamespace returns the namespace of a tool, its name up to the last ".", e.g. "git" for "git.diff".
+func toolNamespace(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// completeBriefs fills the fields of tools which aren't columns, their namespace and their latest preflight result.
+func completeBriefs(tools []ToolBrief) []ToolBrief {
+	for i := range tools {
+		tools[i].Namespace = toolNamespace(tools[i].Name)
+		if result, ok := hubPreflight.get(tools[i].ID, tools[i].UpdatedAt); ok {
+			tools[i].Preflight = &result
+		}
+	}
+	return tools
+}
+
+// toolRank orders the tools matching the full-text query match, bm25 weights the columns of tools_fts
+// (name, description, params, tags). FTS4 has no ranking function, tools whose name starts with or contains
+// the first term come first then.
+func toolRank(match string, query string) clause.Expression {
+	if ftsModules["tools_fts"] == "fts5" {
+		return clause.Expr{
+			SQL:  "(SELECT bm25(tools_fts, 10.0, 2.0, 4.0, 5.0) FROM tools_fts WHERE tools_fts MATCH ? AND tools_fts.rowid = tools.id), name",
+			Vars: []any{match},
+		}
+	}
+	term := escapeLike(strings.Fields(query)[0])
+	return clause.Expr{
+		SQL:  `CASE WHEN name LIKE ? ESCAPE '\' THEN 0 WHEN name LIKE ? ESCAPE '\' THEN 1 ELSE 2 END, name`,
+		Vars: []any{term + "%", "%" + term + "%"},
+	}
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, with "\" as escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// ToolPatch holds the fields of a partial tool update, nil fields are left unchanged.
+type ToolPatch struct {
+	Name          *string `json:"name"`
+	Description   *string `json:"description"`
+	Parameters    *string `json:"parameters"`
+	Category      *string `json:"category"`
+	Schema        *string `json:"schema"`
+	Definition    *string `json:"definition"`
+	Code          *string `json:"code"`
+	DefaultParams *string `json:"defaultParams"`
+	Cache         *string `json:"cache"`
+	Tags          *string `json:"tags"`
+	Requires      *string `json:"requires"`
+}
+
+// unscoped makes a query of the gorm generics API include soft deleted rows.
+func unscoped(stmt *gorm.Statement) {
+	stmt.Unscoped = true
+}
+
+// listTools lists tools matching filter, see ToolFilter, with the total count ignoring pagination.
+func listTools(ctx context.Context, filter ToolFilter) ([]ToolBrief, int64, error) {
+	scope := func(*gorm.Statement) {}
+	if filter.Deleted {
+		scope = unscoped
+	}
+	q := gorm.G[ToolBrief](db).Scopes(scope).Select(toolBriefColumns)
+	if filter.Deleted {
+		q = q.Where("deleted_at IS NOT NULL")
+	}
+	var order any = "name"
+	if query := strings.TrimSpace(filter.Query); query != "" {
+		match := ftsMatchQuery("tools_fts", query)
+		q = q.Where("id IN (SELECT rowid FROM tools_fts WHERE tools_fts MATCH ?)", match)
+		order = clause.OrderBy{Expression: toolRank(match, query)}
+	}
+	if filter.Namespace != "" {
+		q = q.Where(`name LIKE ? ESCAPE '\'`, escapeLike(strings.TrimSuffix(filter.Namespace, "."))+".%")
+	}
+	if filter.Category != "" {
+		q = q.Where("category = ?", filter.Category)
+	}
+	if tag := strings.TrimSpace(filter.Tag); tag != "" {
+		q = q.Where("(',' || tags || ',') LIKE ?", "%,"+tag+",%")
+	}
+	if filter.Status == ToolStatusActive {
+		q = q.Where("status IN ?", []string{"", ToolStatusActive})
+	} else if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	total, err := q.Count(ctx, "*")
+	if err != nil {
+		return nil, 0, err
+	}
+	q = q.Order(order)
+	if filter.Offset > 0 {
+		q = q.Offset(filter.Offset)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+	list, err := q.Find(ctx)
+	return completeBriefs(list), total, err
+}
+
+// findTool finds a tool by id when ref is a number, otherwise or when no tool has that id, by name.
+// Soft deleted tools are included when includeDeleted is true.
+func findTool(ctx context.Context, ref string, includeDeleted bool) (Tool, error) {
+	scope := func(*gorm.Statement) {}
+	if includeDeleted {
+		scope = unscoped
+	}
+	q := gorm.G[Tool](db).Scopes(scope)
+	var (
+		tool Tool
+		err  = gorm.ErrRecordNotFound
+	)
+	if id, convErr := strconv.Atoi(ref); convErr == nil {
+		tool, err = q.Where("id = ?", id).Take(ctx)
+	}
+	if err == gorm.ErrRecordNotFound {
+		tool, err = q.Where("name = ?", ref).Take(ctx)
+	}
+	if err == gorm.ErrRecordNotFound {
+		return tool, fmt.Errorf("%w: %s", errToolNotFound, ref)
+	}
+	return tool, err
+}
+
+func validateTool(tool Tool) error {
+	if strings.TrimSpace(tool.Name) == "" {
+		return fmt.Errorf("%w: name is required", errInvalidTool)
+	}
+	if tool.Parameters != "" && !json.Valid([]byte(tool.Parameters)) {
+		return fmt.Errorf("%w: parameters should be a JSON schema", errInvalidTool)
+	}
+	if tool.DefaultParams != "" && !json.Valid([]byte(tool.DefaultParams)) {
+		return fmt.Errorf("%w: default parameters should be JSON", errInvalidTool)
+	}
+	if CategoryOfTool(tool.Category) == CategoryPipeline {
+		if _, err := parsePipeline(tool.Code); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidTool, err)
+		}
+	}
+	if _, err := parseCachePolicy(tool.Cache); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidTool, err)
+	}
+	if _, err := parseRequirements(tool.Requires); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidTool, err)
+	}
+	if !validToolStatus(tool.Status) {
+		return fmt.Errorf("%w: unknown status %q", errInvalidTool, tool.Status)
+	}
+	return nil
+}
+
+// createTool creates a tool, it fails when the name is taken, even by a soft deleted tool. The lifecycle fields
+// of tool are reset, see newToolLifecycle.
+func createTool(ctx context.Context, tool Tool) (Tool, error) {
+	tool.Tags = normalizeTags(tool.Tags)
+	if err := validateTool(tool); err != nil {
+		return tool, err
+	}
+	old, err := gorm.G[Tool](db).Scopes(unscoped).Where("name = ?", tool.Name).Take(ctx)
+	if err == nil {
+		if old.DeletedAt.Valid {
+			return tool, fmt.Errorf("%w: %s, restore it instead", errToolDeleted, tool.Name)
+		}
+		return tool, fmt.Errorf("%w: %s", errToolExists, tool.Name)
+	}
+	if err != gorm.ErrRecordNotFound {
+		return tool, err
+	}
+	tool.BaseModel = BaseModel{}
+	tool.DeletedAt = gorm.DeletedAt{}
+	tool = newToolLifecycle(tool)
+	if err := gorm.G[Tool](db).Create(ctx, &tool); err != nil {
+		return tool, err
+	}
+	catalogChanged()
+	return tool, nil
+}
+
+// toolDefinitionColumns are the columns replaced when a tool is saved again.
+var toolDefinitionColumns = []string{"description", "parameters", "category", "schema", "definition", "code",
+	"default_params", "source_path", "source_missing", "cache", "tags", "requires"}
+
+// saveTool creates the tool or replaces the one with the same name, a soft deleted tool is restored.
+// The lifecycle status of a replaced tool is kept unless tool has one. It's how registerTool stores tools.
+func saveTool(ctx context.Context, tool Tool) (Tool, error) {
+	tool.Tags = normalizeTags(tool.Tags)
+	if err := validateTool(tool); err != nil {
+		return tool, err
+	}
+	old, err := gorm.G[Tool](db).Scopes(unscoped).Where("name = ?", tool.Name).Take(ctx)
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return tool, err
+		}
+		// new tool
+		tool.BaseModel = BaseModel{}
+		tool.DeletedAt = gorm.DeletedAt{}
+		tool = newToolLifecycle(tool)
+		if err := gorm.G[Tool](db).Create(ctx, &tool); err != nil {
+			return tool, err
+		}
+		catalogChanged()
+		return tool, nil
+	}
+	tool.ID = old.ID
+	tool.CreatedAt = old.CreatedAt
+	tool.UpdatedAt = old.UpdatedAt
+	tool.DeletedAt = gorm.DeletedAt{}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if old.DeletedAt.Valid {
+			if err := tx.WithContext(ctx).Unscoped().Model(&Tool{}).Where("id = ?", old.ID).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+		}
+		// every column is written so that fields removed from the definition are cleared
+		columns := toolDefinitionColumns
+		if tool.Status != "" {
+			columns = append(columns[:len(columns):len(columns)], "status")
+		}
+		return tx.WithContext(ctx).Model(&tool).Select(columns).Updates(&tool).Error
+	})
+	if err != nil {
+		return tool, err
+	}
+	catalogChanged()
+	return gorm.G[Tool](db).Where("id = ?", tool.ID).Take(ctx)
+}
+
+// lintedToolColumns are the columns whose change makes updateTool lint the tool again.
+var lintedToolColumns = []string{"parameters", "category", "code", "default_params"}
+
+// updateTool applies patch to the tool referenced by ref. A tool whose definition changes is linted like
+// lintToolStatus does: it fails with errToolHasErrors unless draft is true, then it becomes a draft, and a draft
+// without errors is activated.
+func updateTool(ctx context.Context, ref string, patch ToolPatch, draft bool) (Tool, []ToolIssue, error) {
+	tool, err := findTool(ctx, ref, false)
+	if err != nil {
+		return tool, nil, err
+	}
+	fields := []struct {
+		value  *string
+		target *string
+		column string
+	}{
+		{patch.Name, &tool.Name, "name"},
+		{patch.Description, &tool.Description, "description"},
+		{patch.Parameters, &tool.Parameters, "parameters"},
+		{patch.Category, &tool.Category, "category"},
+		{patch.Schema, &tool.Schema, "schema"},
+		{patch.Definition, &tool.Definition, "definition"},
+		{patch.Code, &tool.Code, "code"},
+		{patch.DefaultParams, &tool.DefaultParams, "default_params"},
+		{patch.Cache, &tool.Cache, "cache"},
+		{patch.Tags, &tool.Tags, "tags"},
+		{patch.Requires, &tool.Requires, "requires"},
+	}
+	columns := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f.value != nil {
+			*f.target = *f.value
+			columns = append(columns, f.column)
+		}
+	}
+	if len(columns) == 0 {
+		return tool, nil, nil
+	}
+	tool.Tags = normalizeTags(tool.Tags)
+	if err := validateTool(tool); err != nil {
+		return tool, nil, err
+	}
+	if patch.Name != nil {
+		taken, err := gorm.G[Tool](db).Scopes(unscoped).Where("name = ? AND id <> ?", tool.Name, tool.ID).Count(ctx, "*")
+		if err != nil {
+			return tool, nil, err
+		}
+		if taken > 0 {
+			return tool, nil, fmt.Errorf("%w: %s", errToolExists, tool.Name)
+		}
+	}
+	var issues []ToolIssue
+	if slices.ContainsFunc(columns, func(column string) bool { return slices.Contains(lintedToolColumns, column) }) {
+		status := tool.Status
+		tool, issues, err = lintToolStatus(ctx, tool, draft)
+		if err != nil {
+			return tool, issues, err
+		}
+		// lintToolStatus looks the stored tool up by name, which the patch may change
+		switch {
+		case tool.Status == ToolStatusDraft:
+		case status == ToolStatusDraft:
+			tool.Status = ToolStatusActive
+		default:
+			tool.Status = status
+		}
+		columns = append(columns, "status")
+	}
+	if err := db.WithContext(ctx).Model(&tool).Select(columns).Updates(&tool).Error; err != nil {
+		return tool, issues, err
+	}
+	catalogChanged()
+	return tool, issues, nil
+}
+
+// deleteTool soft deletes the tool referenced by ref.
+func deleteTool(ctx context.Context, ref string) (Tool, error) {
+	tool, err := findTool(ctx, ref, false)
+	if err != nil {
+		return tool, err
+	}
+	if _, err := gorm.G[Tool](db).Where("id = ?", tool.ID).Delete(ctx); err != nil {
+		return tool, err
+	}
+	catalogChanged()
+	return tool, nil
+}
+
+// restoreTool restores the soft deleted tool referenced by ref.
+func restoreTool(ctx context.Context, ref string) (Tool, error) {
+	tool, err := findTool(ctx, ref, true)
+	if err != nil {
+		return tool, err
+	}
+	if !tool.DeletedAt.Valid {
+		return tool, nil
+	}
+	if err := db.WithContext(ctx).Unscoped().Model(&Tool{}).Where("id = ?", tool.ID).Update("deleted_at", nil).Error; err != nil {
+		return tool, err
+	}
+	tool.DeletedAt = gorm.DeletedAt{}
+	catalogChanged()
+	return tool, nil
+}
+
+// evalCommandLineTool evaluates the plugin of a command line tool with parameters.
+func evalCommandLineTool(ctx context.Context, tool Tool, parameters string) (CommandLineTool, error) {
+	var item CommandLineTool
+	toolData, err := EvalTool(ctx, tool.Code, parameters)
+	if err != nil {
+		return item, fmt.Errorf("failed to evaluate tool: %w", err)
+	}
+	if err := json.Unmarshal(toolData, &item); err != nil {
+		return item, fmt.Errorf("failed to parse command line tool: %w", err)
+	}
+	item.BaseModel = tool.BaseModel
+	return item, nil
+}
+
+// evalHTTPTool evaluates the plugin of a HTTP tool with parameters.
+func evalHTTPTool(ctx context.Context, tool Tool, parameters string) (HTTPTool, error) {
+	var item HTTPTool
+	toolData, err := EvalTool(ctx, tool.Code, parameters)
+	if err != nil {
+		return item, fmt.Errorf("failed to evaluate tool: %w", err)
+	}
+	if err := json.Unmarshal(toolData, &item); err != nil {
+		return item, fmt.Errorf("failed to parse HTTP tool: %w", err)
+	}
+	item.BaseModel = tool.BaseModel
+	return item, nil
+}
+
+// evaluateTool evaluates the plugin of a tool with parameters, or its default parameters when empty,
+// into a CommandLineTool, a HTTPTool or a PipelineDefinition according to its category.
+func evaluateTool(ctx context.Context, tool Tool, parameters string) (any, error) {
+	if parameters == "" {
+		parameters = tool.DefaultParams
+	}
+	switch CategoryOfTool(tool.Category) {
+	case CategoryHTTP:
+		return evalHTTPTool(ctx, tool, parameters)
+	case CategoryPipeline:
+		// pipelines have no plugin, their definition is what they evaluate to
+		return parsePipeline(tool.Code)
+	}
+	return evalCommandLineTool(ctx, tool, parameters)
+}
+
+// writeJSON writes v as the JSON body of a response with status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// toolErrorStatus maps an error of the tool service to a HTTP status.
+func toolErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errToolNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errToolExists), errors.Is(err, errToolDeleted), errors.Is(err, errToolDraft):
+		return http.StatusConflict
+	case errors.Is(err, errToolDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, errToolSunset):
+		return http.StatusGone
+	case errors.Is(err, errToolNotReady):
+		return http.StatusFailedDependency
+	case errors.Is(err, errInvalidTool):
+		return http.StatusBadRequest
+	case errors.Is(err, errToolHasErrors):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// listToolsHandler serves GET /api/tools?q=&namespace=&category=&tag=&status=&deleted=true&offset=&limit=
+func listToolsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	query := r.URL.Query()
+	filter := ToolFilter{
+		Query:     query.Get("q"),
+		Namespace: query.Get("namespace"),
+		Category:  query.Get("category"),
+		Tag:       query.Get("tag"),
+		Status:    query.Get("status"),
+		Deleted:   query.Get("deleted") == "true",
+	}
+	filter.Offset, _ = strconv.Atoi(query.Get("offset"))
+	filter.Limit, _ = strconv.Atoi(query.Get("limit"))
+	var resp RespQueryTools
+	var err error
+	resp.List, resp.Total, err = listTools(ctx, filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list tools: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func getToolHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	tool, err := findTool(ctx, r.PathValue("ref"), r.URL.Query().Get("deleted") == "true")
+	if err != nil {
+		http.Error(w, err.Error(), toolErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, RespSaveTool{Item: tool})
+}
+
+func createToolHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	var tool Tool
+	if err := json.NewDecoder(r.Body).Decode(&tool); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	tool, issues, err := lintToolStatus(ctx, tool, r.URL.Query().Get("draft") == "true")
+	if err != nil {
+		writeJSON(w, toolErrorStatus(err), RespSaveTool{Error: err.Error(), Issues: issues})
+		return
+	}
+	tool, err = createTool(ctx, tool)
+	if err != nil {
+		http.Error(w, err.Error(), toolErrorStatus(err))
+		return
+	}
+	w.Header().Set("Location", "/api/tools/"+url.PathEscape(tool.Name))
+	writeJSON(w, http.StatusCreated, RespSaveTool{Item: tool, Issues: issues, Preflight: preflightStoredTool(ctx, tool)})
+}
+
+func updateToolHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	var patch ToolPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	tool, issues, err := updateTool(ctx, r.PathValue("ref"), patch, r.URL.Query().Get("draft") == "true")
+	if errors.Is(err, errToolHasErrors) {
+		writeJSON(w, toolErrorStatus(err), RespSaveTool{Error: err.Error(), Issues: issues})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), toolErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, RespSaveTool{Item: tool, Issues: issues, Preflight: preflightStoredTool(ctx, tool)})
+}
+
+func deleteToolHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	tool, err := deleteTool(ctx, r.PathValue("ref"))
+	if err != nil {
+		http.Error(w, err.Error(), toolErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, RespSaveTool{Item: tool})
+}
+
+func restoreToolHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	tool, err := restoreTool(ctx, r.PathValue("ref"))
+	if err != nil {
+		http.Error(w, err.Error(), toolErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, RespSaveTool{Item: tool})
+}
+
+// BodyEvaluateTool is the body of POST /api/tools/{ref}/evaluate, empty parameters use the default ones.
+type BodyEvaluateTool struct {
+	Parameters string `json:"parameters"`
+}
+
+func evaluateToolHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	var body BodyEvaluateTool
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	tool, err := findTool(ctx, r.PathValue("ref"), false)
+	if err != nil {
+		http.Error(w, err.Error(), toolErrorStatus(err))
+		return
+	}
+	item, err := evaluateTool(ctx, tool, body.Parameters)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, http.StatusOK, RespEvaluateTool{Item: item})
+}
+
+// #region Tool Service Bindings
+
+type RespQueryTools struct {
+	Error string      `json:"error"`
+	List  []ToolBrief `json:"list"`
+	Total int64       `json:"total"`
+}
+
+// QueryTools lists tools with filtering and pagination.
+func (m *Model) QueryTools(filter ToolFilter) (resp RespQueryTools) {
+	var err error
+	resp.List, resp.Total, err = listTools(m.ctx, filter)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to list tools: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespSaveTool struct {
+	Error     string           `json:"error"`
+	Item      Tool             `json:"item"`
+	Issues    []ToolIssue      `json:"issues,omitempty"`    // found by lintTool when the tool is created or its definition changes
+	Preflight *PreflightResult `json:"preflight,omitempty"` // of the created or updated tool, nil for drafts
+}
+
+// CreateTool creates a tool, a tool with errors is created as a draft, see resp.Issues.
+func (m *Model) CreateTool(tool Tool) (resp RespSaveTool) {
+	tool, issues, err := lintToolStatus(m.ctx, tool, true)
+	if err == nil {
+		resp.Issues = issues
+		resp.Item, err = createTool(m.ctx, tool)
+	}
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to create tool: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	resp.Preflight = preflightStoredTool(m.ctx, resp.Item)
+	return
+}
+
+// UpdateTool applies patch to a tool, a tool with errors becomes a draft, see resp.Issues.
+func (m *Model) UpdateTool(id int, patch ToolPatch) (resp RespSaveTool) {
+	var err error
+	resp.Item, resp.Issues, err = updateTool(m.ctx, strconv.Itoa(id), patch, true)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to update tool: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	resp.Preflight = preflightStoredTool(m.ctx, resp.Item)
+	return
+}
+
+func (m *Model) DeleteTool(id int) (resp RespSaveTool) {
+	var err error
+	resp.Item, err = deleteTool(m.ctx, strconv.Itoa(id))
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to delete tool: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+func (m *Model) RestoreTool(id int) (resp RespSaveTool) {
+	var err error
+	resp.Item, err = restoreTool(m.ctx, strconv.Itoa(id))
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to restore tool: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespEvaluateTool struct {
+	Error string `json:"error"`
+	Item  any    `json:"item"` // CommandLineTool or HTTPTool according to the category of the tool
+}
+
+// EvaluateTool evaluates the plugin of a tool with parameters, empty parameters use the default ones.
+func (m *Model) EvaluateTool(id int, parameters string) (resp RespEvaluateTool) {
+	tool, err := findTool(m.ctx, strconv.Itoa(id), false)
+	if err == nil {
+		resp.Item, err = evaluateTool(m.ctx, tool, parameters)
+	}
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to evaluate tool: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// #endregion
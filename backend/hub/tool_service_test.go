@@ -0,0 +1,220 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToolService(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+
+	echo, err := createTool(ctx, Tool{Name: "echo", Description: "print text", Category: "commandLine"})
+	assert.NoError(t, err)
+	assert.NotZero(t, echo.ID)
+	_, err = createTool(ctx, Tool{Name: "fetch", Description: "get a url", Category: "http"})
+	assert.NoError(t, err)
+
+	_, err = createTool(ctx, Tool{Name: "echo"})
+	assert.ErrorIs(t, err, errToolExists)
+	_, err = createTool(ctx, Tool{Name: "bad", DefaultParams: "{"})
+	assert.ErrorIs(t, err, errInvalidTool)
+
+	list, total, err := listTools(ctx, ToolFilter{Query: "url"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "fetch", list[0].Name)
+	list, total, err = listTools(ctx, ToolFilter{Limit: 1, Offset: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total, "total should ignore pagination")
+	assert.Equal(t, "fetch", list[0].Name)
+
+	byID, err := findTool(ctx, strconv.Itoa(echo.ID), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "echo", byID.Name)
+
+	description := "print text to stdout"
+	updated, _, err := updateTool(ctx, "echo", ToolPatch{Description: &description}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, description, updated.Description)
+	assert.Equal(t, "commandLine", updated.Category, "fields missing from the patch should be kept")
+	name := "fetch"
+	_, _, err = updateTool(ctx, "echo", ToolPatch{Name: &name}, false)
+	assert.ErrorIs(t, err, errToolExists)
+
+	_, err = deleteTool(ctx, "echo")
+	assert.NoError(t, err)
+	_, err = findTool(ctx, "echo", false)
+	assert.ErrorIs(t, err, errToolNotFound)
+	list, _, err = listTools(ctx, ToolFilter{Deleted: true})
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	_, err = createTool(ctx, Tool{Name: "echo"})
+	assert.ErrorIs(t, err, errToolDeleted)
+
+	restored, err := restoreTool(ctx, "echo")
+	assert.NoError(t, err)
+	assert.False(t, restored.DeletedAt.Valid)
+	_, total, err = listTools(ctx, ToolFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+}
+
+func TestSearchTools(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	for _, tool := range []Tool{
+		{Name: "git.diff", Description: "show changes", Category: "commandLine", Tags: " git, vcs,git",
+			Parameters: `{"type": "object", "properties": {"staged": {"type": "boolean"}}}`},
+		{Name: "git.log", Description: "show the history", Category: "commandLine", Tags: "git"},
+		{Name: "acme.git.blame", Description: "who changed a line", Category: "commandLine"},
+		{Name: "patch", Description: "apply a diff", Category: "commandLine", Parameters: "[]"},
+		{Name: "fetch", Description: "get a url", Category: "http", Tags: "web"},
+	} {
+		_, err := saveTool(ctx, tool)
+		assert.NoError(t, err, tool.Name)
+	}
+	names := func(filter ToolFilter) []string {
+		list, _, err := listTools(ctx, filter)
+		assert.NoError(t, err)
+		var names []string
+		for _, tool := range list {
+			names = append(names, tool.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"git.diff", "patch"}, names(ToolFilter{Query: "diff"}), "name matches should rank first")
+	assert.Equal(t, []string{"git.diff"}, names(ToolFilter{Query: "stag"}), "parameter names should be searched")
+	assert.Equal(t, []string{"git.diff"}, names(ToolFilter{Query: "vcs show"}))
+	assert.Empty(t, names(ToolFilter{Query: `"*`}))
+	assert.Equal(t, []string{"git.diff", "git.log"}, names(ToolFilter{Namespace: "git"}))
+	assert.Equal(t, []string{"acme.git.blame"}, names(ToolFilter{Namespace: "acme"}), "nested namespaces should be included")
+	assert.Equal(t, []string{"git.diff", "git.log"}, names(ToolFilter{Tag: "git"}))
+	assert.Equal(t, []string{"fetch"}, names(ToolFilter{Query: "url", Category: "http"}))
+
+	list, total, err := listTools(ctx, ToolFilter{Query: "git", Limit: 1, Offset: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Len(t, list, 1)
+	tool, err := findTool(ctx, "git.diff", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "git,vcs", tool.Tags)
+	list, _, _ = listTools(ctx, ToolFilter{Tag: "vcs"})
+	assert.Equal(t, "git", list[0].Namespace)
+
+	// the index follows the changes of tools
+	name, tags := "vcs.diff", "vcs"
+	_, _, err = updateTool(ctx, "git.diff", ToolPatch{Name: &name, Tags: &tags}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vcs.diff"}, names(ToolFilter{Query: "staged"}))
+	assert.Equal(t, []string{"git.log"}, names(ToolFilter{Tag: "git"}))
+	_, err = deleteTool(ctx, "patch")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vcs.diff"}, names(ToolFilter{Query: "diff"}))
+}
+
+func TestSaveTool_restoresDeleted(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+
+	created, err := saveTool(ctx, Tool{Name: "echo", Code: "v1"})
+	assert.NoError(t, err)
+	_, err = deleteTool(ctx, "echo")
+	assert.NoError(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+	saved, err := saveTool(ctx, Tool{Name: "echo", Code: "v2"})
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, saved.ID)
+	assert.Equal(t, "v2", saved.Code)
+	assert.False(t, saved.DeletedAt.Valid)
+}
+
+func TestToolsAPI(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalCache), "false").Error)
+	fakeEvalFrontend(t, func(r EvalToolRequestEvent) {
+		deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Success: true, Tool: json.RawMessage(r.Code)})
+	})
+	token, _, err := createAPIToken(ctx, "scripts", []string{ScopeToolsRead, ScopeToolsRegister}, nil, 0)
+	assert.NoError(t, err)
+	handler := newHubHandler(ctx)
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := `{"name": "echo", "category": "commandLine", "code": "{\"extra\": {\"cmd\": \"echo\"}}"}`
+	rec := serve(http.MethodPost, "/api/tools", body)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "/api/tools/echo", rec.Header().Get("Location"))
+	var created RespSaveTool
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.True(t, created.Preflight.Ready, "created tools should be checked")
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, "/api/tools", body).Code)
+
+	// tools with errors are refused unless they are created as drafts
+	rec = serve(http.MethodPost, "/api/tools", `{"name": "list", "category": "commandLine", "code": "{}"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	var refused RespSaveTool
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &refused))
+	assert.Equal(t, "extra.cmd", refused.Issues[len(refused.Issues)-1].Field)
+	rec = serve(http.MethodPost, "/api/tools?draft=true", `{"name": "list", "category": "commandLine", "code": "{}"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var draft RespSaveTool
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &draft))
+	assert.Equal(t, ToolStatusDraft, draft.Item.Status)
+
+	rec = serve(http.MethodPatch, "/api/tools/echo", `{"description": "print text"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var saved RespSaveTool
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &saved))
+	assert.Equal(t, "print text", saved.Item.Description)
+
+	// a patched definition is linted again
+	rec = serve(http.MethodPatch, "/api/tools/echo", `{"code": "{}"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	var rejected RespSaveTool
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rejected))
+	assert.Equal(t, "extra.cmd", rejected.Issues[len(rejected.Issues)-1].Field)
+	echo, err := findTool(ctx, "echo", false)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"extra": {"cmd": "echo"}}`, echo.Code, "a rejected patch shouldn't be stored")
+	rec = serve(http.MethodPatch, "/api/tools/echo?draft=true", `{"code": "{}"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var draftPatched RespSaveTool
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &draftPatched))
+	assert.Equal(t, ToolStatusDraft, draftPatched.Item.Status)
+	assert.Nil(t, draftPatched.Preflight, "drafts aren't checked")
+	rec = serve(http.MethodPatch, "/api/tools/echo", `{"code": "{\"extra\": {\"cmd\": \"echo\"}}"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &saved))
+	assert.Equal(t, ToolStatusActive, saved.Item.Status, "a fixed draft should be activated")
+	_, ok := hubPreflight.get(saved.Item.ID, saved.Item.UpdatedAt)
+	assert.True(t, ok, "updated tools should be checked")
+
+	rec = serve(http.MethodGet, "/api/tools?q=print", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var listed RespQueryTools
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	assert.Equal(t, int64(1), listed.Total)
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "/api/tools/echo", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/tools/echo", "").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/tools/echo?deleted=true", "").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/tools/echo/restore", "").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/tools/"+strconv.Itoa(saved.Item.ID), "").Code)
+}
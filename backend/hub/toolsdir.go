@@ -0,0 +1,345 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// The directory of the ToolsDir setting is a source of tools, e.g. a git checkout. Every tool is described by
+// a manifest named <name>.tool.json next to its plugin code:
+//
+//	tools/
+//	  echo.tool.json    {"name": "echo", "description": "...", "category": "commandLine", "parameters": {...}}
+//	  echo.js           plugin code, or the file named by "code" in the manifest
+//
+// The directory is scanned once the frontend is ready, see FrontendReady, and watched afterwards. Tools are
+// linted and stored with saveTool like registerTool does, tools with errors are stored as drafts. Tools whose
+// manifest disappeared are kept but marked with SourceMissing.
+
+const (
+	toolManifestSuffix = ".tool.json"
+	toolsDirDebounce   = 500 * time.Millisecond
+)
+
+// toolManifest is the content of a <name>.tool.json file.
+type toolManifest struct {
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	Category      string          `json:"category"`
+	Parameters    json.RawMessage `json:"parameters"` // JSON schema of parameters
+	Schema        string          `json:"schema"`
+	Definition    string          `json:"definition"`
+	DefaultParams json.RawMessage `json:"defaultParams"`
+	Code          string          `json:"code"`  // path of the plugin code relative to the manifest, defaults to <name>.js
+	Cache         json.RawMessage `json:"cache"` // CachePolicy
+	Tags          []string        `json:"tags"`
+	Requires      json.RawMessage `json:"requires"` // ToolRequirements
+}
+
+// ToolSyncResult reports what syncing the tools directory did to a manifest or a tool.
+type ToolSyncResult struct {
+	Path   string      `json:"path"`
+	Name   string      `json:"name"`
+	Action string      `json:"action"` // "created", "updated", "unchanged", "missing" or "error"
+	Error  string      `json:"error"`
+	Issues []ToolIssue `json:"issues"` // found by lintTool in a created or updated tool
+	Draft  bool        `json:"draft"`  // the tool has errors and was stored as a draft
+}
+
+var (
+	toolsDirMu          sync.Mutex
+	toolsDirStop        context.CancelFunc
+	toolsDirSyncResults []ToolSyncResult
+)
+
+// loadToolManifest reads the manifest at path and the plugin code it refers to.
+func loadToolManifest(path string) (Tool, error) {
+	var tool Tool
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return tool, err
+	}
+	var manifest toolManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return tool, fmt.Errorf("invalid manifest: %w", err)
+	}
+	base := strings.TrimSuffix(filepath.Base(path), toolManifestSuffix)
+	if manifest.Name == "" {
+		manifest.Name = base
+	}
+	codePath := manifest.Code
+	if codePath == "" {
+		codePath = base + ".js"
+	}
+	if !filepath.IsAbs(codePath) {
+		codePath = filepath.Join(filepath.Dir(path), codePath)
+	}
+	code, err := os.ReadFile(codePath)
+	if err != nil {
+		return tool, fmt.Errorf("failed to read plugin code: %w", err)
+	}
+	tool = Tool{
+		Name:          manifest.Name,
+		Description:   manifest.Description,
+		Category:      manifest.Category,
+		Parameters:    string(manifest.Parameters),
+		Schema:        manifest.Schema,
+		Definition:    manifest.Definition,
+		Code:          string(code),
+		DefaultParams: string(manifest.DefaultParams),
+		Cache:         string(manifest.Cache),
+		Tags:          normalizeTags(strings.Join(manifest.Tags, ",")),
+		Requires:      string(manifest.Requires),
+		SourcePath:    path,
+	}
+	return tool, nil
+}
+
+// sameToolSource reports whether a stored tool already matches the tool loaded from its manifest.
+func sameToolSource(stored Tool, loaded Tool) bool {
+	return !stored.DeletedAt.Valid && !stored.SourceMissing &&
+		stored.SourcePath == loaded.SourcePath &&
+		stored.Description == loaded.Description &&
+		stored.Category == loaded.Category &&
+		stored.Parameters == loaded.Parameters &&
+		stored.Schema == loaded.Schema &&
+		stored.Definition == loaded.Definition &&
+		stored.Code == loaded.Code &&
+		stored.DefaultParams == loaded.DefaultParams &&
+		stored.Cache == loaded.Cache &&
+		stored.Tags == loaded.Tags &&
+		stored.Requires == loaded.Requires
+}
+
+// syncToolsDir registers the tools of every manifest found in dir and marks the tools whose manifest is gone.
+// Errors of a manifest are reported in its result and don't stop the sync.
+func syncToolsDir(ctx context.Context, dir string) ([]ToolSyncResult, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var manifests []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && skipToolsSubdir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), toolManifestSuffix) {
+			manifests = append(manifests, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan tools directory: %w", err)
+	}
+
+	results := make([]ToolSyncResult, 0, len(manifests))
+	seenNames := map[string]string{} // name of the tool -> manifest defining it
+	failedPaths := map[string]bool{} // the tools of these manifests are unknown
+	for _, path := range manifests {
+		result := ToolSyncResult{Path: path}
+		tool, err := loadToolManifest(path)
+		result.Name = tool.Name
+		if err == nil {
+			if other, ok := seenNames[tool.Name]; ok {
+				err = fmt.Errorf("tool %s is already defined by %s", tool.Name, other)
+			}
+		}
+		if err == nil {
+			seenNames[tool.Name] = path
+			result.Action, result.Issues, err = syncTool(ctx, tool)
+			result.Draft = hasErrors(result.Issues)
+		}
+		if err != nil {
+			failedPaths[path] = true
+			result.Action = "error"
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	synced, err := gorm.G[Tool](db).Where("source_path <> '' AND source_missing = ?", false).Find(ctx)
+	if err != nil {
+		return results, err
+	}
+	for _, tool := range synced {
+		if seenNames[tool.Name] == tool.SourcePath || failedPaths[tool.SourcePath] {
+			continue
+		}
+		if _, err := gorm.G[Tool](db).Where("id = ?", tool.ID).Update(ctx, "source_missing", true); err != nil {
+			return results, err
+		}
+		results = append(results, ToolSyncResult{Path: tool.SourcePath, Name: tool.Name, Action: "missing"})
+	}
+	return results, nil
+}
+
+// syncTool stores a tool loaded from a manifest unless it's unchanged, a tool with errors is stored as a draft.
+// The requirements of a stored tool are checked, see preflightStoredTool.
+func syncTool(ctx context.Context, tool Tool) (string, []ToolIssue, error) {
+	stored, err := gorm.G[Tool](db).Scopes(unscoped).Where("name = ?", tool.Name).Take(ctx)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return "", nil, err
+	}
+	exists := err == nil
+	if exists && sameToolSource(stored, tool) {
+		return "unchanged", nil, nil
+	}
+	tool, issues, err := lintToolStatus(ctx, tool, true)
+	if err != nil {
+		return "", issues, err
+	}
+	saved, err := saveTool(ctx, tool)
+	if err != nil {
+		return "", issues, err
+	}
+	preflightStoredTool(ctx, saved)
+	if exists {
+		return "updated", issues, nil
+	}
+	return "created", issues, nil
+}
+
+func skipToolsSubdir(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "node_modules"
+}
+
+// startToolsDirSync syncs the directory of the ToolsDir setting and watches it, a previous watcher is stopped.
+func startToolsDirSync(ctx context.Context) {
+	toolsDirMu.Lock()
+	if toolsDirStop != nil {
+		toolsDirStop()
+		toolsDirStop = nil
+	}
+	dir := getSetting(ctx, SettingKeyToolDir, "")
+	if dir == "" {
+		toolsDirMu.Unlock()
+		return
+	}
+	watchCtx, stop := context.WithCancel(ctx)
+	toolsDirStop = stop
+	toolsDirMu.Unlock()
+	go watchToolsDir(watchCtx, dir)
+}
+
+// watchToolsDir syncs dir then again once changes in it settle, until ctx is done.
+func watchToolsDir(ctx context.Context, dir string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		runtime.LogErrorf(ctx, "failed to watch tools directory %s: %v", dir, err)
+		return
+	}
+	defer watcher.Close()
+	addRecursiveWatches(ctx, watcher, dir)
+	runToolsDirSync(ctx, dir)
+
+	debounce := time.NewTimer(toolsDirDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) {
+				if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() && !skipToolsSubdir(fi.Name()) {
+					addRecursiveWatches(ctx, watcher, event.Name)
+				}
+			}
+			debounce.Reset(toolsDirDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			runtime.LogWarningf(ctx, "tools directory watcher: %v", err)
+		case <-debounce.C:
+			runToolsDirSync(ctx, dir)
+		}
+	}
+}
+
+// addRecursiveWatches watches dir and its subdirectories but hidden ones and node_modules, fsnotify isn't recursive.
+func addRecursiveWatches(ctx context.Context, watcher *fsnotify.Watcher, dir string) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != dir && skipToolsSubdir(d.Name()) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			runtime.LogWarningf(ctx, "failed to watch %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// runToolsDirSync syncs dir and reports the results to the UI with the "tools-dir-sync" event.
+func runToolsDirSync(ctx context.Context, dir string) ([]ToolSyncResult, error) {
+	results, err := syncToolsDir(ctx, dir)
+	if err != nil {
+		runtime.LogErrorf(ctx, "failed to sync tools directory %s: %v", dir, err)
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			runtime.LogErrorf(ctx, "failed to sync tool %s: %s", r.Path, r.Error)
+		}
+	}
+	toolsDirMu.Lock()
+	toolsDirSyncResults = results
+	toolsDirMu.Unlock()
+	runtime.EventsEmit(ctx, "tools-dir-sync", results)
+	return results, err
+}
+
+// #region Tools Dir Bindings
+
+type RespSyncToolsDir struct {
+	Error string           `json:"error"`
+	List  []ToolSyncResult `json:"list"`
+}
+
+// SyncToolsDir syncs the tools directory now.
+func (m *Model) SyncToolsDir() (resp RespSyncToolsDir) {
+	dir := getSetting(m.ctx, SettingKeyToolDir, "")
+	if dir == "" {
+		resp.Error = "tools directory is not set"
+		return
+	}
+	var err error
+	resp.List, err = runToolsDirSync(m.ctx, dir)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to sync tools directory: %v", err)
+		return
+	}
+	return
+}
+
+// GetToolsDirSyncResults returns the results of the last sync of the tools directory.
+func (m *Model) GetToolsDirSyncResults() (resp RespSyncToolsDir) {
+	toolsDirMu.Lock()
+	defer toolsDirMu.Unlock()
+	resp.List = append(resp.List, toolsDirSyncResults...)
+	return
+}
+
+// #endregion
@@ -0,0 +1,95 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncToolsDir(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	assert.Empty(t, model.SaveSetting(string(SettingKeyEvalCache), "false").Error)
+	plugins := map[string]string{
+		"export default () => ({cmd: 'echo'})":               `{"extra": {"cmd": "echo"}}`,
+		"export default () => ({url: 'http://example.com'})": `{"extra": {"url": "http://example.com"}}`,
+	}
+	fakeEvalFrontend(t, func(r EvalToolRequestEvent) {
+		tool, ok := plugins[r.Code]
+		if !ok {
+			tool = "{}"
+		}
+		deliverEvalResponse(EvalToolResponseEvent{RequestID: r.RequestID, Success: true, Tool: json.RawMessage(tool)})
+	})
+	dir := t.TempDir()
+	write := func(name string, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	actions := func(results []ToolSyncResult) map[string]string {
+		m := map[string]string{}
+		for _, r := range results {
+			m[filepath.Base(r.Path)] = r.Action
+		}
+		return m
+	}
+
+	write("echo.tool.json", `{"description": "print text", "category": "commandLine", "parameters": {"type": "object"}}`)
+	write("echo.js", "export default () => ({})")
+	write("net/fetch.tool.json", `{"name": "fetch", "category": "http", "code": "main.js"}`)
+	write("net/main.js", "export default () => ({url: 'http://example.com'})")
+	write("broken.tool.json", `{"name": `)
+	write(".git/ignored.tool.json", `{}`)
+
+	results, err := syncToolsDir(ctx, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"echo.tool.json":   "created",
+		"fetch.tool.json":  "created",
+		"broken.tool.json": "error",
+	}, actions(results))
+	echo, err := findTool(ctx, "echo", false)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"type": "object"}`, echo.Parameters)
+	assert.Equal(t, filepath.Join(dir, "echo.tool.json"), echo.SourcePath)
+	assert.Equal(t, ToolStatusDraft, echo.Status, "tools with errors should be stored as drafts")
+	for _, r := range results {
+		assert.Equal(t, r.Name == "echo", r.Draft, r.Path)
+		if r.Name == "echo" {
+			assert.True(t, hasErrors(r.Issues))
+		}
+	}
+
+	write("echo.js", "export default () => ({cmd: 'echo'})")
+	assert.NoError(t, os.Remove(filepath.Join(dir, "net/fetch.tool.json")))
+	results, err = syncToolsDir(ctx, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"echo.tool.json":   "updated",
+		"fetch.tool.json":  "missing",
+		"broken.tool.json": "error",
+	}, actions(results))
+	echo, err = findTool(ctx, "echo", false)
+	assert.NoError(t, err)
+	assert.Equal(t, ToolStatusActive, echo.Status, "the draft should be promoted once fixed")
+	_, ok := hubPreflight.get(echo.ID, echo.UpdatedAt)
+	assert.True(t, ok, "synced tools should be checked")
+	fetch, err := findTool(ctx, "fetch", false)
+	assert.NoError(t, err)
+	assert.True(t, fetch.SourceMissing)
+
+	write("net/fetch.tool.json", `{"name": "fetch", "category": "http", "code": "main.js"}`)
+	results, err = syncToolsDir(ctx, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "unchanged", actions(results)["echo.tool.json"])
+	assert.Equal(t, "updated", actions(results)["fetch.tool.json"])
+	fetch, err = findTool(ctx, "fetch", false)
+	assert.NoError(t, err)
+	assert.False(t, fetch.SourceMissing)
+}
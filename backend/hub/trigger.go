@@ -0,0 +1,470 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+
+	"tool-hub/backend/hub/fifo"
+)
+
+// Triggers call a tool when files change, e.g. to regenerate code or lint on save. Changes are collected
+// until nothing changed for the debounce window, then the tool is called with parameters rendered from the
+// template of the trigger, which receives:
+//
+//	.paths    the changed paths, sorted
+//	.trigger  the name of the trigger
+//
+// Runs of a trigger share a concurrency group of the fifo limiter. While they wait for a slot, further
+// changes are coalesced into the waiting run, so that a burst of saves results in at most one extra run.
+
+const defaultTriggerDebounce = 500 * time.Millisecond
+
+const defaultTriggerParameters = `{"paths": {{json .paths}}}`
+
+var triggerEventOps = map[string]fsnotify.Op{
+	"create": fsnotify.Create,
+	"write":  fsnotify.Write,
+	"remove": fsnotify.Remove,
+	"rename": fsnotify.Rename,
+}
+
+// triggerSpec is a trigger ready to be watched.
+type triggerSpec struct {
+	Trigger
+	dirs     []string        // watched recursively
+	files    map[string]bool // watched through their directory, which editors replace files in
+	include  []string
+	exclude  []string
+	ops      fsnotify.Op
+	debounce time.Duration
+	tmpl     *template.Template
+}
+
+// splitLines returns the non-empty trimmed lines of s.
+func splitLines(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, "\n") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// compileTrigger validates a trigger and prepares it for watching.
+func compileTrigger(ctx context.Context, t Trigger) (*triggerSpec, error) {
+	spec := &triggerSpec{Trigger: t, files: map[string]bool{}, debounce: defaultTriggerDebounce}
+	if strings.TrimSpace(t.Name) == "" {
+		return nil, fmt.Errorf("trigger name is required")
+	}
+	if _, err := findTool(ctx, t.ToolName, false); err != nil {
+		return nil, err
+	}
+	paths := splitLines(t.Paths)
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("at least one watched path is required")
+	}
+	for _, p := range paths {
+		p, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid watched path: %w", err)
+		}
+		if fi.IsDir() {
+			spec.dirs = append(spec.dirs, p)
+		} else {
+			spec.files[p] = true
+		}
+	}
+	spec.include = splitList(t.Include)
+	spec.exclude = splitList(t.Exclude)
+	for _, pattern := range append(append([]string{}, spec.include...), spec.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+	for _, kind := range splitList(t.Events) {
+		op, ok := triggerEventOps[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown event kind %q", kind)
+		}
+		spec.ops |= op
+	}
+	if spec.ops == 0 {
+		spec.ops = fsnotify.Create | fsnotify.Write | fsnotify.Remove | fsnotify.Rename
+	}
+	if t.Debounce != "" {
+		d, err := time.ParseDuration(t.Debounce)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid debounce %q", t.Debounce)
+		}
+		spec.debounce = d
+	}
+	if t.Concurrency < 0 {
+		return nil, fmt.Errorf("concurrency should be positive")
+	}
+	params := t.Parameters
+	if strings.TrimSpace(params) == "" {
+		params = defaultTriggerParameters
+	}
+	tmpl, err := newPromptTemplate(ctx, nil).Parse(params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters template: %w", err)
+	}
+	spec.tmpl = tmpl
+	return spec, nil
+}
+
+// matches reports whether the event is one the trigger runs for.
+func (s *triggerSpec) matches(event fsnotify.Event) bool {
+	if event.Op&s.ops == 0 {
+		return false
+	}
+	rel := ""
+	if s.files[event.Name] {
+		rel = filepath.Base(event.Name)
+	}
+	for _, dir := range s.dirs {
+		if r, err := filepath.Rel(dir, event.Name); err == nil && filepath.IsLocal(r) {
+			rel = filepath.ToSlash(r)
+			break
+		}
+	}
+	if rel == "" {
+		return false
+	}
+	match := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, rel); ok {
+				return true
+			}
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return (len(s.include) == 0 || match(s.include)) && !match(s.exclude)
+}
+
+// parameters renders the parameters of a run for the changed paths.
+func (s *triggerSpec) parameters(paths []string) (string, error) {
+	var buf bytes.Buffer
+	if err := s.tmpl.Execute(&buf, map[string]any{"paths": paths, "trigger": s.Name}); err != nil {
+		return "", err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return "", fmt.Errorf("parameters are not valid JSON: %s", buf.String())
+	}
+	return buf.String(), nil
+}
+
+// triggerManager watches the enabled triggers once the hub is started.
+type triggerManager struct {
+	run     stepRunner
+	limiter *fifo.GroupLimiter
+
+	mu    sync.Mutex
+	ctx   context.Context // context of the hub, nil until it started
+	stops map[int]context.CancelFunc
+	wg    sync.WaitGroup
+}
+
+var hubTriggers = newTriggerManager(executeToolCall)
+
+func newTriggerManager(run stepRunner) *triggerManager {
+	return &triggerManager{run: run, limiter: fifo.DefaultGroupLimiter, stops: map[int]context.CancelFunc{}}
+}
+
+// triggerGroup names the concurrency group of a trigger after its concurrency as well, so that a new
+// concurrency applies to the next runs while the runs started before release the semaphore they acquired.
+func triggerGroup(id int, concurrency uint) string {
+	return fmt.Sprintf("trigger:%d/%d", id, concurrency)
+}
+
+// start watches the enabled triggers until ctx is done.
+func (m *triggerManager) start(ctx context.Context) {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+	list, err := gorm.G[Trigger](db).Where("enabled = ?", true).Find(ctx)
+	if err != nil {
+		runtime.LogErrorf(ctx, "failed to load triggers: %v", err)
+		return
+	}
+	for _, t := range list {
+		if err := m.restart(t); err != nil {
+			runtime.LogErrorf(ctx, "failed to start trigger %s: %v", t.Name, err)
+		}
+	}
+}
+
+// restart stops watching the trigger and watches it again when it's enabled and the hub started.
+func (m *triggerManager) restart(t Trigger) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stop, ok := m.stops[t.ID]; ok {
+		stop()
+		delete(m.stops, t.ID)
+	}
+	if !t.Enabled || m.ctx == nil {
+		return nil
+	}
+	spec, err := compileTrigger(m.ctx, t)
+	if err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for _, dir := range spec.dirs {
+		addRecursiveWatches(m.ctx, watcher, dir)
+	}
+	for file := range spec.files {
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+	ctx, stop := context.WithCancel(m.ctx)
+	m.stops[t.ID] = stop
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer watcher.Close()
+		m.watch(ctx, spec, watcher)
+	}()
+	return nil
+}
+
+// watch collects the changes matching spec and fires the trigger once they settle, until ctx is done.
+func (m *triggerManager) watch(ctx context.Context, spec *triggerSpec, watcher *fsnotify.Watcher) {
+	batch := &triggerBatch{}
+	changed := map[string]bool{}
+	debounce := time.NewTimer(spec.debounce)
+	debounce.Stop()
+	defer debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) {
+				if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() && !skipToolsSubdir(fi.Name()) && spec.inDirs(event.Name) {
+					addRecursiveWatches(ctx, watcher, event.Name)
+				}
+			}
+			if spec.matches(event) {
+				changed[event.Name] = true
+				debounce.Reset(spec.debounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			runtime.LogWarningf(ctx, "trigger %s watcher: %v", spec.Name, err)
+		case <-debounce.C:
+			m.fire(ctx, spec, batch, changed)
+			changed = map[string]bool{}
+		}
+	}
+}
+
+func (s *triggerSpec) inDirs(p string) bool {
+	for _, dir := range s.dirs {
+		if r, err := filepath.Rel(dir, p); err == nil && filepath.IsLocal(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// triggerBatch holds the changes waiting for a run of a trigger.
+type triggerBatch struct {
+	mu      sync.Mutex
+	paths   map[string]bool
+	waiting bool // a run waits for a slot of the concurrency group, changes are added to it
+}
+
+// fire adds the changed paths to the waiting run of the trigger, or starts one.
+func (m *triggerManager) fire(ctx context.Context, spec *triggerSpec, batch *triggerBatch, changed map[string]bool) {
+	batch.mu.Lock()
+	if batch.paths == nil {
+		batch.paths = map[string]bool{}
+	}
+	for p := range changed {
+		batch.paths[p] = true
+	}
+	if batch.waiting {
+		batch.mu.Unlock()
+		return
+	}
+	batch.waiting = true
+	batch.mu.Unlock()
+
+	concurrency := uint(max(spec.Concurrency, 1))
+	group := triggerGroup(spec.ID, concurrency)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		if err := m.limiter.Acquire(ctx, group, concurrency); err != nil {
+			return
+		}
+		defer m.limiter.Release(group)
+		// a run that started goes on when the trigger is stopped, only until the hub is
+		m.mu.Lock()
+		ctx := m.ctx
+		m.mu.Unlock()
+
+		batch.mu.Lock()
+		paths := make([]string, 0, len(batch.paths))
+		for p := range batch.paths {
+			paths = append(paths, p)
+		}
+		batch.paths = nil
+		batch.waiting = false
+		batch.mu.Unlock()
+		sort.Strings(paths)
+
+		callID := newCallID()
+		parameters, err := spec.parameters(paths)
+		if err == nil {
+			_, err = m.run(ctx, toolCall{Name: spec.ToolName, Parameters: parameters, CallID: callID})
+		}
+		update := Trigger{LastRunAt: time.Now().UnixMilli(), LastStatus: "succeeded", LastCallID: callID}
+		if err != nil {
+			update.LastStatus = "failed"
+			update.LastError = err.Error()
+		}
+		db.WithContext(ctx).Model(&Trigger{BaseModel: BaseModel{ID: spec.ID}}).
+			Select("last_run_at", "last_status", "last_error", "last_call_id").Updates(&update)
+	}()
+}
+
+// saveTrigger creates the trigger or updates the one with the same id, and watches it again.
+func saveTrigger(ctx context.Context, t Trigger) (Trigger, error) {
+	t.Name = strings.TrimSpace(t.Name)
+	if _, err := compileTrigger(ctx, t); err != nil {
+		return t, err
+	}
+	var err error
+	if t.ID == 0 {
+		err = gorm.G[Trigger](db).Create(ctx, &t)
+	} else {
+		err = db.WithContext(ctx).Model(&t).
+			Select("name", "tool_name", "paths", "include", "exclude", "events", "debounce", "parameters", "concurrency", "enabled").
+			Updates(&t).Error
+	}
+	if err != nil {
+		return t, err
+	}
+	return t, hubTriggers.restart(t)
+}
+
+// setTriggerEnabled enables or disables a trigger. Enabling compiles it like saveTrigger, disabling only stops
+// watching it so that a trigger whose paths or tool are gone can be stopped.
+func setTriggerEnabled(ctx context.Context, id int, enabled bool) (Trigger, error) {
+	t, err := gorm.G[Trigger](db).Where("id = ?", id).Take(ctx)
+	if err != nil {
+		return t, err
+	}
+	t.Enabled = enabled
+	if enabled {
+		return saveTrigger(ctx, t)
+	}
+	if err := db.WithContext(ctx).Model(&t).Select("enabled").Updates(&t).Error; err != nil {
+		return t, err
+	}
+	return t, hubTriggers.restart(t)
+}
+
+// #region Trigger Bindings
+
+type RespGetTriggerList struct {
+	Error string    `json:"error"`
+	List  []Trigger `json:"list"`
+}
+
+func (m *Model) GetTriggerList() (resp RespGetTriggerList) {
+	list, err := gorm.G[Trigger](db).Order("name").Find(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to list triggers: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	resp.List = list
+	return
+}
+
+type RespSaveTrigger struct {
+	Error string  `json:"error"`
+	Item  Trigger `json:"item"`
+}
+
+func (m *Model) SaveTrigger(t Trigger) (resp RespSaveTrigger) {
+	var err error
+	resp.Item, err = saveTrigger(m.ctx, t)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to save trigger: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+func (m *Model) SetTriggerEnabled(id int, enabled bool) (resp RespSaveTrigger) {
+	var err error
+	resp.Item, err = setTriggerEnabled(m.ctx, id, enabled)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to update trigger: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespDeleteTrigger struct {
+	Error string `json:"error"`
+}
+
+func (m *Model) DeleteTrigger(id int) (resp RespDeleteTrigger) {
+	_, err := gorm.G[Trigger](db).Where("id = ?", id).Delete(m.ctx)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to delete trigger: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	hubTriggers.restart(Trigger{BaseModel: BaseModel{ID: id}})
+	return
+}
+
+// #endregion
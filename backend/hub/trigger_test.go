@@ -0,0 +1,197 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"tool-hub/backend/hub/fifo"
+)
+
+func TestCompileTrigger(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	_, err := createTool(ctx, Tool{Name: "lint", Category: "commandLine"})
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "go.mod")
+	assert.NoError(t, os.WriteFile(file, nil, 0o644))
+
+	spec, err := compileTrigger(ctx, Trigger{Name: "lint", ToolName: "lint", Paths: dir + "\n" + file + "\n",
+		Include: "*.go, go.mod", Exclude: "vendor/*", Events: "write,create"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{dir}, spec.dirs)
+	assert.Equal(t, defaultTriggerDebounce, spec.debounce)
+
+	for name, want := range map[string]bool{
+		"main.go":         true,
+		"pkg/util.go":     true,
+		"go.mod":          true,
+		"README.md":       false,
+		"vendor/x.go":     false,
+		"../elsewhere.go": false,
+	} {
+		event := fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Write}
+		assert.Equal(t, want, spec.matches(event), name)
+	}
+	assert.False(t, spec.matches(fsnotify.Event{Name: filepath.Join(dir, "main.go"), Op: fsnotify.Remove}),
+		"events of other kinds should be ignored")
+
+	params, err := spec.parameters([]string{"/a.go", "/b.go"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"paths": ["/a.go", "/b.go"]}`, params)
+
+	spec, err = compileTrigger(ctx, Trigger{Name: "lint", ToolName: "lint", Paths: dir,
+		Parameters: `{"trigger": {{json .trigger}}, "first": {{json (index .paths 0)}}}`})
+	assert.NoError(t, err)
+	params, err = spec.parameters([]string{"/a.go"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"trigger": "lint", "first": "/a.go"}`, params)
+
+	spec, err = compileTrigger(ctx, Trigger{Name: "lint", ToolName: "lint", Paths: dir, Parameters: `{{.paths}}`})
+	assert.NoError(t, err)
+	_, err = spec.parameters([]string{"/a.go"})
+	assert.Error(t, err, "parameters should be JSON")
+
+	for _, trigger := range []Trigger{
+		{ToolName: "lint", Paths: dir},
+		{Name: "lint", ToolName: "missing", Paths: dir},
+		{Name: "lint", ToolName: "lint"},
+		{Name: "lint", ToolName: "lint", Paths: filepath.Join(dir, "missing")},
+		{Name: "lint", ToolName: "lint", Paths: dir, Include: "[*.go"},
+		{Name: "lint", ToolName: "lint", Paths: dir, Events: "chmod"},
+		{Name: "lint", ToolName: "lint", Paths: dir, Debounce: "soon"},
+		{Name: "lint", ToolName: "lint", Paths: dir, Parameters: `{{json .paths`},
+	} {
+		_, err := compileTrigger(ctx, trigger)
+		assert.Error(t, err, trigger)
+	}
+}
+
+func TestTriggerManager(t *testing.T) {
+	setupTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := createTool(ctx, Tool{Name: "index", Category: "commandLine"})
+	assert.NoError(t, err)
+	dir := t.TempDir()
+
+	var mu sync.Mutex
+	var calls []map[string][]string
+	m := newTriggerManager(func(ctx context.Context, call toolCall) ([]byte, error) {
+		assert.Equal(t, "index", call.Name)
+		assert.NotEmpty(t, call.CallID)
+		var params map[string][]string
+		assert.NoError(t, json.Unmarshal([]byte(call.Parameters), &params))
+		mu.Lock()
+		calls = append(calls, params)
+		mu.Unlock()
+		return []byte("ok"), nil
+	})
+	m.limiter = fifo.NewGroupLimiter()
+	m.start(ctx)
+
+	trigger := Trigger{Name: "index", ToolName: "index", Paths: dir, Include: "*.txt", Debounce: "100ms", Enabled: true}
+	assert.NoError(t, gorm.G[Trigger](db).Create(ctx, &trigger))
+	assert.NoError(t, m.restart(trigger))
+
+	for _, name := range []string{"a.txt", "b.txt", "a.txt", "skipped.log"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(calls) > 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// disabled triggers aren't watched
+	trigger.Enabled = false
+	assert.NoError(t, m.restart(trigger))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "c.txt"), nil, 0o644))
+	time.Sleep(300 * time.Millisecond)
+	m.wg.Wait()
+
+	assert.Equal(t, []map[string][]string{{"paths": {filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")}}}, calls,
+		"a burst of changes should result in one call")
+	got, err := gorm.G[Trigger](db).Where("id = ?", trigger.ID).Take(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "succeeded", got.LastStatus)
+	assert.NotEmpty(t, got.LastCallID)
+}
+
+func TestTriggerRestartDuringRun(t *testing.T) {
+	setupTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := createTool(ctx, Tool{Name: "index", Category: "commandLine"})
+	assert.NoError(t, err)
+	dir := t.TempDir()
+
+	var calls, running, peak atomic.Int32
+	gate := make(chan struct{})
+	m := newTriggerManager(func(ctx context.Context, call toolCall) ([]byte, error) {
+		calls.Add(1)
+		n := running.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		<-gate
+		running.Add(-1)
+		return []byte("ok"), nil
+	})
+	m.limiter = fifo.NewGroupLimiter()
+	m.start(ctx)
+	waitCalls := func(n int32) {
+		assert.Eventually(t, func() bool { return calls.Load() == n }, 5*time.Second, 20*time.Millisecond)
+	}
+
+	trigger := Trigger{Name: "index", ToolName: "index", Paths: dir, Debounce: "50ms", Concurrency: 1, Enabled: true}
+	assert.NoError(t, gorm.G[Trigger](db).Create(ctx, &trigger))
+	assert.NoError(t, m.restart(trigger))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0o644))
+	waitCalls(1)
+	// saving the trigger while it runs neither lets the next run start nor raises the concurrency afterwards
+	assert.NoError(t, m.restart(trigger))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), nil, 0o644))
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load(), "the run started before saving should still hold the slot")
+	gate <- struct{}{}
+	waitCalls(2)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "c.txt"), nil, 0o644))
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, int32(2), calls.Load(), "the third run should wait for the second one")
+	gate <- struct{}{}
+	waitCalls(3)
+	gate <- struct{}{}
+	cancel()
+	m.wg.Wait()
+	assert.Equal(t, int32(1), peak.Load())
+}
+
+func TestSetTriggerEnabled(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	_, err := createTool(ctx, Tool{Name: "index", Category: "commandLine"})
+	assert.NoError(t, err)
+	dir := filepath.Join(t.TempDir(), "docs")
+	assert.NoError(t, os.Mkdir(dir, 0o755))
+	trigger, err := saveTrigger(ctx, Trigger{Name: "index", ToolName: "index", Paths: dir, Enabled: true})
+	assert.NoError(t, err)
+
+	// a trigger whose directory and tool are gone can still be disabled
+	assert.NoError(t, os.Remove(dir))
+	_, err = deleteTool(ctx, "index")
+	assert.NoError(t, err)
+	resp := model.SetTriggerEnabled(trigger.ID, false)
+	assert.Empty(t, resp.Error)
+	assert.False(t, model.GetTriggerList().List[0].Enabled)
+	assert.NotEmpty(t, model.SetTriggerEnabled(trigger.ID, true).Error, "enabling should compile the trigger")
+}
@@ -0,0 +1,333 @@
+package hub
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// Command line tools whose plugin sets Extra.Workspace run in a fresh temporary directory instead of Extra.WD.
+// The directory is seeded with the files sent along with the call, and after the command succeeded the files
+// matching Extra.Outputs are copied to the artifacts directory next to the database and recorded as Artifact.
+// The workspace is removed once the call is done, artifacts are removed after the ArtifactRetention setting.
+
+const (
+	maxWorkspaceInputSize    = 64 << 20  // total size of the files of a call
+	maxArtifactsSize         = 256 << 20 // total size of the artifacts of a call
+	defaultArtifactRetention = 7 * 24 * time.Hour
+)
+
+var (
+	errInvalidCallFiles = errors.New("invalid call files")
+	errArtifactNotFound = errors.New("artifact not found")
+
+	// artifactsDir is the directory holding the artifacts of calls, it's replaced in tests.
+	artifactsDir = func() string { return filepath.Join(hubDataDir(), "artifacts") }
+)
+
+// newCallID returns a random identifier of a tool call.
+func newCallID() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// workspaceFilePath returns where the file named name, a slash separated relative path, lives in dir.
+func workspaceFilePath(dir string, name string) (string, error) {
+	local := filepath.FromSlash(name)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("%w: %q is not a relative path inside the workspace", errInvalidCallFiles, name)
+	}
+	return filepath.Join(dir, local), nil
+}
+
+// prepareWorkspace creates a temporary directory holding files, the caller removes it.
+func prepareWorkspace(files map[string][]byte) (string, error) {
+	var size int
+	for _, content := range files {
+		size += len(content)
+	}
+	if size > maxWorkspaceInputSize {
+		return "", fmt.Errorf("%w: files are larger than %d bytes", errInvalidCallFiles, maxWorkspaceInputSize)
+	}
+	dir, err := os.MkdirTemp("", "tool-hub-workspace-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create workspace: %w", err)
+	}
+	for name, content := range files {
+		p, err := workspaceFilePath(dir, name)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(p), 0o755)
+		}
+		if err == nil {
+			err = os.WriteFile(p, content, 0o644)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// validateOutputPatterns checks the patterns of Extra.Outputs, they use the syntax of path.Match.
+func validateOutputPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid output pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// collectArtifacts stores the regular files of dir matching one of patterns as artifacts of the call.
+func collectArtifacts(ctx context.Context, dir string, callID string, toolName string, patterns []string) ([]Artifact, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	if err := validateOutputPatterns(patterns); err != nil {
+		return nil, err
+	}
+	var names []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, rel); ok {
+				names = append(names, rel)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan workspace: %w", err)
+	}
+
+	artifacts := make([]Artifact, 0, len(names))
+	var total int64
+	for _, name := range names {
+		src := filepath.Join(dir, filepath.FromSlash(name))
+		dst := filepath.Join(artifactsDir(), callID, filepath.FromSlash(name))
+		size, sum, err := copyArtifact(src, dst, maxArtifactsSize-total)
+		if err != nil {
+			return artifacts, fmt.Errorf("failed to store artifact %s: %w", name, err)
+		}
+		total += size
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		artifact := Artifact{
+			CallID:      callID,
+			ToolName:    toolName,
+			Name:        name,
+			Size:        size,
+			SHA256:      sum,
+			ContentType: contentType,
+			Path:        dst,
+		}
+		if err := gorm.G[Artifact](db).Create(ctx, &artifact); err != nil {
+			os.Remove(dst)
+			return artifacts, err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, cleanupArtifacts(ctx)
+}
+
+// copyArtifact copies src to dst and returns its size and sha256, it fails when src is larger than limit.
+func copyArtifact(src string, dst string, limit int64) (int64, string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, "", err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return 0, "", err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, "", err
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, h), io.LimitReader(in, limit+1))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size > limit {
+		err = fmt.Errorf("artifacts of the call are larger than %d bytes", maxArtifactsSize)
+	}
+	if err != nil {
+		os.Remove(dst)
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cleanupArtifacts removes the artifacts older than the ArtifactRetention setting.
+func cleanupArtifacts(ctx context.Context) error {
+	retention := defaultArtifactRetention
+	if d, err := time.ParseDuration(getSetting(ctx, SettingKeyArtifactRetention, "")); err == nil && d > 0 {
+		retention = d
+	}
+	cutoff := time.Now().Add(-retention).UnixMilli()
+	expired, err := gorm.G[Artifact](db).Where("created_at < ?", cutoff).Find(ctx)
+	if err != nil || len(expired) == 0 {
+		return err
+	}
+	for _, a := range expired {
+		if err := removeArtifactFile(a); err != nil {
+			return err
+		}
+	}
+	_, err = gorm.G[Artifact](db).Where("created_at < ?", cutoff).Delete(ctx)
+	return err
+}
+
+// removeArtifactFile removes the file of a, and the directory of its call once empty.
+func removeArtifactFile(a Artifact) error {
+	if err := os.Remove(a.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	root := filepath.Join(artifactsDir(), a.CallID)
+	for dir := filepath.Dir(a.Path); dir != filepath.Dir(root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func findArtifact(ctx context.Context, id string) (Artifact, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("%w: %s", errArtifactNotFound, id)
+	}
+	a, err := gorm.G[Artifact](db).Where("id = ?", n).Take(ctx)
+	if err == gorm.ErrRecordNotFound {
+		return a, fmt.Errorf("%w: %s", errArtifactNotFound, id)
+	}
+	return a, err
+}
+
+// listArtifacts returns the artifacts of a call, or the latest ones when callID is empty.
+func listArtifacts(ctx context.Context, callID string) ([]Artifact, error) {
+	q := gorm.G[Artifact](db).Order("id DESC").Limit(100)
+	if callID != "" {
+		q = gorm.G[Artifact](db).Where("call_id = ?", callID).Order("name")
+	}
+	return q.Find(ctx)
+}
+
+// RespGetArtifactList is the result of GET /api/artifacts and GetArtifactList.
+type RespGetArtifactList struct {
+	Error string     `json:"error"`
+	List  []Artifact `json:"list"`
+}
+
+// listArtifactsHandler lists the artifacts of the call in the callId query parameter, or the latest ones.
+// Only the artifacts of tools the token may call are listed.
+func listArtifactsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	list, err := listArtifacts(ctx, r.URL.Query().Get("callId"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, RespGetArtifactList{Error: err.Error()})
+		return
+	}
+	resp := RespGetArtifactList{List: []Artifact{}}
+	for _, a := range list {
+		if requestAllowsTool(r, a.ToolName) {
+			resp.List = append(resp.List, a)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// downloadArtifact serves the content of the artifact in the path, ranges included.
+func downloadArtifact(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx = context.WithoutCancel(ctx)
+	a, err := findArtifact(ctx, r.PathValue("id"))
+	if err == nil && !requestAllowsTool(r, a.ToolName) {
+		err = fmt.Errorf("%w: %s", errArtifactNotFound, r.PathValue("id"))
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errArtifactNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	f, err := os.Open(a.Path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to open artifact: %v", err), http.StatusGone)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(a.Name)}))
+	w.Header().Set("ETag", `"`+a.SHA256+`"`)
+	http.ServeContent(w, r, "", time.UnixMilli(a.CreatedAt), f)
+}
+
+// #region Artifact Bindings
+
+// GetArtifactList returns the artifacts of a call, or the latest ones when callID is empty.
+func (m *Model) GetArtifactList(callID string) (resp RespGetArtifactList) {
+	var err error
+	resp.List, err = listArtifacts(m.ctx, callID)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to list artifacts: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+type RespDeleteArtifact struct {
+	Error string `json:"error"`
+}
+
+func (m *Model) DeleteArtifact(id int) (resp RespDeleteArtifact) {
+	a, err := findArtifact(m.ctx, strconv.Itoa(id))
+	if err == nil {
+		err = removeArtifactFile(a)
+	}
+	if err == nil {
+		_, err = gorm.G[Artifact](db).Where("id = ?", id).Delete(m.ctx)
+	}
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to delete artifact: %v", err)
+		if m.ctx != nil {
+			runtime.LogError(m.ctx, resp.Error)
+		}
+		return
+	}
+	return
+}
+
+// #endregion
@@ -0,0 +1,115 @@
+package hub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// setupTestArtifacts stores artifacts in a temporary directory for the duration of a test.
+func setupTestArtifacts(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	old := artifactsDir
+	artifactsDir = func() string { return dir }
+	t.Cleanup(func() { artifactsDir = old })
+	return dir
+}
+
+func TestPrepareWorkspace(t *testing.T) {
+	dir, err := prepareWorkspace(map[string][]byte{"in/data.csv": []byte("a,b")})
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	content, err := os.ReadFile(filepath.Join(dir, "in", "data.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a,b", string(content))
+
+	for _, name := range []string{"../escape", "/etc/passwd", ""} {
+		_, err := prepareWorkspace(map[string][]byte{name: nil})
+		assert.ErrorIs(t, err, errInvalidCallFiles, name)
+	}
+}
+
+func TestCollectArtifacts(t *testing.T) {
+	setupTestDB(t)
+	setupTestArtifacts(t)
+	ctx := context.Background()
+
+	ws := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(ws, "out"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(ws, "out", "chart.png"), []byte("png"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(ws, "out", "notes.tmp"), []byte("tmp"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(ws, "report.html"), []byte("<html>"), 0o644))
+
+	_, err := collectArtifacts(ctx, ws, "call1", "plot", []string{"["})
+	assert.Error(t, err)
+	artifacts, err := collectArtifacts(ctx, ws, "call1", "plot", []string{"out/*.png", "*.html"})
+	assert.NoError(t, err)
+	assert.Len(t, artifacts, 2)
+	sum := sha256.Sum256([]byte("png"))
+	assert.Equal(t, "out/chart.png", artifacts[0].Name)
+	assert.Equal(t, int64(3), artifacts[0].Size)
+	assert.Equal(t, hex.EncodeToString(sum[:]), artifacts[0].SHA256)
+	assert.Equal(t, "image/png", artifacts[0].ContentType)
+	stored, err := os.ReadFile(artifacts[0].Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "png", string(stored))
+
+	list, err := listArtifacts(ctx, "call1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	// artifacts older than the retention are removed with their files
+	assert.Empty(t, model.SaveSetting(string(SettingKeyArtifactRetention), "1h").Error)
+	_, err = gorm.G[Artifact](db).Where("id = ?", artifacts[0].ID).Update(ctx, "created_at", time.Now().Add(-2*time.Hour).UnixMilli())
+	assert.NoError(t, err)
+	assert.NoError(t, cleanupArtifacts(ctx))
+	list, err = listArtifacts(ctx, "call1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.NoFileExists(t, artifacts[0].Path)
+	assert.NoDirExists(t, filepath.Dir(artifacts[0].Path), "empty directories should be removed")
+	assert.FileExists(t, artifacts[1].Path)
+}
+
+func TestDownloadArtifact(t *testing.T) {
+	setupTestDB(t)
+	setupTestArtifacts(t)
+	ctx := context.Background()
+	ws := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(ws, "report.txt"), []byte("report"), 0o644))
+	artifacts, err := collectArtifacts(ctx, ws, "call1", "report", []string{"*.txt"})
+	assert.NoError(t, err)
+
+	allowed, _, err := createAPIToken(ctx, "allowed", []string{ScopeToolsCall}, []string{"report"}, 0)
+	assert.NoError(t, err)
+	other, _, err := createAPIToken(ctx, "other", []string{ScopeToolsCall}, []string{"plot"}, 0)
+	assert.NoError(t, err)
+	handler := newHubHandler(ctx)
+	serve := func(token string, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	path := "/api/artifacts/" + strconv.Itoa(artifacts[0].ID)
+	rec := serve(allowed, path)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "report", rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), `filename=report.txt`)
+	assert.Equal(t, http.StatusNotFound, serve(other, path).Code, "tokens may only download artifacts of their tools")
+	assert.Equal(t, http.StatusNotFound, serve(allowed, "/api/artifacts/999").Code)
+	assert.NotContains(t, serve(other, "/api/artifacts?callId=call1").Body.String(), "report.txt")
+}
@@ -15,34 +15,50 @@ interface EvalToolResponseEvent {
   error?: string;
 }
 
+interface EvalToolCancelEvent {
+  requestId: string;
+}
+
 export function initToolEvalService() {
-  // Listen for eval-tool-request events from backend
-  EventsOn('eval-tool-request', async (data: EvalToolRequestEvent) => {
-    console.log('Received eval-tool-request:', data.requestId);
+  // requests the backend gave up on, e.g. after a timeout, get no response
+  const pending = new Set<string>();
+  const canceled = new Set<string>();
 
+  // Listen for eval-tool-request events from backend, they are evaluated concurrently
+  EventsOn('eval-tool-request', async (data: EvalToolRequestEvent) => {
+    pending.add(data.requestId);
+    let response: EvalToolResponseEvent;
     try {
-      const result = await toolWorkerManager.evalTool(data.code, data.parameters);
-
-      const response: EvalToolResponseEvent = {
+      const result = await toolWorkerManager.evalTool(data.code, data.parameters, data.requestId);
+      response = {
         requestId: data.requestId,
         success: result.success,
         tool: result.tool,
         error: result.error,
       };
-
-      // Emit response back to backend
-      await EventsEmit('eval-tool-response', response);
-      console.log('Sent eval-tool-response:', data.requestId);
     } catch (err) {
-      const response: EvalToolResponseEvent = {
+      console.error('Error evaluating tool:', err);
+      response = {
         requestId: data.requestId,
         success: false,
         error: err instanceof Error ? err.message : String(err),
       };
+    }
 
-      await EventsEmit('eval-tool-response', response);
-      console.error('Error evaluating tool:', err);
+    pending.delete(data.requestId);
+    if (canceled.delete(data.requestId)) {
+      return;
+    }
+    // Emit response back to backend
+    await EventsEmit('eval-tool-response', response);
+  });
+
+  EventsOn('eval-tool-cancel', (data: EvalToolCancelEvent) => {
+    if (!pending.has(data.requestId)) {
+      return;
     }
+    canceled.add(data.requestId);
+    toolWorkerManager.cancel(data.requestId);
   });
 
   console.log('ToolEvalService initialized');
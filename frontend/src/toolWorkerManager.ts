@@ -1,92 +1,155 @@
-// toolWorkerManager.ts - Manages WebWorker for tool plugin evaluation
+// toolWorkerManager.ts - Manages a pool of WebWorkers for tool plugin evaluation
 import ToolWorkerUrl from './toolrc.worker?worker&url';
 
 interface EvalToolRequest {
   type: 'eval-tool';
+  id: number;
   code: string;
   parameters: string;
 }
 
 interface EvalToolResponse {
   type: 'eval-tool-result';
+  id: number;
   success: boolean;
   tool?: any;
   error?: string;
   stack?: string;
 }
 
+interface EvalToolResult {
+  success: boolean;
+  tool?: any;
+  error?: string;
+}
+
+interface EvalTask {
+  id: number;
+  requestId?: string;
+  request: EvalToolRequest;
+  resolve: (result: EvalToolResult) => void;
+}
+
+interface PooledWorker {
+  worker: Worker;
+  ready: Promise<void>;
+  task: EvalTask | null;
+}
+
+// The backend bounds how many evaluations run at once (EvalConcurrency setting), the pool grows up to
+// this many workers on demand.
+const maxWorkers = Math.max(1, Math.min(navigator.hardwareConcurrency || 4, 16));
+
 class ToolWorkerManager {
-  private worker: Worker | null = null;
-  private isReady = false;
-  private readyPromise: Promise<void>;
-  private readyResolve!: () => void;
-
-  constructor() {
-    this.readyPromise = new Promise((resolve) => {
-      this.readyResolve = resolve;
-    });
-    this.initWorker();
-  }
+  private workers: PooledWorker[] = [];
+  private queue: EvalTask[] = [];
+  private nextId = 1;
 
-  private initWorker() {
-    this.worker = new Worker(ToolWorkerUrl, { type: 'module' });
+  private spawnWorker(): PooledWorker {
+    const worker = new Worker(ToolWorkerUrl, { type: 'module' });
+    let readyResolve!: () => void;
+    const pooled: PooledWorker = {
+      worker,
+      ready: new Promise((resolve) => {
+        readyResolve = resolve;
+      }),
+      task: null,
+    };
 
-    this.worker.onmessage = (e) => {
+    worker.onmessage = (e) => {
       if (e.data.type === 'ready') {
-        this.isReady = true;
-        this.readyResolve();
+        readyResolve();
+        return;
+      }
+      const response: EvalToolResponse = e.data;
+      if (response.type !== 'eval-tool-result' || pooled.task?.id !== response.id) {
+        return;
       }
+      const task = pooled.task;
+      pooled.task = null;
+      task.resolve({ success: response.success, tool: response.tool, error: response.error });
+      this.dispatch();
     };
 
-    this.worker.onerror = (err) => {
+    worker.onerror = (err) => {
       console.error('ToolWorker error:', err);
+      const task = pooled.task;
+      this.replaceWorker(pooled);
+      task?.resolve({ success: false, error: err.message || 'Worker error' });
     };
+
+    this.workers.push(pooled);
+    return pooled;
   }
 
-  async evalTool(
-    code: string,
-    parameters: string,
-  ): Promise<{ success: boolean; tool?: any; error?: string }> {
-    if (!this.isReady) {
-      await this.readyPromise;
-    }
+  // replaceWorker terminates a worker, e.g. stuck on an abandoned evaluation, and carries on with the queue.
+  private replaceWorker(pooled: PooledWorker) {
+    pooled.worker.terminate();
+    pooled.task = null;
+    this.workers = this.workers.filter((w) => w !== pooled);
+    this.dispatch();
+  }
 
-    return new Promise((resolve) => {
-      if (!this.worker) {
-        resolve({ success: false, error: 'Worker not initialized' });
-        return;
+  private dispatch() {
+    while (this.queue.length > 0) {
+      let pooled = this.workers.find((w) => w.task === null);
+      if (!pooled) {
+        if (this.workers.length >= maxWorkers) {
+          return;
+        }
+        pooled = this.spawnWorker();
       }
-
-      const handler = (e: MessageEvent) => {
-        const response: EvalToolResponse = e.data;
-        if (response.type === 'eval-tool-result') {
-          this.worker?.removeEventListener('message', handler);
-          resolve({
-            success: response.success,
-            tool: response.tool,
-            error: response.error,
-          });
+      const task = this.queue.shift()!;
+      pooled.task = task;
+      const target = pooled;
+      target.ready.then(() => {
+        if (target.task === task) {
+          target.worker.postMessage(task.request);
         }
-      };
-
-      this.worker.addEventListener('message', handler);
-
-      const request: EvalToolRequest = {
-        type: 'eval-tool',
-        code,
-        parameters,
-      };
+      });
+    }
+  }
 
-      this.worker.postMessage(request);
+  // evalTool evaluates a plugin on the first idle worker, requestId identifies the evaluation for cancel.
+  evalTool(code: string, parameters: string, requestId?: string): Promise<EvalToolResult> {
+    return new Promise((resolve) => {
+      const id = this.nextId++;
+      this.queue.push({
+        id,
+        requestId,
+        request: { type: 'eval-tool', id, code, parameters },
+        resolve,
+      });
+      this.dispatch();
     });
   }
 
+  // cancel abandons an evaluation, it resolves as failed and its worker, if any, is replaced.
+  cancel(requestId: string) {
+    const queued = this.queue.findIndex((task) => task.requestId === requestId);
+    if (queued >= 0) {
+      const [task] = this.queue.splice(queued, 1);
+      task.resolve({ success: false, error: 'Evaluation canceled' });
+      return;
+    }
+    const pooled = this.workers.find((w) => w.task?.requestId === requestId);
+    if (pooled) {
+      const task = pooled.task!;
+      this.replaceWorker(pooled);
+      task.resolve({ success: false, error: 'Evaluation canceled' });
+    }
+  }
+
   destroy() {
-    if (this.worker) {
-      this.worker.terminate();
-      this.worker = null;
-      this.isReady = false;
+    for (const pooled of this.workers) {
+      pooled.worker.terminate();
+      pooled.task?.resolve({ success: false, error: 'Worker terminated' });
+    }
+    for (const task of this.queue) {
+      task.resolve({ success: false, error: 'Worker terminated' });
     }
+    this.workers = [];
+    this.queue = [];
   }
 }
 
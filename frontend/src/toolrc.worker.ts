@@ -31,12 +31,14 @@ const deps = {
 
 interface EvalToolRequest {
   type: 'eval-tool';
+  id: number;
   code: string;
   parameters: string;
 }
 
 interface EvalToolResponse {
   type: 'eval-tool-result';
+  id: number;
   success: boolean;
   tool?: any;
   error?: string;
@@ -50,13 +52,14 @@ self.onmessage = (e) => {
   if (request.type !== 'eval-tool') {
     self.postMessage({
       type: 'eval-tool-result',
+      id: request.id,
       success: false,
       error: 'Invalid request type',
     } as EvalToolResponse);
     return;
   }
 
-  const { code, parameters } = request;
+  const { id, code, parameters } = request;
 
   try {
     // Execute the plugin code
@@ -74,12 +77,14 @@ self.onmessage = (e) => {
 
     self.postMessage({
       type: 'eval-tool-result',
+      id,
       success: true,
       tool,
     } as EvalToolResponse);
   } catch (err) {
     self.postMessage({
       type: 'eval-tool-result',
+      id,
       success: false,
       error: (err as Error).message,
       stack: (err as Error).stack,
@@ -2,7 +2,11 @@ package main
 
 import (
 	"embed"
+	"flag"
+	"io"
 	"log"
+	"os"
+	"strings"
 
 	appPkg "tool-hub/backend/app"
 	"tool-hub/backend/hub"
@@ -23,6 +27,16 @@ var icon []byte
 
 const appName = "tool-hub"
 
+// listenFlag collects repeated -listen flags.
+type listenFlag []string
+
+func (f *listenFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *listenFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
 func main() {
 	// Create an instance of the app structure
 	app := appPkg.NewApp()
@@ -30,6 +44,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to initialize logger: %v", err)
 	}
+	parseFlags()
 	// Create application with options
 	err = wails.Run(&options.App{
 		Title:             appName,
@@ -96,6 +111,21 @@ func main() {
 	}
 }
 
+// parseFlags parses the command line flags of tool-hub, unknown flags are ignored since the
+// platform may pass its own arguments to the app.
+func parseFlags() {
+	var listen listenFlag
+	flags := flag.NewFlagSet(appName, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Var(&listen, "listen", "address the hub listens on, e.g. tcp://127.0.0.1:9573, https://127.0.0.1:9574, unix:///tmp/hub.sock?mode=0660 (repeatable)")
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		log.Printf("failed to parse flags: %v", err)
+	}
+	if err := hub.SetListenOverrides(listen); err != nil {
+		log.Fatalf("invalid -listen flag: %v", err)
+	}
+}
+
 type StringEnumItem struct {
 	Value  hub.StringValues
 	TSName string
@@ -104,6 +134,19 @@ type StringEnumItem struct {
 func genStringEnumBinds() []StringEnumItem {
 	return []StringEnumItem{
 		{hub.SettingKeyToolDir, "SettingKeyToolsDir"},
+		{hub.SettingKeyClipboardCapture, "SettingKeyClipboardCapture"},
+		{hub.SettingKeyClipboardHistoryLimit, "SettingKeyClipboardHistoryLimit"},
+		{hub.SettingKeyListeners, "SettingKeyListeners"},
+		{hub.SettingKeyAllowedOrigins, "SettingKeyAllowedOrigins"},
+		{hub.SettingKeyAllowedHosts, "SettingKeyAllowedHosts"},
+		{hub.SettingKeyActiveProfile, "SettingKeyActiveProfile"},
+		{hub.SettingKeyEnvPolicy, "SettingKeyEnvPolicy"},
+		{hub.SettingKeyEnvAllowlist, "SettingKeyEnvAllowlist"},
+		{hub.SettingKeyArtifactRetention, "SettingKeyArtifactRetention"},
+		{hub.SettingKeyResultCacheSize, "SettingKeyResultCacheSize"},
+		{hub.SettingKeyEvalCache, "SettingKeyEvalCache"},
+		{hub.SettingKeyEvalConcurrency, "SettingKeyEvalConcurrency"},
+		{hub.SettingKeyEvalTimeout, "SettingKeyEvalTimeout"},
 	}
 }
 
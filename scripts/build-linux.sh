@@ -2,5 +2,5 @@
 # Build for Linux (AMD64)
 
 echo "Building for Linux (amd64)..."
-wails build -platform linux/amd64 -clean
+wails build -platform linux/amd64 -clean -tags sqlite_fts5
 echo "Build complete! Check build/bin/"
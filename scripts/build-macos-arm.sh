@@ -2,5 +2,5 @@
 # Build for macOS (Apple Silicon - ARM64)
 
 echo "Building for macOS (arm64 - Apple Silicon)..."
-wails build -platform darwin/arm64 -clean
+wails build -platform darwin/arm64 -clean -tags sqlite_fts5
 echo "Build complete! Check build/bin/"
@@ -2,5 +2,5 @@
 # Build for macOS (Intel - AMD64)
 
 echo "Building for macOS (amd64 - Intel)..."
-wails build -platform darwin/amd64 -clean
+wails build -platform darwin/amd64 -clean -tags sqlite_fts5
 echo "Build complete! Check build/bin/"
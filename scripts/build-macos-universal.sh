@@ -2,5 +2,5 @@
 # Build universal macOS binary (Intel + Apple Silicon)
 
 echo "Building universal macOS binary..."
-wails build -platform darwin/universal -clean
+wails build -platform darwin/universal -clean -tags sqlite_fts5
 echo "Build complete! Check build/bin/"
@@ -2,5 +2,5 @@
 # Build for Windows (AMD64)
 
 echo "Building for Windows (amd64)..."
-wails build -platform windows/amd64 -clean
+wails build -platform windows/amd64 -clean -tags sqlite_fts5
 echo "Build complete! Check build/bin/"
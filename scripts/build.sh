@@ -2,5 +2,5 @@
 # Simple production build for current platform
 
 echo "Building for production..."
-wails build -clean
+wails build -clean -tags sqlite_fts5
 echo "Build complete! Check build/bin/"
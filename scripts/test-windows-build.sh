@@ -17,7 +17,7 @@ npm install
 
 echo "🔨 Building Windows executable..."
 cd "$TEMP_DIR/testapp"
-wails build -platform windows/amd64
+wails build -platform windows/amd64 -tags sqlite_fts5
 
 echo "✅ Build complete!"
 echo "📍 Executable location: $TEMP_DIR/testapp/build/bin/testapp.exe"